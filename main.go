@@ -16,13 +16,26 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	_ "embed"
+	"errors"
 	"fmt"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/kyodo-tech/decapta/model"
+	"github.com/kyodo-tech/decapta/scaffold"
+	"github.com/kyodo-tech/decapta/server"
+	"github.com/kyodo-tech/decapta/watch"
 	"github.com/spf13/cobra"
 )
 
@@ -40,6 +53,30 @@ func main() {
 	var contentDir string
 	var slugFields string
 	var ignoreFiles string
+	var jobs int
+	var dryRun bool
+	var diffFormat string
+	var limit int
+	var manifestFile string
+	var onlyChanged bool
+	var since string
+	var namesOnly bool
+	var addr string
+	var allowOrigins []string
+	var rootDir string
+	var adminDir string
+	var postProcess bool
+	var debounce time.Duration
+	var initOpts scaffold.Options
+	var initProjects []string
+	var interactive bool
+	var index model.Index
+	var indexTemplate string
+	var listView bool
+	var listViewOpts model.ListView
+	var previewSnapshot bool
+	var normalize map[string]string
+	var reserved []string
 
 	var rootCmd = &cobra.Command{
 		Use:   "decapta",
@@ -50,109 +87,653 @@ func main() {
 		Use:   "pre-process",
 		Short: "Pre-process data for Decap CMS",
 		Run: func(cmd *cobra.Command, args []string) {
-			ignoredFiles := strings.Split(ignoreFiles, ",")
+			opts := model.Options{Jobs: jobs, Reserved: reserved}
+			plan := newDryRunPlan(dryRun, &opts)
 
-			slugFieldList := []string{}
-			if slugFields != "" {
-				slugFieldList = strings.Split(slugFields, ",")
+			err := model.PreProcess(cmd.Context(), dataType, dataDir, contentDir, splitList(slugFields), splitList(ignoreFiles), opts)
+			checkStep(dataType, "Pre-Process", err)
+
+			reportDryRun(plan, diffFormat)
+		},
+	}
+
+	var postProcessCmd = &cobra.Command{
+		Use:   "post-process",
+		Short: "Post-process data from Decap CMS",
+		Run: func(cmd *cobra.Command, args []string) {
+			opts := model.Options{Jobs: jobs, OnlyChanged: onlyChanged, Since: since, Normalize: normalize}
+			plan := newDryRunPlan(dryRun, &opts)
+
+			err := model.PostProcess(cmd.Context(), dataType, contentDir, dataDir, opts)
+			checkStep(dataType, "Post-Process", err)
+
+			reportDryRun(plan, diffFormat)
+		},
+	}
+
+	var configCmd = &cobra.Command{
+		Use:   "config",
+		Short: "Generate config.yml for Decap CMS",
+		Run: func(cmd *cobra.Command, args []string) {
+			listViewOpts.Disabled = !listView
+			opts := model.Options{Index: index, ListView: listViewOpts, PreviewSnapshot: previewSnapshot, Reserved: reserved, OnConflict: printConflict}
+			plan := newDryRunPlan(dryRun, &opts)
+
+			err := model.GenerateConfig(dataType, dataDir, outputFile, loadTemplate(templateFile), loadIndexTemplate(indexTemplate), contentDir, splitList(ignoreFiles), opts)
+			checkStep(dataType, "Config Generation", err)
+
+			reportDryRun(plan, diffFormat)
+		},
+	}
+
+	var validateCmd = &cobra.Command{
+		Use:   "validate [config.yml]",
+		Short: "Validate config.yml against the rules of Decap CMS",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			configFile := "admin/config.yml"
+			if len(args) > 0 {
+				configFile = args[0]
 			}
 
-			switch dataType {
-			case "arb":
-				err := model.ARBPreProcess(dataDir, contentDir)
-				if err != nil {
-					log.Fatalf("ARB Pre-Process Error: %v", err)
+			configErrors, err := model.ValidateConfig(configFile, rootDir)
+			if err != nil {
+				log.Fatalf("Validate Error: %v", err)
+			}
+			if len(configErrors) == 0 {
+				fmt.Printf("%s is valid\n", configFile)
+				return
+			}
+			for _, configError := range configErrors {
+				fmt.Println(configError)
+			}
+			os.Exit(2)
+		},
+	}
+
+	var verifyCmd = &cobra.Command{
+		Use:   "verify",
+		Short: "Verify that data survives a pre-process and post-process round trip",
+		Run: func(cmd *cobra.Command, args []string) {
+			opts := model.Options{Jobs: jobs, Reserved: reserved}
+
+			divergences, err := model.Verify(cmd.Context(), dataType, dataDir, splitList(slugFields), splitList(ignoreFiles), opts)
+			checkStep(dataType, "Verify", err)
+
+			if len(divergences) == 0 {
+				fmt.Println("Round trip is lossless")
+				return
+			}
+
+			counts := make(map[string]int)
+			for _, d := range divergences {
+				counts[d.File]++
+			}
+
+			reported := make(map[string]int)
+			for _, d := range divergences {
+				reported[d.File]++
+				if limit > 0 && reported[d.File] > limit {
+					continue
 				}
-			case "csv":
-				err := model.CSVPreProcess(dataDir, contentDir, slugFieldList, ignoredFiles)
-				if err != nil {
-					log.Fatalf("CSV Pre-Process Error: %v", err)
+				fmt.Println(d)
+				if limit > 0 && reported[d.File] == limit && counts[d.File] > limit {
+					fmt.Printf("%s: %d more divergences not shown\n", d.File, counts[d.File]-limit)
 				}
-			default:
-				fmt.Println("Unsupported data type:", dataType)
 			}
+			os.Exit(2)
 		},
 	}
 
-	var postProcessCmd = &cobra.Command{
-		Use:   "post-process",
-		Short: "Post-process data from Decap CMS",
+	var syncCmd = &cobra.Command{
+		Use:   "sync [project...]",
+		Short: "Pre-process and generate config for all or the given manifest projects",
 		Run: func(cmd *cobra.Command, args []string) {
-			switch dataType {
-			case "arb":
-				err := model.ARBPostProcess(contentDir, dataDir)
+			manifest, projects := loadManifest(manifestFile, args)
+
+			opts := model.Options{Jobs: jobs, OnConflict: printConflict}
+			plan := newDryRunPlan(dryRun, &opts)
+
+			err := manifest.Sync(cmd.Context(), projects, loadTemplate(manifest.Template), loadIndexTemplate(manifest.IndexTemplate), opts)
+			if err != nil {
+				log.Fatalf("Sync Error: %v", err)
+			}
+
+			reportDryRun(plan, diffFormat)
+		},
+	}
+
+	var buildCmd = &cobra.Command{
+		Use:   "build [project...]",
+		Short: "Post-process content for all or the given manifest projects",
+		Run: func(cmd *cobra.Command, args []string) {
+			manifest, projects := loadManifest(manifestFile, args)
+
+			opts := model.Options{Jobs: jobs, OnlyChanged: onlyChanged, Since: since}
+			plan := newDryRunPlan(dryRun, &opts)
+
+			err := manifest.Build(cmd.Context(), projects, opts)
+			if err != nil {
+				log.Fatalf("Build Error: %v", err)
+			}
+
+			reportDryRun(plan, diffFormat)
+		},
+	}
+
+	var changedCmd = &cobra.Command{
+		Use:   "changed [project...]",
+		Short: "List content changed since the last processing or a git revision",
+		Run: func(cmd *cobra.Command, args []string) {
+			// A single content directory instead of the manifest projects
+			if cmd.Flags().Changed("content-dir") {
+				changes, err := model.DetectChanges(cmd.Context(), contentDir, since)
 				if err != nil {
-					log.Fatalf("ARB Post-Process Error: %v", err)
+					log.Fatalf("Change Detection Error: %v", err)
+				}
+				for _, change := range changes {
+					if namesOnly {
+						fmt.Println(change.Path)
+					} else {
+						fmt.Printf("%s\t%s\n", change.Kind, change.Path)
+					}
 				}
-			case "csv":
-				err := model.CSVPostProcess(contentDir, dataDir)
+				return
+			}
+
+			_, projects := loadManifest(manifestFile, args)
+			for _, project := range projects {
+				changes, err := model.DetectChanges(cmd.Context(), project.Content, since)
 				if err != nil {
-					log.Fatalf("CSV Post-Process Error: %v", err)
+					log.Fatalf("Change Detection Error: project %s: %v", project.Name, err)
+				}
+				if namesOnly {
+					if len(changes) > 0 {
+						fmt.Println(project.Name)
+					}
+					continue
+				}
+				for _, change := range changes {
+					fmt.Printf("%s\t%s\t%s\n", project.Name, change.Kind, change.Path)
 				}
-			default:
-				fmt.Println("Unsupported data type:", dataType)
 			}
 		},
 	}
 
-	var configCmd = &cobra.Command{
-		Use:   "config",
-		Short: "Generate config.yml for Decap CMS",
+	var serveCmd = &cobra.Command{
+		Use:   "serve [project...]",
+		Short: "Serve the admin directory and a local backend for Decap CMS",
 		Run: func(cmd *cobra.Command, args []string) {
-			ignoredFiles := strings.Split(ignoreFiles, ",")
+			root, err := filepath.Abs(rootDir)
+			if err != nil {
+				log.Fatalf("Serve Error: %v", err)
+			}
 
-			var templateData []byte
-			if templateFile == "" {
-				templateData = embeddedTemplateConfigSample
-			} else {
-				// Load the config template
-				templateContent, err := os.ReadFile(templateFile)
-				if err != nil {
-					log.Fatalf("Error reading template file: %v", err)
+			logger := log.New(os.Stderr, "", log.LstdFlags)
+			baseURL := localURL(addr)
+			srv := &server.Server{
+				Root:           root,
+				AdminDir:       adminDir,
+				APIURL:         baseURL + server.APIPath,
+				AllowedOrigins: allowOrigins,
+				Logger:         logger,
+			}
+
+			if postProcess {
+				var projects []model.Project
+				if dataType != "" {
+					if dataDir == "" {
+						log.Fatalf(`Serve Error: --post-process with -t requires --out`)
+					}
+					// Like entry paths, the directories are relative to root
+					projects = []model.Project{{Name: dataType, Type: dataType, Data: rootPath(root, dataDir), Content: rootPath(root, contentDir), Normalize: normalize}}
+				} else {
+					if !cmd.Flags().Changed("manifest") {
+						manifestFile = filepath.Join(root, model.DefaultManifestFile)
+					}
+					_, projects = loadManifest(manifestFile, args)
+					for i := range projects {
+						projects[i].Data, _ = filepath.Abs(projects[i].Data)
+						projects[i].Content, _ = filepath.Abs(projects[i].Content)
+					}
 				}
-				templateData = templateContent
+				srv.OnChange = postProcessHook(cmd.Context(), root, projects, model.Options{Jobs: jobs}, logger)
 			}
 
-			switch dataType {
-			case "arb":
-				err := model.ARBGenerateConfig(dataDir, outputFile, templateData, indexHTML, contentDir)
-				if err != nil {
-					log.Fatalf("ARB Config Generation Error: %v", err)
+			httpServer := &http.Server{Addr: addr, Handler: srv.Handler()}
+			go func() {
+				<-cmd.Context().Done()
+				httpServer.Close()
+			}()
+
+			logger.Printf("Serving %s on %s/admin/", adminDir, baseURL)
+			if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("Serve Error: %v", err)
+			}
+		},
+	}
+
+	var watchCmd = &cobra.Command{
+		Use:   "watch [project...]",
+		Short: "Pre-process changed data and post-process changed content until interrupted",
+		Run: func(cmd *cobra.Command, args []string) {
+			w := &watch.Watcher{
+				IndexHTML: indexHTML,
+				Debounce:  debounce,
+				Options:   model.Options{Jobs: jobs},
+			}
+
+			if dataType != "" {
+				if dataDir == "" {
+					log.Fatalf(`Watch Error: -t requires --in`)
 				}
-			case "csv":
-				err := model.CSVGenerateConfig(dataDir, outputFile, templateData, indexHTML, contentDir, ignoredFiles)
-				if err != nil {
-					log.Fatalf("CSV Config Generation Error: %v", err)
+				w.Projects = []model.Project{{
+					Name:      dataType,
+					Type:      dataType,
+					Data:      dataDir,
+					Content:   contentDir,
+					Slug:      splitList(slugFields),
+					Ignore:    splitList(ignoreFiles),
+					Normalize: normalize,
+					Reserved:  reserved,
+				}}
+				w.Config = outputFile
+				w.TemplateData = loadTemplate(templateFile)
+			} else {
+				manifest, projects := loadManifest(manifestFile, args)
+				w.Projects = projects
+				w.Config = manifest.Config
+				w.TemplateData = loadTemplate(manifest.Template)
+				w.IndexHTML = loadIndexTemplate(manifest.IndexTemplate)
+				w.Options.Index = manifest.Index
+			}
+
+			if err := w.Run(cmd.Context()); err != nil {
+				log.Fatalf("Watch Error: %v", err)
+			}
+		},
+	}
+
+	var initCmd = &cobra.Command{
+		Use:   "init [dir]",
+		Short: "Create the admin directory, manifest and project folders of a new site",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			initOpts.Dir = "."
+			if len(args) > 0 {
+				initOpts.Dir = args[0]
+			}
+
+			if interactive {
+				in := bufio.NewReader(os.Stdin)
+				initOpts.Backend = prompt(in, "Backend ("+strings.Join(scaffold.Backends, ", ")+")", initOpts.Backend)
+				if initOpts.Backend == "github" || initOpts.Backend == "gitlab" {
+					initOpts.Repo = prompt(in, "Repository (owner/name)", initOpts.Repo)
+				}
+				if initOpts.Backend != "test-repo" {
+					initOpts.Branch = prompt(in, "Branch", initOpts.Branch)
 				}
-			default:
-				fmt.Println("Unsupported data type:", dataType)
+				initOpts.LocalBackend = prompt(in, "Enable local_backend for decapta serve (y/n)", map[bool]string{true: "y", false: "n"}[initOpts.LocalBackend]) == "y"
+				initOpts.MediaFolder = prompt(in, "Media folder", initOpts.MediaFolder)
+				initProjects = splitList(prompt(in, "Projects (comma-separated name:type)", strings.Join(initProjects, ",")))
 			}
+
+			for _, p := range initProjects {
+				name, projectType, ok := strings.Cut(p, ":")
+				if !ok {
+					log.Fatalf("Init Error: project %q is not in name:type form", p)
+				}
+				initOpts.Projects = append(initOpts.Projects, model.Project{Name: name, Type: projectType})
+			}
+			initOpts.IndexHTML = indexHTML
+
+			files, err := scaffold.Init(initOpts)
+			if err != nil {
+				log.Fatalf("Init Error: %v", err)
+			}
+			for _, file := range files {
+				fmt.Println("created", filepath.Join(initOpts.Dir, file))
+			}
+
+			// Generate the collections of the examples, so the config is complete
+			if !initOpts.Examples || len(initOpts.Projects) == 0 {
+				fmt.Println("Add data files, then run `decapta sync` to generate the content and collections and `decapta serve` to edit locally.")
+				return
+			}
+			if err := syncSite(cmd.Context(), initOpts.Dir); err != nil {
+				log.Fatalf("Init Error: %v", err)
+			}
+			fmt.Println("Run `decapta serve` to edit locally, and `decapta sync` after changing the data files.")
 		},
 	}
 
-	rootCmd.PersistentFlags().StringVarP(&dataType, "type", "t", "", "Data type (arb or csv)")
-	rootCmd.MarkPersistentFlagRequired("type")
+	rootCmd.PersistentFlags().StringVarP(&dataType, "type", "t", "", "Data type (arb, csv, json, jsonl, toml, xlsx or yaml)")
+	for _, cmd := range []*cobra.Command{preProcessCmd, postProcessCmd, configCmd, verifyCmd} {
+		cmd.PreRunE = func(cmd *cobra.Command, args []string) error {
+			if dataType == "" {
+				return errors.New(`required flag(s) "type" not set`)
+			}
+			return nil
+		}
+	}
 
 	preProcessCmd.Flags().StringVarP(&dataDir, "in", "i", "", "Directory containing data files ARB,CSV,etc.")
 	preProcessCmd.Flags().StringVar(&contentDir, "content-dir", "content", "Content directory for CMS")
 	preProcessCmd.Flags().StringVar(&slugFields, "slug", "", "Comma-separated list of fields to use for identifier_field (e.g., id,name,status)")
 	preProcessCmd.Flags().StringVar(&ignoreFiles, "ignore-files", "", "Comma-separated list of filenames to ignore (e.g., interactions.csv,metadata.csv)")
+	preProcessCmd.Flags().IntVarP(&jobs, "jobs", "j", runtime.NumCPU(), "Maximum number of files and rows processed concurrently")
 
 	postProcessCmd.Flags().StringVar(&contentDir, "content-dir", "content", "Content directory for CMS")
 	postProcessCmd.Flags().StringVarP(&dataDir, "out", "o", "", "Output directory to write ARB,CSV,etc. files")
+	postProcessCmd.Flags().IntVarP(&jobs, "jobs", "j", runtime.NumCPU(), "Maximum number of files processed concurrently")
+	for _, cmd := range []*cobra.Command{preProcessCmd, configCmd, verifyCmd, watchCmd} {
+		cmd.Flags().StringSliceVar(&reserved, "reserved", nil, "Comma-separated list of field names that CSV columns and data keys are renamed from (default \""+strings.Join(model.DefaultReservedFields, ",")+"\")")
+	}
+	for _, cmd := range []*cobra.Command{postProcessCmd, serveCmd, watchCmd} {
+		cmd.Flags().StringToStringVar(&normalize, "normalize", nil, "Normalization rules of CSV columns (preserve, exact, trim or trim-lines), e.g. notes=trim-lines,*=exact")
+	}
 
 	configCmd.Flags().StringVarP(&dataDir, "in", "i", "", "Directory containing data files ARB,CSV,etc.")
 	configCmd.Flags().StringVarP(&outputFile, "output-file", "o", "admin/config.yml", "Output file for config")
 	configCmd.Flags().StringVar(&templateFile, "template-file", "", "Template yml config file")
 	configCmd.Flags().StringVar(&contentDir, "content-dir", "content", "Content directory for CMS")
 	configCmd.Flags().StringVar(&ignoreFiles, "ignore-files", "", "Comma-separated list of filenames to ignore (e.g., interactions.csv,metadata.csv)")
+	configCmd.Flags().StringVar(&indexTemplate, "index-template", "", "Template html file for index.html")
+	configCmd.Flags().StringVar(&index.CMSVersion, "cms-version", "", "Version of decap-cms loaded from the CDN (default \"^3.0.0\")")
+	configCmd.Flags().StringVar(&index.CMSURL, "cms-url", "", "Base URL of the CDN serving decap-cms (default \"https://unpkg.com\")")
+	configCmd.Flags().StringVar(&index.CMSScript, "cms-script", "", "Self-hosted decap-cms script path used instead of the CDN")
+	configCmd.Flags().StringVar(&index.Title, "title", "", "Title of the admin page (default \"Content Manager\")")
+	configCmd.Flags().StringArrayVar(&index.Scripts, "script", nil, "Additional script loaded after the CMS, repeatable")
+	configCmd.Flags().StringArrayVar(&index.PreviewStyles, "preview-style", nil, "Stylesheet registered with CMS.registerPreviewStyle, repeatable")
+	configCmd.Flags().BoolVar(&index.Preserve, "preserve-index", false, "Keep an existing index.html instead of rendering it")
+	configCmd.Flags().BoolVar(&listView, "list-view", true, "Generate summary, sortable fields, view filters and view groups for CSV collections")
+	configCmd.Flags().StringVar(&listViewOpts.Summary, "summary", "", "Summary template of CSV collections (e.g., \"{{id}} - {{name}}\")")
+	configCmd.Flags().StringSliceVar(&listViewOpts.SortableFields, "sortable-fields", nil, "Comma-separated list of columns to sort by instead of the numeric and date columns")
+	configCmd.Flags().StringSliceVar(&listViewOpts.GroupFields, "group-fields", nil, "Comma-separated list of columns to filter and group by instead of the detected select-like columns")
+	configCmd.Flags().IntVar(&listViewOpts.MaxGroupValues, "max-group-values", 10, "Maximum number of distinct values of a column detected as select-like")
+	configCmd.Flags().BoolVar(&previewSnapshot, "preview-snapshot", false, "Publish a JSON snapshot of each CSV file with the admin UI to preview the neighbouring rows of an entry")
+
+	validateCmd.Flags().StringVar(&rootDir, "root", ".", "Repository root that collection folders and files are relative to")
+
+	verifyCmd.Flags().StringVarP(&dataDir, "in", "i", "", "Directory containing data files ARB,CSV,etc.")
+	verifyCmd.Flags().StringVar(&slugFields, "slug", "", "Comma-separated list of fields to use for identifier_field (e.g., id,name,status)")
+	verifyCmd.Flags().StringVar(&ignoreFiles, "ignore-files", "", "Comma-separated list of filenames to ignore (e.g., interactions.csv,metadata.csv)")
+	verifyCmd.Flags().IntVarP(&jobs, "jobs", "j", runtime.NumCPU(), "Maximum number of files and rows processed concurrently")
+	verifyCmd.Flags().IntVar(&limit, "limit", 20, "Maximum number of divergences listed per file, 0 lists all")
+
+	changedCmd.Flags().StringVar(&contentDir, "content-dir", "content", "Content directory to check instead of the manifest projects")
+	changedCmd.Flags().StringVarP(&manifestFile, "manifest", "m", model.DefaultManifestFile, "Manifest file listing the projects")
+	changedCmd.Flags().BoolVar(&namesOnly, "names-only", false, "Only list the changed projects, or the changed files with --content-dir")
+
+	serveCmd.Flags().StringVar(&addr, "addr", "localhost:8081", "Address to listen on")
+	serveCmd.Flags().StringSliceVar(&allowOrigins, "allow-origin", nil, "Comma-separated list of origins besides the server's own that may call the local backend, e.g. a site's development server")
+	serveCmd.Flags().StringVar(&rootDir, "root", ".", "Repository root that entry and media paths are relative to")
+	serveCmd.Flags().StringVar(&adminDir, "admin-dir", "admin", "Directory containing config.yml and index.html")
+	serveCmd.Flags().BoolVar(&postProcess, "post-process", false, "Post-process content after each saved entry, for the manifest projects or the project given with -t")
+	serveCmd.Flags().StringVar(&contentDir, "content-dir", "content", "Content directory for CMS relative to --root, with -t")
+	serveCmd.Flags().StringVarP(&dataDir, "out", "o", "", "Output directory to write ARB,CSV,etc. files relative to --root, with -t")
+	serveCmd.Flags().StringVarP(&manifestFile, "manifest", "m", model.DefaultManifestFile, "Manifest file listing the projects, looked up in --root unless given")
+	serveCmd.Flags().IntVarP(&jobs, "jobs", "j", runtime.NumCPU(), "Maximum number of files processed concurrently")
+
+	watchCmd.Flags().StringVarP(&dataDir, "in", "i", "", "Directory containing data files ARB,CSV,etc., with -t")
+	watchCmd.Flags().StringVar(&contentDir, "content-dir", "content", "Content directory for CMS, with -t")
+	watchCmd.Flags().StringVar(&slugFields, "slug", "", "Comma-separated list of fields to use for identifier_field, with -t")
+	watchCmd.Flags().StringVar(&ignoreFiles, "ignore-files", "", "Comma-separated list of filenames to ignore, with -t")
+	watchCmd.Flags().StringVarP(&outputFile, "output-file", "o", "admin/config.yml", "Output file for config, with -t")
+	watchCmd.Flags().StringVar(&templateFile, "template-file", "", "Template yml config file, with -t")
+	watchCmd.Flags().StringVarP(&manifestFile, "manifest", "m", model.DefaultManifestFile, "Manifest file listing the projects")
+	watchCmd.Flags().IntVarP(&jobs, "jobs", "j", runtime.NumCPU(), "Maximum number of files and rows processed concurrently")
+	watchCmd.Flags().DurationVar(&debounce, "debounce", watch.DefaultDebounce, "Time to wait for file events to settle before processing")
+
+	initCmd.Flags().StringVar(&initOpts.Backend, "backend", "test-repo", "CMS backend ("+strings.Join(scaffold.Backends, ", ")+")")
+	initCmd.Flags().StringVar(&initOpts.Repo, "repo", "", "Repository of the github or gitlab backend (owner/name), required for them")
+	initCmd.Flags().StringVar(&initOpts.Branch, "branch", "master", "Branch of the git backend")
+	initCmd.Flags().StringVar(&initOpts.BaseURL, "base-url", "", "Base URL of the OAuth provider")
+	initCmd.Flags().BoolVar(&initOpts.LocalBackend, "local-backend", true, "Enable local_backend so the CMS uses decapta serve on localhost")
+	initCmd.Flags().StringVar(&initOpts.MediaFolder, "media-folder", "_images", "Folder for uploaded media")
+	initCmd.Flags().StringVar(&initOpts.PublicFolder, "public-folder", "", "Public path of the media folder")
+	initCmd.Flags().StringSliceVar(&initProjects, "project", []string{"example:csv"}, "Project as name:type, repeatable")
+	initCmd.Flags().BoolVar(&initOpts.Examples, "examples", true, "Write a sample data file into each project")
+	initCmd.Flags().BoolVar(&initOpts.Force, "force", false, "Overwrite existing files")
+	initCmd.Flags().BoolVar(&interactive, "interactive", false, "Prompt for the settings, using the flags as defaults")
+
+	for _, cmd := range []*cobra.Command{postProcessCmd, buildCmd} {
+		cmd.Flags().BoolVar(&onlyChanged, "only-changed", false, "Only post-process content changed since the last processing or --since")
+	}
+	for _, cmd := range []*cobra.Command{postProcessCmd, buildCmd, changedCmd} {
+		cmd.Flags().StringVar(&since, "since", "", "Detect changes against this git revision instead of the recorded checksums")
+	}
+
+	for _, cmd := range []*cobra.Command{syncCmd, buildCmd} {
+		cmd.Flags().StringVarP(&manifestFile, "manifest", "m", model.DefaultManifestFile, "Manifest file listing the projects")
+		cmd.Flags().IntVarP(&jobs, "jobs", "j", runtime.NumCPU(), "Maximum number of files and rows processed concurrently")
+	}
+
+	for _, cmd := range []*cobra.Command{preProcessCmd, postProcessCmd, configCmd, syncCmd, buildCmd} {
+		cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print the changes instead of writing them, exit with status 2 if files would change")
+		cmd.Flags().StringVar(&diffFormat, "diff-format", "unified", "Dry-run output format (unified or json)")
+	}
 
 	rootCmd.AddCommand(preProcessCmd)
 	rootCmd.AddCommand(postProcessCmd)
+	configCmd.AddCommand(validateCmd)
 	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(verifyCmd)
+	rootCmd.AddCommand(syncCmd)
+	rootCmd.AddCommand(buildCmd)
+	rootCmd.AddCommand(changedCmd)
+	rootCmd.AddCommand(serveCmd)
+	rootCmd.AddCommand(watchCmd)
+	rootCmd.AddCommand(initCmd)
 
-	if err := rootCmd.Execute(); err != nil {
+	// Cancel in-flight work on interrupt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 }
+
+// splitList splits a comma-separated flag value, returning nil if it is empty.
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// loadTemplate reads the config template file, or returns the embedded
+// template if path is empty.
+func loadTemplate(path string) []byte {
+	if path == "" {
+		return embeddedTemplateConfigSample
+	}
+
+	// Load the config template
+	templateContent, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Error reading template file: %v", err)
+	}
+	return templateContent
+}
+
+// loadIndexTemplate reads the index.html template file, or returns the
+// embedded template if path is empty.
+func loadIndexTemplate(path string) []byte {
+	if path == "" {
+		return indexHTML
+	}
+
+	templateContent, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Error reading index template file: %v", err)
+	}
+	return templateContent
+}
+
+// syncSite syncs all projects of the manifest in dir, whose paths are
+// relative to it.
+func syncSite(ctx context.Context, dir string) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if err := os.Chdir(dir); err != nil {
+		return err
+	}
+	defer os.Chdir(wd)
+
+	manifest, err := model.LoadManifest(model.DefaultManifestFile)
+	if err != nil {
+		return err
+	}
+	return manifest.Sync(ctx, manifest.Projects, loadTemplate(manifest.Template), loadIndexTemplate(manifest.IndexTemplate), model.Options{Jobs: runtime.NumCPU(), OnConflict: printConflict})
+}
+
+// printConflict reports a config value kept over the generated one.
+func printConflict(conflict string) {
+	fmt.Fprintf(os.Stderr, "Config conflict: %s\n", conflict)
+}
+
+// loadManifest reads the manifest and selects the named projects, or all
+// projects if no names are given.
+func loadManifest(path string, names []string) (*model.Manifest, []model.Project) {
+	manifest, err := model.LoadManifest(path)
+	if err != nil {
+		log.Fatalf("Manifest Error: %v", err)
+	}
+	projects, err := manifest.Select(names)
+	if err != nil {
+		log.Fatalf("Manifest Error: %v", err)
+	}
+	return manifest, projects
+}
+
+// checkStep exits with a fatal error if a processing step failed. Unsupported
+// data types are reported without failing.
+func checkStep(dataType string, step string, err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, model.ErrUnsupportedType):
+		fmt.Println("Unsupported data type:", dataType)
+		os.Exit(0)
+	default:
+		log.Fatalf("%s %s Error: %v", strings.ToUpper(dataType), step, err)
+	}
+}
+
+// newDryRunPlan routes all writes of opts into a plan when dryRun is set.
+func newDryRunPlan(dryRun bool, opts *model.Options) *model.Plan {
+	if !dryRun {
+		return nil
+	}
+	plan := model.NewPlan()
+	opts.Output = plan
+	return plan
+}
+
+// reportDryRun prints the changes collected in plan and exits with status 2
+// if any file would be created, modified or deleted. It does nothing for a
+// nil plan.
+func reportDryRun(plan *model.Plan, format string) {
+	if plan == nil {
+		return
+	}
+
+	changes, err := plan.Changes()
+	if err != nil {
+		log.Fatalf("Dry-Run Error: %v", err)
+	}
+
+	switch format {
+	case "unified":
+		err = model.WriteUnifiedDiff(os.Stdout, changes)
+	case "json":
+		err = model.WriteChangeSummary(os.Stdout, changes)
+	default:
+		log.Fatalf("Unsupported diff format: %s", format)
+	}
+	if err != nil {
+		log.Fatalf("Dry-Run Error: %v", err)
+	}
+
+	if len(changes) > 0 {
+		os.Exit(2)
+	}
+}
+
+// postProcessHook returns a callback that post-processes the content entries
+// of projects affected by the changed paths, which are relative to root.
+// Post-processing runs one change at a time and failures are logged.
+func postProcessHook(ctx context.Context, root string, projects []model.Project, opts model.Options, logger *log.Logger) func(paths []string) {
+	var mu sync.Mutex
+	return func(paths []string) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		for _, project := range projects {
+			// Paths of the CMS are relative to root, and so is the content
+			contentDir := rootPath(root, project.Content)
+
+			var changes []model.ContentChange
+			for _, p := range paths {
+				rel, err := filepath.Rel(contentDir, filepath.Join(root, filepath.FromSlash(p)))
+				if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+					continue
+				}
+				changes = append(changes, model.ContentChange{Path: filepath.ToSlash(rel)})
+			}
+			if len(changes) == 0 {
+				continue
+			}
+
+			projectOpts := opts
+			projectOpts.Only = model.ChangedEntries(changes)
+			if err := project.PostProcess(ctx, projectOpts); err != nil {
+				logger.Printf("Post-Process Error: project %s: %v", project.Name, err)
+				continue
+			}
+			logger.Printf("post-processed %s", project.Name)
+		}
+	}
+}
+
+// rootPath resolves a relative path against root.
+func rootPath(root string, p string) string {
+	if filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(root, p)
+}
+
+// localURL returns the base URL of a listen address, with localhost for an
+// address without host such as ":8081".
+func localURL(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "http://" + addr
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// prompt asks for a value on stdout, returning def if the answer is empty.
+func prompt(in *bufio.Reader, label string, def string) string {
+	if def != "" {
+		fmt.Printf("%s [%s]: ", label, def)
+	} else {
+		fmt.Printf("%s: ", label)
+	}
+	answer, err := in.ReadString('\n')
+	if err != nil && answer == "" {
+		return def
+	}
+	if answer = strings.TrimSpace(answer); answer != "" {
+		return answer
+	}
+	return def
+}
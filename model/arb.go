@@ -15,27 +15,33 @@
 package model
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
 // ARBPreProcess converts ARB files into single content files per language for Decap CMS.
-func ARBPreProcess(arbDir string, contentDir string) error {
+// Up to opts.Jobs files are converted concurrently.
+func ARBPreProcess(ctx context.Context, arbDir string, contentDir string, opts Options) error {
 	files, err := os.ReadDir(arbDir)
 	if err != nil {
 		return fmt.Errorf("error reading ARB directory: %v", err)
 	}
 
-	for _, file := range files {
+	p := newPool(ctx, opts.Jobs)
+	for i, file := range files {
 		if !strings.HasSuffix(file.Name(), ".arb") {
 			continue
 		}
+		if opts.Only != nil && !opts.Only[file.Name()] {
+			continue
+		}
 
 		arbFilePath := filepath.Join(arbDir, file.Name())
 		language := extractLanguage(file.Name())
@@ -44,74 +50,83 @@ func ARBPreProcess(arbDir string, contentDir string) error {
 			continue
 		}
 
-		arbFile, err := os.ReadFile(arbFilePath)
-		if err != nil {
-			return fmt.Errorf("error reading ARB file %s: %v", arbFilePath, err)
-		}
-
-		// Use OrderedMap to preserve key order
-		var arbData OrderedMap
-		if err := json.Unmarshal(arbFile, &arbData); err != nil {
-			return fmt.Errorf("error parsing ARB file %s: %v", arbFilePath, err)
-		}
+		p.Go(i, func(ctx context.Context) error {
+			return arbPreProcessFile(arbFilePath, language, contentDir, opts.output())
+		})
+	}
 
-		// Prepare translation data for front matter
-		frontMatter := make(map[string]interface{})
+	return p.Wait()
+}
 
-		for _, kv := range arbData {
-			key := kv.Key
-			value := kv.Value
+// arbPreProcessFile writes the content file for a single ARB file.
+func arbPreProcessFile(arbFilePath string, language string, contentDir string, out Output) error {
+	arbFile, err := os.ReadFile(arbFilePath)
+	if err != nil {
+		return fmt.Errorf("error reading ARB file %s: %v", arbFilePath, err)
+	}
 
-			if strings.HasPrefix(key, "@") {
-				continue // Skip metadata keys for now
-			}
+	// Use OrderedMap to preserve key order
+	var arbData OrderedMap
+	if err := json.Unmarshal(arbFile, &arbData); err != nil {
+		return fmt.Errorf("error parsing ARB file %s: %v", arbFilePath, err)
+	}
 
-			translationEntry := map[string]interface{}{
-				"value": value,
-			}
+	// Prepare translation data for front matter, in the key order of the ARB file
+	var frontMatter OrderedMap
 
-			// Handle metadata
-			metadataKey := fmt.Sprintf("@%s", key)
-			if metadataValue, found := arbData.Get(metadataKey); found {
-				translationEntry["metadata"] = metadataValue
-			}
+	for _, kv := range arbData {
+		key := kv.Key
+		value := kv.Value
 
-			frontMatter[key] = translationEntry
+		if strings.HasPrefix(key, "@") {
+			continue // Skip metadata keys for now
 		}
 
-		// Create content directory if it doesn't exist
-		err = os.MkdirAll(contentDir, os.ModePerm)
-		if err != nil {
-			return fmt.Errorf("error creating content directory %s: %v", contentDir, err)
-		}
+		translationEntry := OrderedMap{{Key: "value", Value: value}}
 
-		// Write to content file per language
-		contentFilePath := filepath.Join(contentDir, fmt.Sprintf("%s.yaml", language))
-		yamlData, err := yaml.Marshal(frontMatter)
-		if err != nil {
-			return fmt.Errorf("error marshaling YAML for language %s: %v", language, err)
+		// Handle metadata
+		metadataKey := fmt.Sprintf("@%s", key)
+		if metadataValue, found := arbData.Get(metadataKey); found {
+			translationEntry = append(translationEntry, KVPair{Key: "metadata", Value: metadataValue})
 		}
 
-		err = os.WriteFile(contentFilePath, yamlData, 0644)
-		if err != nil {
-			return fmt.Errorf("error writing content file %s: %v", contentFilePath, err)
-		}
+		frontMatter = append(frontMatter, KVPair{Key: key, Value: translationEntry})
 	}
 
-	return nil
+	// Write to content file per language
+	contentFilePath := filepath.Join(contentDir, fmt.Sprintf("%s.yaml", language))
+	return writeContentFile(out, contentFilePath, frontMatter)
 }
 
 // ARBPostProcess reads the content files and reconstructs the ARB JSON files, preserving key order.
-func ARBPostProcess(contentDir string, arbDir string) error {
+// ARB files are only replaced once every language has been converted successfully.
+func ARBPostProcess(ctx context.Context, contentDir string, arbDir string, opts Options) error {
 	files, err := os.ReadDir(contentDir)
 	if err != nil {
 		return fmt.Errorf("error reading content directory: %v", err)
 	}
 
+	out := opts.Output
+	var tx *Transaction
+	if out == nil {
+		tx, err = NewTransaction(arbDir)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		out = tx
+	}
+
 	for _, file := range files {
-		if !strings.HasSuffix(file.Name(), ".yaml") {
+		if !strings.HasSuffix(file.Name(), ".yaml") || strings.HasPrefix(file.Name(), ".") {
 			continue
 		}
+		if opts.Only != nil && !opts.Only[file.Name()] {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
 		language := strings.TrimSuffix(file.Name(), ".yaml")
 		contentFilePath := filepath.Join(contentDir, file.Name())
@@ -121,59 +136,58 @@ func ARBPostProcess(contentDir string, arbDir string) error {
 			return fmt.Errorf("error reading content file %s: %v", contentFilePath, err)
 		}
 
-		frontMatter, err := YAMLToMapStringInterface(yamlContent)
-		if err != nil {
+		var frontMatter OrderedMap
+		if err := yaml.Unmarshal(yamlContent, &frontMatter); err != nil {
 			return fmt.Errorf("error unmarshaling YAML file %s: %v", contentFilePath, err)
 		}
 
-		// Reconstruct the ARB data with preserved order
+		// Reconstruct the ARB data in the key order of the content file
 		var arbData OrderedMap
 
-		for _, key := range getOrderedKeys(frontMatter) {
-			entry, ok := frontMatter[key].(map[string]interface{})
+		for _, kv := range frontMatter {
+			key := kv.Key
+			entry, ok := kv.Value.(OrderedMap)
 			if !ok {
 				return fmt.Errorf("unexpected data type for key %s in file %s", key, contentFilePath)
 			}
 
-			value := entry["value"]
+			value, _ := entry.Get("value")
 			arbData = append(arbData, KVPair{Key: key, Value: value})
 
 			// Include metadata if present
-			if metadata, ok := entry["metadata"]; ok {
+			if metadata, ok := entry.Get("metadata"); ok {
 				metadataKey := fmt.Sprintf("@%s", key)
 				arbData = append(arbData, KVPair{Key: metadataKey, Value: metadata})
 			}
 		}
 
 		// Convert arbData to JSON with preserved order
-		arbJSON, err := arbData.MarshalJSON()
+		arbJSON, err := json.MarshalIndent(arbData, "", "  ")
 		if err != nil {
 			return fmt.Errorf("error marshaling ARB JSON for language %s: %v", language, err)
 		}
 
-		// ensure the output directory exists
-		err = os.MkdirAll(arbDir, os.ModePerm)
-		if err != nil {
-			return fmt.Errorf("error creating output directory %s: %v", arbDir, err)
-		}
-
 		arbFilePath := filepath.Join(arbDir, fmt.Sprintf("app_%s.arb", language))
-		err = os.WriteFile(arbFilePath, arbJSON, 0644)
+		err = out.WriteFile(arbFilePath, arbJSON)
 		if err != nil {
 			return fmt.Errorf("error writing ARB file %s: %v", arbFilePath, err)
 		}
 	}
 
+	if tx != nil {
+		return tx.Commit()
+	}
 	return nil
 }
 
-func ARBGenerateConfig(arbDir string, outputFile string, templateData, indexHTML []byte, contentDir string) error {
+func ARBGenerateConfig(arbDir string, outputFile string, templateData, indexHTML []byte, contentDir string, opts Options) error {
 	files, err := os.ReadDir(arbDir)
 	if err != nil {
 		return fmt.Errorf("error reading ARB directory: %v", err)
 	}
 
 	var collections []Collection
+	previews := make(map[string]preview)
 
 	for _, file := range files {
 		if !strings.HasSuffix(file.Name(), ".arb") {
@@ -186,6 +200,9 @@ func ARBGenerateConfig(arbDir string, outputFile string, templateData, indexHTML
 			continue
 		}
 
+		// File collections look up preview templates by file name
+		previews[fmt.Sprintf("translation_%s", language)] = preview{Type: "arb"}
+
 		collection := Collection{
 			Name:  fmt.Sprintf("translations_%s", language),
 			Label: fmt.Sprintf("Translations (%s)", strings.ToUpper(language)),
@@ -201,20 +218,21 @@ func ARBGenerateConfig(arbDir string, outputFile string, templateData, indexHTML
 
 		// Read the content file to get the keys for fields
 		contentFilePath := filepath.Join(contentDir, fmt.Sprintf("%s.yaml", language))
-		yamlContent, err := os.ReadFile(contentFilePath)
+		yamlContent, err := opts.output().ReadFile(contentFilePath)
 		if err != nil {
 			return fmt.Errorf("error reading content file %s: %v", contentFilePath, err)
 		}
 
-		var frontMatter map[string]interface{}
+		var frontMatter OrderedMap
 		err = yaml.Unmarshal(yamlContent, &frontMatter)
 		if err != nil {
 			return fmt.Errorf("error unmarshaling YAML file %s: %v", contentFilePath, err)
 		}
 
-		// Generate fields for each translation key
-		for _, key := range getOrderedKeys(frontMatter) {
-			entry, ok := frontMatter[key].(map[string]interface{})
+		// Generate fields for each translation key, in the order of the ARB file
+		for _, kv := range frontMatter {
+			key := kv.Key
+			entry, ok := kv.Value.(OrderedMap)
 			if !ok {
 				return fmt.Errorf("unexpected data type for key %s in file %s", key, contentFilePath)
 			}
@@ -226,9 +244,13 @@ func ARBGenerateConfig(arbDir string, outputFile string, templateData, indexHTML
 			}
 
 			// If there are placeholders or metadata, format them properly
-			if metadata, ok := entry["metadata"]; ok {
-				if placeholders, exists := metadata.(map[string]interface{})["placeholders"]; exists {
-					field.Hint = formatPlaceholders(placeholders.(map[string]interface{}))
+			if metadata, ok := entry.Get("metadata"); ok {
+				if metadata, ok := metadata.(OrderedMap); ok {
+					if placeholders, ok := metadata.Get("placeholders"); ok {
+						if placeholders, ok := placeholders.(OrderedMap); ok {
+							field.Hint = formatPlaceholders(placeholders)
+						}
+					}
 				}
 			}
 
@@ -238,13 +260,7 @@ func ARBGenerateConfig(arbDir string, outputFile string, templateData, indexHTML
 		collections = append(collections, collection)
 	}
 
-	// Ensure the output directory exists
-	err = os.MkdirAll(filepath.Dir(outputFile), os.ModePerm)
-	if err != nil {
-		return fmt.Errorf("error creating output directory %s: %v", filepath.Dir(outputFile), err)
-	}
-
-	err = writeCollections(collections, templateData, indexHTML, outputFile)
+	err = writeCollections(collections, previews, templateData, indexHTML, outputFile, opts)
 	if err != nil {
 		return fmt.Errorf("error writing config: %v", err)
 	}
@@ -252,13 +268,13 @@ func ARBGenerateConfig(arbDir string, outputFile string, templateData, indexHTML
 	return nil
 }
 
-func formatPlaceholders(placeholders map[string]interface{}) string {
+func formatPlaceholders(placeholders OrderedMap) string {
 	var formatted []string
-	for name, details := range placeholders {
-		if detailMap, ok := details.(map[string]interface{}); ok {
-			placeholderType := detailMap["type"]
-			example := detailMap["example"]
-			formatted = append(formatted, fmt.Sprintf("%s (type: %v, example: %v)", name, placeholderType, example))
+	for _, kv := range placeholders {
+		if details, ok := kv.Value.(OrderedMap); ok {
+			placeholderType, _ := details.Get("type")
+			example, _ := details.Get("example")
+			formatted = append(formatted, fmt.Sprintf("%s (type: %v, example: %v)", kv.Key, placeholderType, example))
 		}
 	}
 	return "Placeholders: " + strings.Join(formatted, ", ")
@@ -274,16 +290,6 @@ func extractLanguage(filename string) string {
 	return ""
 }
 
-func getOrderedKeys(data map[string]interface{}) []string {
-	keys := make([]string, 0, len(data))
-	for key := range data {
-		keys = append(keys, key)
-	}
-	// Sort keys to maintain order (adjust if necessary to match original order)
-	sort.Strings(keys)
-	return keys
-}
-
 // OrderedMap is used to preserve the order of keys in JSON
 type KVPair struct {
 	Key   string
@@ -293,23 +299,57 @@ type KVPair struct {
 type OrderedMap []KVPair
 
 func (om *OrderedMap) UnmarshalJSON(data []byte) error {
-	var tempMap map[string]interface{}
-	if err := json.Unmarshal(data, &tempMap); err != nil {
+	value, err := decodeOrderedJSON(data)
+	if err != nil {
 		return err
 	}
-
-	for key, value := range tempMap {
-		*om = append(*om, KVPair{Key: key, Value: value})
+	object, ok := value.(OrderedMap)
+	if !ok {
+		return fmt.Errorf("expected a JSON object")
 	}
+	*om = object
 	return nil
 }
 
 func (om OrderedMap) MarshalJSON() ([]byte, error) {
-	tempMap := make(map[string]interface{})
-	for _, kv := range om {
-		tempMap[kv.Key] = kv.Value
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, kv := range om {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		// Callers escape HTML characters as they need, such as json.Marshal
+		key, err := marshalJSON(kv.Key, "")
+		if err != nil {
+			return nil, err
+		}
+		value, err := marshalJSON(kv.Value, "")
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(bytes.TrimSuffix(key, []byte("\n")))
+		buf.WriteByte(':')
+		buf.Write(bytes.TrimSuffix(value, []byte("\n")))
 	}
-	return json.MarshalIndent(tempMap, "", "  ")
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func (om *OrderedMap) UnmarshalYAML(node *yaml.Node) error {
+	value, err := decodeOrderedYAML(node)
+	if err != nil {
+		return err
+	}
+	object, ok := value.(OrderedMap)
+	if !ok {
+		return fmt.Errorf("line %d: expected a mapping", node.Line)
+	}
+	*om = object
+	return nil
+}
+
+func (om OrderedMap) MarshalYAML() (interface{}, error) {
+	return orderedYAMLNode(om)
 }
 
 func (om OrderedMap) Get(key string) (interface{}, bool) {
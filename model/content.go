@@ -0,0 +1,244 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// writeContentFile writes a content file with the values of content, in
+// their order. Comments of an existing file are kept, as are the formatting
+// of values that did not change. Multi-line strings are written in literal
+// block style.
+func writeContentFile(out Output, path string, content OrderedMap) error {
+	generated, err := orderedYAMLNode(content)
+	if err != nil {
+		return fmt.Errorf("error marshaling YAML for %s: %v", path, err)
+	}
+	setLiteralStyle(generated)
+
+	doc := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{generated}}
+
+	existing, err := out.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error reading content file %s: %v", path, err)
+	}
+	if err == nil {
+		var existingDoc yaml.Node
+		// An unparsable file is replaced, as it was before comments were kept
+		if yaml.Unmarshal(existing, &existingDoc) == nil && len(existingDoc.Content) > 0 {
+			existingDoc.Content[0] = mergeContentNode(existingDoc.Content[0], generated)
+			doc = &existingDoc
+		}
+	}
+
+	data, err := encodeContent(doc)
+	if err != nil {
+		return fmt.Errorf("error marshaling YAML for %s: %v", path, err)
+	}
+	if err := out.WriteFile(path, data); err != nil {
+		return fmt.Errorf("error writing content file %s: %v", path, err)
+	}
+	return nil
+}
+
+// encodeContent encodes a content document with the indentation Decap CMS
+// uses.
+func encodeContent(doc *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// mergeContentNode returns the generated node, reusing the nodes of existing
+// that are unchanged and the comments of those that changed. Mappings take
+// the key order of generated, keys that are no longer generated are dropped,
+// except merge keys, which keep their position. Sequence items are merged by
+// position. Anchors are kept, and so are aliases and merge keys while the
+// values they stand for are unchanged.
+func mergeContentNode(existing, generated *yaml.Node) *yaml.Node {
+	m := &contentMerger{anchors: make(map[string]*yaml.Node)}
+	return m.merge(existing, generated)
+}
+
+// contentMerger merges nodes in document order, so that aliases resolve to
+// their anchors as merged.
+type contentMerger struct {
+	anchors map[string]*yaml.Node
+}
+
+func (m *contentMerger) merge(existing, generated *yaml.Node) *yaml.Node {
+	if existing.Kind == yaml.AliasNode {
+		if anchor := m.anchors[existing.Value]; anchor != nil && nodesEqual(anchor, generated) {
+			return existing
+		}
+		merged := *existing
+		replaceNode(&merged, generated)
+		return &merged
+	}
+
+	if existing.Kind == generated.Kind && (existing.Kind == yaml.MappingNode || existing.Kind == yaml.SequenceNode) {
+		merged := &yaml.Node{
+			Kind:        existing.Kind,
+			Tag:         existing.Tag,
+			Style:       existing.Style,
+			Anchor:      existing.Anchor,
+			HeadComment: existing.HeadComment,
+			LineComment: existing.LineComment,
+			FootComment: existing.FootComment,
+		}
+		if existing.Kind == yaml.SequenceNode {
+			for i, item := range generated.Content {
+				if i < len(existing.Content) {
+					item = m.merge(existing.Content[i], item)
+				}
+				merged.Content = append(merged.Content, item)
+			}
+			return m.anchor(merged)
+		}
+
+		// Merge keys are kept while their anchors are, and inherited values
+		// are only written where they changed
+		type mergeKey struct {
+			at         int
+			key, value *yaml.Node
+		}
+		var mergeKeys []mergeKey
+		var inherited []*yaml.Node
+		for i := 0; i+1 < len(existing.Content); i += 2 {
+			if !isMergeKey(existing.Content[i]) {
+				continue
+			}
+			sources, ok := m.mergeSources(existing.Content[i+1])
+			if !ok {
+				continue
+			}
+			// An explicit tag would be written as "!!merge <<"
+			key := *existing.Content[i]
+			key.Tag = ""
+			mergeKeys = append(mergeKeys, mergeKey{at: i, key: &key, value: existing.Content[i+1]})
+			inherited = append(inherited, sources...)
+		}
+
+		for i := 0; i+1 < len(generated.Content); i += 2 {
+			key, value := generated.Content[i], generated.Content[i+1]
+			if existingKey, existingValue := mappingEntry(existing, key.Value); existingKey != nil {
+				key, value = existingKey, m.merge(existingValue, value)
+			} else if inheritedValue := m.inheritedValue(inherited, key.Value); inheritedValue != nil && nodesEqual(inheritedValue, value) {
+				continue
+			}
+			merged.Content = append(merged.Content, key, value)
+		}
+		for _, mk := range mergeKeys {
+			at := mk.at
+			if at > len(merged.Content) {
+				at = len(merged.Content)
+			}
+			merged.Content = append(merged.Content[:at], append([]*yaml.Node{mk.key, mk.value}, merged.Content[at:]...)...)
+		}
+		return m.anchor(merged)
+	}
+
+	if nodesEqual(existing, generated) {
+		return m.anchor(existing)
+	}
+	merged := *existing
+	replaceNode(&merged, generated)
+	merged.Anchor = existing.Anchor
+	return m.anchor(&merged)
+}
+
+// anchor records the anchor of a merged node for the aliases that follow.
+func (m *contentMerger) anchor(node *yaml.Node) *yaml.Node {
+	if node.Anchor != "" {
+		m.anchors[node.Anchor] = node
+	}
+	return node
+}
+
+// mergeSources returns the merged mappings a merge key value inherits from,
+// false if one of its anchors no longer exists.
+func (m *contentMerger) mergeSources(value *yaml.Node) ([]*yaml.Node, bool) {
+	aliases := []*yaml.Node{value}
+	if value.Kind == yaml.SequenceNode {
+		aliases = value.Content
+	}
+	var sources []*yaml.Node
+	for _, alias := range aliases {
+		if alias.Kind != yaml.AliasNode {
+			return nil, false
+		}
+		source := m.anchors[alias.Value]
+		if source == nil || source.Kind != yaml.MappingNode {
+			return nil, false
+		}
+		sources = append(sources, source)
+	}
+	return sources, true
+}
+
+// inheritedValue returns the value a key inherits from merge sources, the
+// first one defining it winning.
+func (m *contentMerger) inheritedValue(sources []*yaml.Node, key string) *yaml.Node {
+	for _, source := range sources {
+		if _, value := mappingEntry(source, key); value != nil {
+			return value
+		}
+		for i := 0; i+1 < len(source.Content); i += 2 {
+			if !isMergeKey(source.Content[i]) {
+				continue
+			}
+			if nested, ok := m.mergeSources(source.Content[i+1]); ok {
+				if value := m.inheritedValue(nested, key); value != nil {
+					return value
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func mappingEntry(mapping *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i], mapping.Content[i+1]
+		}
+	}
+	return nil, nil
+}
+
+// setLiteralStyle writes multi-line strings in literal block style. The
+// encoder falls back to quoting where a block cannot represent the value.
+func setLiteralStyle(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode && node.ShortTag() == "!!str" && strings.Contains(node.Value, "\n") {
+		node.Style = yaml.LiteralStyle
+	}
+	for _, child := range node.Content {
+		setLiteralStyle(child)
+	}
+}
@@ -15,33 +15,38 @@
 package model
 
 import (
+	"bufio"
+	"context"
 	"encoding/csv"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 )
 
-func addPrefixIfReserved(fieldName string) string {
-	if reservedFields()[fieldName] {
-		return decaptaPrefix + fieldName
-	}
-	return fieldName
-}
+// typeDetectionSampleSize bounds the number of rows inspected to detect the
+// widget type of a CSV column.
+const typeDetectionSampleSize = 1000
 
 // CSVPreProcess reads CSV files and creates a file per CSV row for Decap CMS.
-func CSVPreProcess(csvDir string, contentDir string, slugFields, ignoredFiles []string) error {
+// Files, and the rows within each file, are written concurrently up to opts.Jobs.
+func CSVPreProcess(ctx context.Context, csvDir string, contentDir string, slugFields, ignoredFiles []string, opts Options) error {
 	files, err := os.ReadDir(csvDir)
 	if err != nil {
 		return fmt.Errorf("error reading CSV directory: %v", err)
 	}
 
-	for _, file := range files {
+	p := newPool(ctx, opts.Jobs)
+	for i, file := range files {
 		if contains(ignoredFiles, file.Name()) {
 			continue
 		}
@@ -49,69 +54,144 @@ func CSVPreProcess(csvDir string, contentDir string, slugFields, ignoredFiles []
 		if !strings.HasSuffix(file.Name(), ".csv") {
 			continue
 		}
+		if opts.Only != nil && !opts.Only[file.Name()] {
+			continue
+		}
 
 		csvFilePath := filepath.Join(csvDir, file.Name())
-		csvFile, err := os.Open(csvFilePath)
-		if err != nil {
-			return fmt.Errorf("error opening CSV file %s: %v", csvFilePath, err)
-		}
-		defer csvFile.Close()
+		p.Go(i, func(ctx context.Context) error {
+			return csvPreProcessFile(ctx, csvFilePath, contentDir, slugFields, opts)
+		})
+	}
+
+	return p.Wait()
+}
+
+// csvPreProcessFile streams a single CSV file row by row into content files,
+// so memory use does not grow with the number of rows.
+func csvPreProcessFile(ctx context.Context, csvFilePath string, contentDir string, slugFields []string, opts Options) error {
+	csvFile, err := os.Open(csvFilePath)
+	if err != nil {
+		return fmt.Errorf("error opening CSV file %s: %v", csvFilePath, err)
+	}
+	defer csvFile.Close()
+
+	// Count line endings to restore them in post-process
+	endings := &lineEndings{r: csvFile}
+	reader := csv.NewReader(endings)
+	reader.ReuseRecord = true
+
+	headerRecord, err := reader.Read()
+	if err == io.EOF {
+		return nil // Empty CSV
+	}
+	if err != nil {
+		return fmt.Errorf("error reading CSV file %s: %v", csvFilePath, err)
+	}
 
-		reader := csv.NewReader(csvFile)
-		records, err := reader.ReadAll()
+	// Copy the headers, the reader reuses the record slice for the next row
+	originalHeaders := append([]string(nil), headerRecord...)
+	headers := fieldNames(originalHeaders, opts.Reserved)
+
+	csvName := strings.TrimSuffix(filepath.Base(csvFilePath), ".csv")
+
+	csvContentDir := filepath.Join(contentDir, csvName)
+	out := opts.output()
+
+	// Process each row and create a YAML file
+	p := newPool(ctx, opts.Jobs)
+	rows := 0
+	for row := 1; !p.Done(); row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
+			p.Wait()
 			return fmt.Errorf("error reading CSV file %s: %v", csvFilePath, err)
 		}
+		rows = row
 
-		if len(records) < 1 {
-			continue // Empty CSV
+		// Slug fields are named by their header
+		data := make(map[string]interface{}, len(headers))
+		for j, value := range record {
+			if j < len(headers) {
+				data[originalHeaders[j]] = value
+			}
 		}
 
-		headers := records[0]
+		// Generate idField by concatenating specified fields
+		idField := generateIdentifierField(data, slugFields)
 
-		// Create content directory for CSV
-		csvContentDir := filepath.Join(contentDir, strings.TrimSuffix(file.Name(), ".csv"))
-		err = os.MkdirAll(csvContentDir, os.ModePerm)
-		if err != nil {
-			return fmt.Errorf("error creating content directory %s: %v", csvContentDir, err)
+		// Order the fields as in the config: the decapta ID, then the columns
+		content := make(OrderedMap, 0, len(headers)+1)
+		content = append(content, KVPair{Key: decaptaIDField, Value: idField})
+		for j, header := range headers {
+			if j < len(record) {
+				content = append(content, KVPair{Key: header, Value: record[j]})
+			}
 		}
 
-		// Store column order at the project level (one directory higher)
-		columnOrderFilePath := filepath.Join(contentDir, fmt.Sprintf(".%s.yaml", strings.TrimSuffix(file.Name(), ".csv")))
-		adjustedHeaders := make([]string, len(headers))
-		for i, header := range headers {
-			adjustedHeaders[i] = addPrefixIfReserved(header)
-		}
-		err = writeColumnOrder(adjustedHeaders, columnOrderFilePath)
-		if err != nil {
-			return fmt.Errorf("error writing column order to file %s: %v", columnOrderFilePath, err)
+		// Write YAML file (1.yaml, 2.yaml, etc.)
+		filename := filepath.Join(csvContentDir, fmt.Sprintf("%d.yaml", row))
+		p.Go(row, func(ctx context.Context) error {
+			return writeContentFile(out, filename, content)
+		})
+	}
+
+	if err := p.Wait(); err != nil {
+		return err
+	}
+
+	// Store column order and line endings at the project level (one directory higher)
+	layout := dataLayout{Columns: headers, Slug: slugFields}
+	for i, header := range originalHeaders {
+		if header != headers[i] {
+			layout.Headers = originalHeaders
+			break
 		}
+	}
+	if endings.CRLF() {
+		layout.LineEnding = "crlf"
+	}
+	if !endings.FinalNewline() {
+		layout.FinalNewline = boolPtr(false)
+	}
+	columnOrderFilePath := filepath.Join(contentDir, fmt.Sprintf(".%s.yaml", csvName))
+	if existing, err := readColumnOrder(columnOrderFilePath); err == nil {
+		layout.Preview = existing.Preview
+	}
+	err = writeColumnOrder(out, layout, columnOrderFilePath)
+	if err != nil {
+		return fmt.Errorf("error writing column order to file %s: %v", columnOrderFilePath, err)
+	}
 
-		// Process each row and create a YAML file
-		for i, record := range records[1:] {
-			data := make(map[string]interface{})
-			for j, value := range record {
-				if j < len(headers) {
-					prefixedHeader := addPrefixIfReserved(headers[j])
-					data[prefixedHeader] = value
-				}
-			}
+	return removeStaleRows(out, csvContentDir, rows)
+}
 
-			// Generate idField by concatenating specified fields
-			idField := generateIdentifierField(data, slugFields)
-			data[decaptaIDField] = idField
+// removeStaleRows removes content files in dir other than the 1.yaml to
+// rows.yaml just written, such as rows deleted from the CSV or entries created
+// in the CMS that have since been post-processed into the CSV.
+func removeStaleRows(out Output, dir string, rows int) error {
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading content directory %s: %v", dir, err)
+	}
 
-			// Write YAML file (1.yaml, 2.yaml, etc.)
-			filename := filepath.Join(csvContentDir, fmt.Sprintf("%d.yaml", i+1))
-			yamlData, err := yaml.Marshal(data)
-			if err != nil {
-				return fmt.Errorf("error marshaling YAML for row %d: %v", i+1, err)
-			}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".yaml") {
+			continue
+		}
+		if n := extractFileNumber(file.Name()); n >= 1 && n <= rows && file.Name() == fmt.Sprintf("%d.yaml", n) {
+			continue
+		}
 
-			err = os.WriteFile(filename, yamlData, 0644)
-			if err != nil {
-				return fmt.Errorf("error writing YAML file %s: %v", filename, err)
-			}
+		path := filepath.Join(dir, file.Name())
+		if err := out.Remove(path); err != nil {
+			return fmt.Errorf("error removing stale content file %s: %v", path, err)
 		}
 	}
 
@@ -128,130 +208,211 @@ func generateIdentifierField(data map[string]interface{}, fields []string) strin
 	return strings.Join(slugParts, "-")
 }
 
-func writeColumnOrder(headers []string, filepath string) error {
-	columnOrder := map[string][]string{
-		"columns": headers,
-	}
-	yamlData, err := yaml.Marshal(columnOrder)
-	if err != nil {
-		return err
-	}
-	return os.WriteFile(filepath, yamlData, 0644)
+// dataLayout records what post-process needs to restore a data file besides
+// the content: the column order, the line endings and the indentation.
+type dataLayout struct {
+	// Columns are the field names of the columns.
+	Columns []string `yaml:"columns"`
+	// Headers are the original headers, if any differs from its field name.
+	Headers []string `yaml:"headers,omitempty"`
+	// LineEnding is "crlf" for files with CRLF line endings.
+	LineEnding string `yaml:"line_ending,omitempty"`
+	// FinalNewline is false for files without a line ending after the last
+	// record.
+	FinalNewline *bool `yaml:"final_newline,omitempty"`
+	// Indent is the indentation of JSON files, two spaces if unset.
+	Indent string `yaml:"indent,omitempty"`
+	// Compact is true for JSON files written on a single line.
+	Compact bool `yaml:"compact,omitempty"`
+	// Kind is "map" for data files holding a single mapping.
+	Kind string `yaml:"kind,omitempty"`
+	// Extension is the file extension, if not the default of the format.
+	Extension string `yaml:"extension,omitempty"`
+	// Preview is the preview snapshot directory of a CSV file, refreshed by
+	// post-process.
+	Preview string `yaml:"preview,omitempty"`
+	// Slug are the columns the decapta ID of a CSV row is built from.
+	Slug []string `yaml:"slug,omitempty"`
+	// Nested are the keys of nested objects that differ from their field
+	// names.
+	Nested []nestedKey `yaml:"nested,omitempty"`
+}
+
+// nestedKey is a key of a nested object by the path of original keys to it,
+// and its field name.
+type nestedKey struct {
+	Path []string `yaml:"path,flow"`
+	Name string   `yaml:"name"`
 }
 
-func removePrefixIfReserved(fieldName string) string {
-	if strings.HasPrefix(fieldName, decaptaPrefix) && reservedFields()[strings.TrimPrefix(fieldName, decaptaPrefix)] {
-		return strings.TrimPrefix(fieldName, decaptaPrefix)
+func writeColumnOrder(out Output, layout dataLayout, filepath string) error {
+	yamlData, err := yaml.Marshal(layout)
+	if err != nil {
+		return err
 	}
-	return fieldName
+	return out.WriteFile(filepath, yamlData)
 }
 
-// CSVPostProcess reads the content files and recreates the CSV files.
-func CSVPostProcess(contentDir string, csvDir string) error {
+// CSVPostProcess reads the content files and recreates the CSV files, writing
+// up to opts.Jobs files concurrently. CSV files are only replaced once every
+// file has been written successfully.
+func CSVPostProcess(ctx context.Context, contentDir string, csvDir string, opts Options) error {
 	csvContentDirs, err := os.ReadDir(contentDir)
 	if err != nil {
 		return fmt.Errorf("error reading content directory: %v", err)
 	}
 
-	// Ensure the output directory exists
-	err = os.MkdirAll(csvDir, os.ModePerm)
-	if err != nil {
-		return fmt.Errorf("error creating CSV directory %s: %v", csvDir, err)
+	if err := opts.Normalize.Validate(); err != nil {
+		return err
 	}
 
-	for _, dir := range csvContentDirs {
+	out := opts.Output
+	var tx *Transaction
+	if out == nil {
+		tx, err = NewTransaction(csvDir)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		out = tx
+	}
+
+	var csvNames []string
+	p := newPool(ctx, opts.Jobs)
+	for i, dir := range csvContentDirs {
 		if !dir.IsDir() {
 			continue
 		}
+		if opts.Only != nil && !opts.Only[dir.Name()] {
+			continue
+		}
 
 		csvName := dir.Name()
-		csvContentDir := filepath.Join(contentDir, csvName)
-
-		files, err := os.ReadDir(csvContentDir)
-		if err != nil {
-			return fmt.Errorf("error reading CSV content directory %s: %v", csvContentDir, err)
-		}
+		csvNames = append(csvNames, csvName)
+		p.Go(i, func(ctx context.Context) error {
+			return csvPostProcessDir(ctx, contentDir, csvName, csvDir, out, opts.Normalize)
+		})
+	}
 
-		var records []map[string]interface{}
-		var headers []string
+	if err := p.Wait(); err != nil {
+		return err
+	}
 
-		// Read the column order from the project-level metadata file
-		columnOrderFilePath := filepath.Join(contentDir, fmt.Sprintf(".%s.yaml", csvName))
-		headers, err = readColumnOrder(columnOrderFilePath)
-		if err != nil {
-			return fmt.Errorf("error reading column order from file %s: %v", columnOrderFilePath, err)
+	if tx != nil {
+		if err := tx.Commit(); err != nil {
+			return err
 		}
+		out = DiskOutput{}
+	}
 
-		// Adjust headers to match the prefixed keys in content data
-		adjustedHeaders := make([]string, len(headers))
-		for i, header := range headers {
-			adjustedHeaders[i] = addPrefixIfReserved(header) // Use prefixed name for reading
+	// Refresh the preview snapshots from the written CSV files
+	for _, csvName := range csvNames {
+		layout, err := readColumnOrder(filepath.Join(contentDir, fmt.Sprintf(".%s.yaml", csvName)))
+		if err != nil || layout.Preview == "" {
+			continue
 		}
+		csvFilePath := filepath.Join(csvDir, fmt.Sprintf("%s.csv", csvName))
+		if err := writeCSVSnapshot(out, csvFilePath, layout.Preview, layout.Columns, layout.Slug); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		// Read YAML files, sort them by their numeric filename (1.yaml, 2.yaml, etc.)
-		sort.Slice(files, func(i, j int) bool {
-			num1 := extractFileNumber(files[i].Name())
-			num2 := extractFileNumber(files[j].Name())
-			return num1 < num2
-		})
+// csvPostProcessDir writes the CSV file for a single content directory,
+// streaming one content file at a time into the CSV writer. Cells are
+// normalized against the rows of the CSV file being replaced.
+func csvPostProcessDir(ctx context.Context, contentDir string, csvName string, csvDir string, out Output, normalize Normalize) error {
+	csvContentDir := filepath.Join(contentDir, csvName)
 
-		for _, file := range files {
-			if !strings.HasSuffix(file.Name(), ".yaml") || file.Name() == fmt.Sprintf(".%s.yaml", csvName) {
-				continue
-			}
+	files, err := os.ReadDir(csvContentDir)
+	if err != nil {
+		return fmt.Errorf("error reading CSV content directory %s: %v", csvContentDir, err)
+	}
 
-			filePath := filepath.Join(csvContentDir, file.Name())
-			yamlContent, err := os.ReadFile(filePath)
-			if err != nil {
-				return fmt.Errorf("error reading YAML file %s: %v", filePath, err)
-			}
+	// Read the column order from the project-level metadata file
+	columnOrderFilePath := filepath.Join(contentDir, fmt.Sprintf(".%s.yaml", csvName))
+	layout, err := readColumnOrder(columnOrderFilePath)
+	if err != nil {
+		return fmt.Errorf("error reading column order from file %s: %v", columnOrderFilePath, err)
+	}
+	headers := layout.Columns
 
-			var data map[string]interface{}
-			err = yaml.Unmarshal(yamlContent, &data)
-			if err != nil {
-				return fmt.Errorf("error unmarshaling YAML file %s: %v", filePath, err)
-			}
+	// Read YAML files, sort them by their numeric filename (1.yaml, 2.yaml, etc.)
+	sort.Slice(files, func(i, j int) bool {
+		num1 := extractFileNumber(files[i].Name())
+		num2 := extractFileNumber(files[j].Name())
+		return num1 < num2
+	})
+
+	// Write CSV file
+	csvFilePath := filepath.Join(csvDir, fmt.Sprintf("%s.csv", csvName))
+	originals := openOriginalRows(csvFilePath)
+	defer originals.Close()
+
+	csvFile, err := out.Create(csvFilePath)
+	if err != nil {
+		return fmt.Errorf("error creating CSV file %s: %v", csvFilePath, err)
+	}
+	defer csvFile.Close()
+
+	buffered := bufio.NewWriter(csvFile)
+	var w io.Writer = buffered
+	if layout.FinalNewline != nil && !*layout.FinalNewline {
+		w = &trimFinalNewline{w: buffered}
+	}
+	crlf := layout.LineEnding == "crlf"
+	writer := newRecordWriter(w, crlf)
 
-			records = append(records, data)
+	// Write the original headers of the field names
+	originalHeaders := layout.Headers
+	if len(originalHeaders) != len(headers) {
+		originalHeaders = make([]string, len(headers))
+		for i, header := range headers {
+			originalHeaders[i] = legacyHeader(header)
 		}
+	}
+	if err := writer.Write(originalHeaders); err != nil {
+		return fmt.Errorf("error writing CSV file %s: %v", csvFilePath, err)
+	}
 
-		// Write CSV file
-		csvFilePath := filepath.Join(csvDir, fmt.Sprintf("%s.csv", csvName))
-		csvFile, err := os.Create(csvFilePath)
+	// Write records
+	row := make([]string, len(headers))
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".yaml") || file.Name() == fmt.Sprintf(".%s.yaml", csvName) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		filePath := filepath.Join(csvContentDir, file.Name())
+		yamlContent, err := os.ReadFile(filePath)
 		if err != nil {
-			return fmt.Errorf("error creating CSV file %s: %v", csvFilePath, err)
+			return fmt.Errorf("error reading YAML file %s: %v", filePath, err)
 		}
-		defer csvFile.Close()
 
-		writer := csv.NewWriter(csvFile)
+		var record map[string]interface{}
+		err = yaml.Unmarshal(yamlContent, &record)
+		if err != nil {
+			return fmt.Errorf("error unmarshaling YAML file %s: %v", filePath, err)
+		}
 
-		// Write headers with prefixes removed
-		originalHeaders := make([]string, len(headers))
-		for i, header := range headers {
-			originalHeaders[i] = removePrefixIfReserved(header)
-		}
-		writer.Write(originalHeaders)
-
-		// Write records
-		for _, record := range records {
-			var row []string
-			for _, header := range headers {
-				prefixedHeader := addPrefixIfReserved(header) // Use prefixed name to fetch data from record
-				value := ""
-				if val, ok := record[prefixedHeader]; ok {
-					value = fmt.Sprintf("%v", val)
-				}
-				row = append(row, value)
-			}
-			writer.Write(row)
+		rowNumber := extractFileNumber(file.Name())
+		for i, name := range headers {
+			column := originalHeaders[i]
+			original, hasOriginal := originals.cell(rowNumber, column)
+			row[i] = normalize.apply(column, formatCell(record[name]), original, hasOriginal, crlf)
 		}
-		writer.Flush()
-		if err := writer.Error(); err != nil {
+		if err := writer.Write(row); err != nil {
 			return fmt.Errorf("error writing CSV file %s: %v", csvFilePath, err)
 		}
 	}
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("error writing CSV file %s: %v", csvFilePath, err)
+	}
 
-	return nil
+	return csvFile.Close()
 }
 
 func contains(slice []string, element string) bool {
@@ -263,19 +424,14 @@ func contains(slice []string, element string) bool {
 	return false
 }
 
-func readColumnOrder(filepath string) ([]string, error) {
-	var columnOrder struct {
-		Columns []string `yaml:"columns"`
-	}
+func readColumnOrder(filepath string) (dataLayout, error) {
+	var layout dataLayout
 	yamlContent, err := os.ReadFile(filepath)
 	if err != nil {
-		return nil, err
-	}
-	err = yaml.Unmarshal(yamlContent, &columnOrder)
-	if err != nil {
-		return nil, err
+		return layout, err
 	}
-	return columnOrder.Columns, nil
+	err = yaml.Unmarshal(yamlContent, &layout)
+	return layout, err
 }
 
 // extractFileNumber extracts the numeric ID from file name (e.g., "1.yaml" -> 1)
@@ -289,13 +445,15 @@ func extractFileNumber(filename string) int {
 }
 
 // CSVGenerateConfig generates the config.yml for CSV files.
-func CSVGenerateConfig(csvDir string, outputFile string, templateData, indexHTML []byte, contentDir string, ignoredFiles []string) error {
+func CSVGenerateConfig(csvDir string, outputFile string, templateData, indexHTML []byte, contentDir string, ignoredFiles []string, opts Options) error {
 	files, err := os.ReadDir(csvDir)
 	if err != nil {
 		return fmt.Errorf("error reading CSV directory: %v", err)
 	}
 
 	var collections []Collection
+	previews := make(map[string]preview)
+	adminDir := filepath.Dir(outputFile)
 
 	for _, file := range files {
 		if contains(ignoredFiles, file.Name()) {
@@ -306,23 +464,15 @@ func CSVGenerateConfig(csvDir string, outputFile string, templateData, indexHTML
 		}
 
 		csvFilePath := filepath.Join(csvDir, file.Name())
-		csvFile, err := os.Open(csvFilePath)
+		headers, sample, err := readCSVSample(csvFilePath, typeDetectionSampleSize)
 		if err != nil {
-			return fmt.Errorf("error opening CSV file %s: %v", csvFilePath, err)
+			return err
 		}
-		defer csvFile.Close()
 
-		reader := csv.NewReader(csvFile)
-		records, err := reader.ReadAll()
-		if err != nil {
-			return fmt.Errorf("error reading CSV file %s: %v", csvFilePath, err)
-		}
-
-		if len(records) < 1 {
+		if headers == nil {
 			continue // Empty CSV
 		}
 
-		headers := records[0]
 		csvName := strings.TrimSuffix(file.Name(), ".csv")
 		csvContentDir := filepath.Join(contentDir, csvName)
 
@@ -331,20 +481,21 @@ func CSVGenerateConfig(csvDir string, outputFile string, templateData, indexHTML
 
 		// add the decapta_id field
 		fields = append(fields, Field{
-			Label:    "Decapta ID",
-			Name:     decaptaIDField,
-			Widget:   "string",
-			Required: true,
+			Label:  "Decapta ID",
+			Name:   decaptaIDField,
+			Widget: "string",
 		})
 
+		names := fieldNames(headers, opts.Reserved)
 		for colIndex, header := range headers {
-			fieldType := detectFieldType(records[1:], colIndex)
+			fieldType := detectFieldType(sample, colIndex)
 
 			field := Field{
 				Label:    header,
-				Name:     addPrefixIfReserved(header),
+				Name:     names[colIndex],
 				Widget:   fieldType,
-				Required: false,
+				Required: boolPtr(false),
+				header:   header,
 			}
 
 			// If the field is detected as markdown, specify modes
@@ -355,8 +506,41 @@ func CSVGenerateConfig(csvDir string, outputFile string, templateData, indexHTML
 			fields = append(fields, field)
 		}
 
+		collectionName := fmt.Sprintf("csv_%s", csvName)
+		snapshot := path.Join(previewSnapshotDir, collectionName)
+		snapshotDir := filepath.Join(adminDir, filepath.FromSlash(snapshot))
+		layoutPath := filepath.Join(contentDir, fmt.Sprintf(".%s.yaml", csvName))
+		layout, layoutErr := readColumnOrder(layoutPath)
+		if opts.PreviewSnapshot {
+			if err := writeCSVSnapshot(opts.output(), csvFilePath, snapshotDir, names, layout.Slug); err != nil {
+				return err
+			}
+			// Snapshots were a single file before they were split into pages
+			legacySnapshot := snapshotDir + ".json"
+			if _, err := os.Stat(legacySnapshot); err == nil {
+				if err := opts.output().Remove(legacySnapshot); err != nil {
+					return fmt.Errorf("error removing preview snapshot %s: %v", legacySnapshot, err)
+				}
+			}
+			previews[collectionName] = preview{Type: "csv", Snapshot: snapshot, PageSize: previewPageSize}
+		} else {
+			if err := removeCSVSnapshot(opts.output(), snapshotDir); err != nil {
+				return err
+			}
+			previews[collectionName] = preview{Type: "csv"}
+			snapshotDir = ""
+		}
+
+		// Post-process refreshes the snapshot recorded in the layout
+		if layoutErr == nil && layout.Preview != snapshotDir {
+			layout.Preview = snapshotDir
+			if err := writeColumnOrder(opts.output(), layout, layoutPath); err != nil {
+				return fmt.Errorf("error writing column order to file %s: %v", layoutPath, err)
+			}
+		}
+
 		collection := Collection{
-			Name:      fmt.Sprintf("csv_%s", csvName),
+			Name:      collectionName,
 			Label:     fmt.Sprintf("CSV Data (%s)", csvName),
 			Slug:      "{{slug}}",
 			Folder:    csvContentDir,
@@ -364,16 +548,18 @@ func CSVGenerateConfig(csvDir string, outputFile string, templateData, indexHTML
 			Extension: "yaml",
 			Format:    "yaml",
 			Editor: Editor{
-				Preview: false,
+				Preview: boolPtr(true),
 			},
 			IdentifierField: decaptaIDField,
 			Fields:          fields,
 		}
+		// Derive the list view from the data columns, after the decapta ID field
+		opts.ListView.apply(&collection, fields[1:], sample)
 
 		collections = append(collections, collection)
 	}
 
-	err = writeCollections(collections, templateData, indexHTML, outputFile)
+	err = writeCollections(collections, previews, templateData, indexHTML, outputFile, opts)
 	if err != nil {
 		return fmt.Errorf("error writing config: %v", err)
 	}
@@ -381,6 +567,40 @@ func CSVGenerateConfig(csvDir string, outputFile string, templateData, indexHTML
 	return nil
 }
 
+// readCSVSample reads the headers and at most limit rows of a CSV file, which
+// bounds memory use for type detection on large files. Headers are nil for an
+// empty file.
+func readCSVSample(csvFilePath string, limit int) ([]string, [][]string, error) {
+	csvFile, err := os.Open(csvFilePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error opening CSV file %s: %v", csvFilePath, err)
+	}
+	defer csvFile.Close()
+
+	reader := csv.NewReader(csvFile)
+	headers, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading CSV file %s: %v", csvFilePath, err)
+	}
+
+	var sample [][]string
+	for len(sample) < limit {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading CSV file %s: %v", csvFilePath, err)
+		}
+		sample = append(sample, record)
+	}
+
+	return headers, sample, nil
+}
+
 // detectFieldType analyzes a column and returns the appropriate FieldType based on sample data.
 func detectFieldType(records [][]string, colIndex int) string {
 	var isMultilineText bool
@@ -0,0 +1,79 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+const benchmarkRows = 20000
+
+// writeBenchmarkCSV generates a CSV file of benchmarkRows rows in dir.
+func writeBenchmarkCSV(b *testing.B, dir string) {
+	b.Helper()
+	f, err := os.Create(filepath.Join(dir, "items.csv"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	w := csv.NewWriter(f)
+	w.Write([]string{"id", "name", "price", "date", "description"})
+	for i := 0; i < benchmarkRows; i++ {
+		n := strconv.Itoa(i)
+		w.Write([]string{n, "item " + n, n + ".50", "2024-01-02", "line one\nline two of item " + n})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkCSVPreProcess(b *testing.B) {
+	csvDir := b.TempDir()
+	writeBenchmarkCSV(b, csvDir)
+	opts := Options{Jobs: 4}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		contentDir := filepath.Join(b.TempDir(), "content")
+		b.StartTimer()
+		if err := CSVPreProcess(context.Background(), csvDir, contentDir, []string{"id"}, nil, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCSVPostProcess(b *testing.B) {
+	csvDir := b.TempDir()
+	writeBenchmarkCSV(b, csvDir)
+	contentDir := filepath.Join(b.TempDir(), "content")
+	opts := Options{Jobs: 4}
+	if err := CSVPreProcess(context.Background(), csvDir, contentDir, []string{"id"}, nil, opts); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := CSVPostProcess(context.Background(), contentDir, csvDir, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
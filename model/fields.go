@@ -0,0 +1,88 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// unsafeFieldChars matches characters that break Decap field names, such as
+// dots, which address nested fields, and spaces, which break templates.
+var unsafeFieldChars = regexp.MustCompile(`[^\p{L}\p{N}_-]+`)
+
+// fieldNames maps CSV headers to field names. Unsafe characters are
+// replaced by underscores, reserved names and the decapta ID field are
+// prefixed with decapta_, and duplicates are numbered. The original headers
+// are recorded next to the content, so the mapping is reversed in
+// post-process.
+func fieldNames(headers []string, reserved []string) []string {
+	if reserved == nil {
+		reserved = DefaultReservedFields
+	}
+
+	taken := map[string]bool{decaptaIDField: true}
+	names := make([]string, len(headers))
+	for i, header := range headers {
+		name := strings.Trim(unsafeFieldChars.ReplaceAllString(header, "_"), "_")
+		if name == "" {
+			name = fmt.Sprintf("column_%d", i+1)
+		}
+		if name == decaptaIDField || isReserved(reserved, name) {
+			name = decaptaPrefix + name
+		}
+
+		unique := name
+		for n := 2; taken[unique]; n++ {
+			unique = fmt.Sprintf("%s_%d", name, n)
+		}
+		taken[unique] = true
+		names[i] = unique
+	}
+	return names
+}
+
+// legacyHeader returns the header of a field name recorded before headers
+// were stored next to the content, when only data was reserved.
+func legacyHeader(name string) string {
+	if name == decaptaPrefix+"data" {
+		return "data"
+	}
+	return name
+}
+
+// isReserved reports whether name is reserved, ignoring case, as Decap CMS
+// treats Title like title.
+func isReserved(reserved []string, name string) bool {
+	for _, r := range reserved {
+		if strings.EqualFold(r, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// fieldHeaders adds the headers of generated fields named differently, by
+// the path of their field list and their name, so merges find the fields
+// of older configs, which were named by their header.
+func fieldHeaders(headers map[string]string, path string, fields []Field) {
+	for _, field := range fields {
+		if field.header != "" && field.header != field.Name {
+			headers[path+"\x00"+field.Name] = field.header
+		}
+		fieldHeaders(headers, fmt.Sprintf("%s[%s].fields", path, field.Name), field.Fields)
+	}
+}
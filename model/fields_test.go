@@ -0,0 +1,48 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFieldNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		headers  []string
+		reserved []string
+		want     []string
+	}{
+		{"safe", []string{"id", "first_name", "price-usd"}, nil, []string{"id", "first_name", "price-usd"}},
+		{"unsafe characters", []string{"first name", "price.usd", "price ($)", "a/b"}, nil, []string{"first_name", "price_usd", "price", "a_b"}},
+		{"letters and digits of any script", []string{"名前", "größe2"}, nil, []string{"名前", "größe2"}},
+		{"empty headers", []string{"", "name", " ", "..."}, nil, []string{"column_1", "name", "column_3", "column_4"}},
+		{"duplicates after sanitising", []string{"a b", "a.b", "a_b"}, nil, []string{"a_b", "a_b_2", "a_b_3"}},
+		{"reserved names", []string{"title", "body", "data", "name"}, nil, []string{"decapta_title", "decapta_body", "decapta_data", "name"}},
+		{"reserved names in any case", []string{"Title", "BODY"}, nil, []string{"decapta_Title", "decapta_BODY"}},
+		{"custom reserved names", []string{"title", "name"}, []string{"name"}, []string{"title", "decapta_name"}},
+		{"decapta ID field", []string{"slug", "Slug"}, []string{}, []string{"decapta_slug", "Slug"}},
+		{"prefixed name taken", []string{"decapta_title", "title"}, nil, []string{"decapta_title", "decapta_title_2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fieldNames(tt.headers, tt.reserved)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("fieldNames(%q) = %q, want %q", tt.headers, got, tt.want)
+			}
+		})
+	}
+}
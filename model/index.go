@@ -0,0 +1,82 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+)
+
+const (
+	defaultCMSVersion = "^3.0.0"
+	defaultCMSURL     = "https://unpkg.com"
+	defaultTitle      = "Content Manager"
+)
+
+// Index holds the variables of the index.html template.
+type Index struct {
+	// CMSVersion is the decap-cms version loaded from CMSURL.
+	CMSVersion string `yaml:"cms_version,omitempty"`
+	// CMSURL is the base URL of the CDN serving decap-cms.
+	CMSURL string `yaml:"cms_url,omitempty"`
+	// CMSScript is a self-hosted script path used instead of the CDN.
+	CMSScript string `yaml:"cms_script,omitempty"`
+
+	Title string `yaml:"title,omitempty"`
+
+	// Scripts are loaded after the CMS, e.g. custom widgets and previews.
+	Scripts []string `yaml:"scripts,omitempty"`
+	// PreviewStyles are registered with CMS.registerPreviewStyle.
+	PreviewStyles []string `yaml:"preview_styles,omitempty"`
+
+	// Preserve keeps an existing index.html instead of rendering it.
+	Preserve bool `yaml:"preserve,omitempty"`
+}
+
+// Script returns the URL of the CMS script.
+func (i Index) Script() string {
+	if i.CMSScript != "" {
+		return i.CMSScript
+	}
+	return fmt.Sprintf("%s/decap-cms@%s/dist/decap-cms.js", strings.TrimSuffix(i.CMSURL, "/"), i.CMSVersion)
+}
+
+// RenderIndex executes an index.html template with the variables of index,
+// applying defaults for unset values. Values are escaped for the context of
+// the HTML they are written into.
+func RenderIndex(tmpl []byte, index Index) ([]byte, error) {
+	if index.CMSVersion == "" {
+		index.CMSVersion = defaultCMSVersion
+	}
+	if index.CMSURL == "" {
+		index.CMSURL = defaultCMSURL
+	}
+	if index.Title == "" {
+		index.Title = defaultTitle
+	}
+
+	t, err := template.New("index.html").Parse(string(tmpl))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing index.html template: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, index); err != nil {
+		return nil, fmt.Errorf("error rendering index.html template: %v", err)
+	}
+	return buf.Bytes(), nil
+}
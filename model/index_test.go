@@ -0,0 +1,49 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRenderIndexEscapes(t *testing.T) {
+	tmpl, err := os.ReadFile("../template/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	html, err := RenderIndex(tmpl, Index{
+		Title:         "Docs </title><script>alert(1)</script>",
+		Scripts:       []string{"javascript:alert(1)", "widgets.js?a=1&b=2"},
+		PreviewStyles: []string{`style.css");alert(1);("`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := string(html)
+	for _, want := range []string{
+		"<title>Docs &lt;/title&gt;&lt;script&gt;alert(1)&lt;/script&gt;</title>",
+		`<script src="#ZgotmplZ"></script>`,
+		`<script src="widgets.js?a=1&amp;b=2"></script>`,
+		`CMS.registerPreviewStyle("style.css\");alert(1);(\"");`,
+		`<script src="https://unpkg.com/decap-cms@%5e3.0.0/dist/decap-cms.js"></script>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("index.html does not contain %s:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// defaultJSONIndent is the indentation of JSON files that have none to follow.
+const defaultJSONIndent = "  "
+
+// jsonFormat reads JSON files holding an array of objects.
+var jsonFormat = recordFormat{
+	Name:       "json",
+	Label:      "JSON",
+	Extensions: []string{".json"},
+	Decode:     decodeJSONRecords,
+	Encode:     encodeJSONRecords,
+}
+
+// JSONPreProcess reads JSON files and creates a file per array element for
+// Decap CMS.
+func JSONPreProcess(ctx context.Context, jsonDir string, contentDir string, slugFields, ignoredFiles []string, opts Options) error {
+	return recordsPreProcess(ctx, jsonFormat, jsonDir, contentDir, slugFields, ignoredFiles, opts)
+}
+
+// JSONPostProcess reads the content files and recreates the JSON files.
+func JSONPostProcess(ctx context.Context, contentDir string, jsonDir string, opts Options) error {
+	return recordsPostProcess(ctx, jsonFormat, contentDir, jsonDir, opts)
+}
+
+// JSONGenerateConfig generates the config.yml for JSON files.
+func JSONGenerateConfig(jsonDir string, outputFile string, templateData, indexHTML []byte, contentDir string, ignoredFiles []string, opts Options) error {
+	return recordsGenerateConfig(jsonFormat, jsonDir, outputFile, templateData, indexHTML, contentDir, ignoredFiles, opts)
+}
+
+func decodeJSONRecords(data []byte) ([]OrderedMap, dataLayout, error) {
+	var layout dataLayout
+	value, err := decodeOrderedJSON(data)
+	if err != nil {
+		return nil, layout, err
+	}
+	array, ok := value.([]interface{})
+	if !ok {
+		return nil, layout, fmt.Errorf("expected an array of objects")
+	}
+	records := make([]OrderedMap, len(array))
+	for i, element := range array {
+		record, ok := element.(OrderedMap)
+		if !ok {
+			return nil, layout, fmt.Errorf("element %d is not an object", i+1)
+		}
+		records[i] = record
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case len(records) > 0 && !bytes.Contains(trimmed, []byte("\n")):
+		layout.Compact = true
+	case jsonIndent(trimmed) != defaultJSONIndent:
+		layout.Indent = jsonIndent(trimmed)
+	}
+	if bytes.Contains(data, []byte("\r\n")) {
+		layout.LineEnding = "crlf"
+	}
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		layout.FinalNewline = boolPtr(false)
+	}
+	return records, layout, nil
+}
+
+// jsonIndent returns the indentation of the second line, the first element of
+// the top-level array.
+func jsonIndent(data []byte) string {
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		return defaultJSONIndent
+	}
+	line := data[i+1:]
+	indent := line[:len(line)-len(bytes.TrimLeft(line, " \t"))]
+	if len(indent) == 0 {
+		return defaultJSONIndent
+	}
+	return string(indent)
+}
+
+func encodeJSONRecords(records []OrderedMap, layout dataLayout, original []byte) ([]byte, error) {
+	indent := layout.Indent
+	if indent == "" {
+		indent = defaultJSONIndent
+	}
+	if layout.Compact {
+		indent = ""
+	}
+	data, err := marshalJSON(recordArray(records), indent)
+	if err != nil {
+		return nil, err
+	}
+
+	return restoreLineEndings(data, layout), nil
+}
+
+// restoreLineEndings applies the line endings and final newline recorded in
+// layout to data written with LF line endings.
+func restoreLineEndings(data []byte, layout dataLayout) []byte {
+	if layout.FinalNewline != nil && !*layout.FinalNewline {
+		data = bytes.TrimSuffix(data, []byte("\n"))
+	}
+	if layout.LineEnding == "crlf" {
+		data = bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+	}
+	return data
+}
+
+// marshalJSON encodes a value with a trailing newline, without escaping HTML
+// characters, indented unless indent is empty.
+func marshalJSON(value interface{}, indent string) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if indent != "" {
+		enc.SetIndent("", indent)
+	}
+	if err := enc.Encode(value); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
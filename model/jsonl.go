@@ -0,0 +1,91 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+)
+
+// jsonlFormat reads JSON Lines files, with a JSON object per line.
+var jsonlFormat = recordFormat{
+	Name:       "jsonl",
+	Label:      "JSON Lines",
+	Extensions: []string{".jsonl"},
+	Decode:     decodeJSONLRecords,
+	Encode:     encodeJSONLRecords,
+}
+
+// JSONLPreProcess reads JSON Lines files and creates a file per line for
+// Decap CMS.
+func JSONLPreProcess(ctx context.Context, jsonlDir string, contentDir string, slugFields, ignoredFiles []string, opts Options) error {
+	return recordsPreProcess(ctx, jsonlFormat, jsonlDir, contentDir, slugFields, ignoredFiles, opts)
+}
+
+// JSONLPostProcess reads the content files and recreates the JSON Lines files.
+func JSONLPostProcess(ctx context.Context, contentDir string, jsonlDir string, opts Options) error {
+	return recordsPostProcess(ctx, jsonlFormat, contentDir, jsonlDir, opts)
+}
+
+// JSONLGenerateConfig generates the config.yml for JSON Lines files.
+func JSONLGenerateConfig(jsonlDir string, outputFile string, templateData, indexHTML []byte, contentDir string, ignoredFiles []string, opts Options) error {
+	return recordsGenerateConfig(jsonlFormat, jsonlDir, outputFile, templateData, indexHTML, contentDir, ignoredFiles, opts)
+}
+
+// decodeJSONLRecords decodes a record per line. Blank lines are skipped.
+func decodeJSONLRecords(data []byte) ([]OrderedMap, dataLayout, error) {
+	var layout dataLayout
+	var records []OrderedMap
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		value, err := decodeOrderedJSON(line)
+		if err != nil {
+			return nil, layout, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		record, ok := value.(OrderedMap)
+		if !ok {
+			return nil, layout, fmt.Errorf("line %d: expected an object", i+1)
+		}
+		records = append(records, record)
+	}
+
+	if bytes.Contains(data, []byte("\r\n")) {
+		layout.LineEnding = "crlf"
+	}
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		layout.FinalNewline = boolPtr(false)
+	}
+	return records, layout, nil
+}
+
+// encodeJSONLRecords writes each record as a compact JSON object on its own
+// line.
+func encodeJSONLRecords(records []OrderedMap, layout dataLayout, original []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, record := range records {
+		line, err := marshalJSON(record, "")
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(line)
+	}
+
+	data := buf.Bytes()
+	return restoreLineEndings(data, layout), nil
+}
@@ -0,0 +1,193 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	defaultMaxGroupValues = 10
+	// summaryKeyColumns is the number of identifying columns in a summary.
+	summaryKeyColumns = 2
+	// maxKeyColumnLength excludes long text columns from the summary.
+	maxKeyColumnLength = 80
+)
+
+// ListView configures the summary, sortable fields, view filters and view
+// groups generated for CSV collections. Columns are detected from the
+// sampled rows unless given explicitly.
+type ListView struct {
+	Disabled bool
+
+	// Summary overrides the generated summary template.
+	Summary string
+	// SortableFields overrides the numeric and date columns.
+	SortableFields []string
+	// GroupFields overrides the select-like columns used for view filters
+	// and view groups.
+	GroupFields []string
+	// MaxGroupValues is the largest number of distinct values of a
+	// select-like column, 10 if unset.
+	MaxGroupValues int
+}
+
+// apply sets the list view options of a CSV collection from its columns, as
+// named by fields, and the sampled rows.
+func (l ListView) apply(collection *Collection, fields []Field, sample [][]string) {
+	if l.Disabled {
+		return
+	}
+	maxValues := l.MaxGroupValues
+	if maxValues <= 0 {
+		maxValues = defaultMaxGroupValues
+	}
+
+	var keyColumns, sortable, groups []int
+	for col, field := range fields {
+		values := columnValues(sample, col)
+		switch field.Widget {
+		case "number", "datetime":
+			sortable = append(sortable, col)
+		}
+		if isKeyColumn(field, values) {
+			keyColumns = append(keyColumns, col)
+		}
+		if isGroupColumn(field, values, maxValues) {
+			groups = append(groups, col)
+		}
+	}
+
+	if l.SortableFields != nil {
+		sortable = selectColumns(fields, l.SortableFields)
+	}
+	if l.GroupFields != nil {
+		groups = selectColumns(fields, l.GroupFields)
+	}
+
+	switch {
+	case l.Summary != "":
+		collection.Summary = l.Summary
+	case len(keyColumns) > 0:
+		if len(keyColumns) > summaryKeyColumns {
+			keyColumns = keyColumns[:summaryKeyColumns]
+		}
+		var parts []string
+		for _, col := range keyColumns {
+			parts = append(parts, fmt.Sprintf("{{%s}}", fields[col].Name))
+		}
+		collection.Summary = strings.Join(parts, " - ")
+	}
+
+	if len(sortable) > 0 {
+		sortableFields := &SortableFields{}
+		for _, col := range sortable {
+			sortableFields.Fields = append(sortableFields.Fields, fields[col].Name)
+		}
+		collection.SortableFields = sortableFields
+	}
+
+	if len(groups) > 0 {
+		filters := &ViewFilters{}
+		viewGroups := &ViewGroups{}
+		for _, col := range groups {
+			field := fields[col]
+			for _, value := range distinctValues(columnValues(sample, col)) {
+				filters.Filters = append(filters.Filters, View{
+					Name:    fmt.Sprintf("%s_%s", field.Name, value),
+					Label:   fmt.Sprintf("%s: %s", field.Label, value),
+					Field:   field.Name,
+					Pattern: "^" + regexp.QuoteMeta(value) + "$",
+				})
+			}
+			viewGroups.Groups = append(viewGroups.Groups, View{
+				Name:  field.Name,
+				Label: field.Label,
+				Field: field.Name,
+			})
+		}
+		collection.ViewFilters = filters
+		collection.ViewGroups = viewGroups
+	}
+}
+
+// isKeyColumn reports whether a column identifies its rows: short,
+// single-line values that are present and unique in every sampled row.
+func isKeyColumn(field Field, values []string) bool {
+	if field.Widget != "string" && field.Widget != "number" {
+		return false
+	}
+	if len(values) == 0 {
+		return false
+	}
+	seen := make(map[string]bool, len(values))
+	for _, value := range values {
+		if value == "" || len(value) > maxKeyColumnLength || seen[value] {
+			return false
+		}
+		seen[value] = true
+	}
+	return true
+}
+
+// isGroupColumn reports whether a column takes a few repeated values, like a
+// status or category.
+func isGroupColumn(field Field, values []string, maxValues int) bool {
+	if field.Widget != "string" && field.Widget != "boolean" {
+		return false
+	}
+	distinct := distinctValues(values)
+	return len(distinct) >= 2 && len(distinct) <= maxValues && len(values) >= 2*len(distinct)
+}
+
+func columnValues(sample [][]string, col int) []string {
+	values := make([]string, 0, len(sample))
+	for _, record := range sample {
+		if col < len(record) {
+			values = append(values, record[col])
+		}
+	}
+	return values
+}
+
+// distinctValues returns the sorted non-empty values.
+func distinctValues(values []string) []string {
+	seen := make(map[string]bool)
+	var distinct []string
+	for _, value := range values {
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		distinct = append(distinct, value)
+	}
+	sort.Strings(distinct)
+	return distinct
+}
+
+// selectColumns returns the columns whose field name or label, the CSV
+// header, is listed.
+func selectColumns(fields []Field, names []string) []int {
+	var cols []int
+	for col, field := range fields {
+		if contains(names, field.Name) || contains(names, field.Label) {
+			cols = append(cols, col)
+		}
+	}
+	return cols
+}
@@ -0,0 +1,371 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// managedFile returns the sidecar of a config file that records the values
+// generated by the last config run, per collectionKey. A config value
+// still equal to its recorded value has not been edited by hand and is
+// owned by decapta.
+func managedFile(outputFile string) string {
+	return filepath.Join(filepath.Dir(outputFile), ".decapta-"+filepath.Base(outputFile))
+}
+
+// readManaged reads the sidecar as a mapping from collection key to the
+// last generated collection, empty if there is none.
+func readManaged(out Output, path string) (*yaml.Node, error) {
+	data, err := out.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &yaml.Node{Kind: yaml.MappingNode}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", path, err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", path, err)
+	}
+	if len(root.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode}, nil
+	}
+	if root.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("error parsing %s: not a mapping", path)
+	}
+
+	// The header is written again by writeManaged
+	managed := root.Content[0]
+	managed.HeadComment = ""
+	if len(managed.Content) > 0 {
+		managed.Content[0].HeadComment = ""
+	}
+	return managed, nil
+}
+
+func writeManaged(out Output, path string, managed *yaml.Node) error {
+	managed.HeadComment = "Generated by decapta: the config values of the last run, used to tell\ngenerated values from manual edits. Do not edit."
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(managed); err != nil {
+		return fmt.Errorf("error generating %s: %v", path, err)
+	}
+	if err := out.WriteFile(path, buf.Bytes()); err != nil {
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+	return nil
+}
+
+// setManaged records the generated node of a collection.
+func setManaged(managed *yaml.Node, name string, generated *yaml.Node) {
+	for i := 0; i < len(managed.Content); i += 2 {
+		if managed.Content[i].Value == name {
+			managed.Content[i+1] = generated
+			return
+		}
+	}
+	managed.Content = append(managed.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: name}, generated)
+}
+
+// merger merges generated config values into the existing config. With the
+// last generated value known, untouched values are updated or removed and
+// edited ones kept; without it, only missing values are added and existing
+// values that differ are kept as customisations and reported.
+type merger struct {
+	// headers are the headers of generated fields, see fieldHeaders.
+	headers   map[string]string
+	conflicts []string
+}
+
+func (m *merger) mergeMapping(path string, existing, generated, last *yaml.Node) {
+	if last != nil && last.Kind != yaml.MappingNode {
+		last = nil
+	}
+
+	for i := 0; i < len(generated.Content); i += 2 {
+		keyNode, value := generated.Content[i], generated.Content[i+1]
+		key := keyNode.Value
+		keyPath := path + "." + key
+		e := findFieldInNode(existing, key)
+		l := lookup(last, key)
+
+		switch {
+		case e == nil:
+			// A value recorded but missing was removed by hand
+			if l == nil {
+				existing.Content = append(existing.Content, keyNode, value)
+			}
+		case e.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode:
+			m.mergeMapping(keyPath, e, value, l)
+		case isNamedList(e) && isNamedList(value):
+			m.mergeNamedList(keyPath, e, value, l)
+		default:
+			m.mergeValue(keyPath, e, value, l)
+		}
+	}
+
+	// Remove untouched values that are no longer generated
+	if last == nil {
+		return
+	}
+	for i := 0; i < len(last.Content); i += 2 {
+		key := last.Content[i].Value
+		if findFieldInNode(generated, key) != nil {
+			continue
+		}
+		if e := findFieldInNode(existing, key); e != nil && nodesEqual(e, last.Content[i+1]) {
+			removeKey(existing, key)
+		}
+	}
+}
+
+// mergeNamedList merges lists of named items, such as fields and files, by
+// item name.
+func (m *merger) mergeNamedList(path string, existing, generated, last *yaml.Node) {
+	if last != nil && !isNamedList(last) {
+		last = nil
+	}
+
+	for _, item := range generated.Content {
+		name := nameOf(item)
+		itemPath := fmt.Sprintf("%s[%s]", path, name)
+		e := findByName(existing, name)
+		l := findByName(last, name)
+		if e == nil {
+			e, l = m.migrateItem(path, existing, generated, last, name)
+		}
+		if e == nil {
+			if l == nil {
+				existing.Content = append(existing.Content, item)
+			}
+			continue
+		}
+		m.mergeMapping(itemPath, e, item, l)
+	}
+
+	// Follow the generated order, such as the key order of the source file,
+	// unless the items were reordered by hand
+	if last == nil || sameOrder(existing, last) {
+		reorderByName(existing, generated)
+	}
+
+	if last == nil {
+		return
+	}
+	for _, item := range last.Content {
+		name := nameOf(item)
+		if findByName(generated, name) != nil {
+			continue
+		}
+		if e := findByName(existing, name); e != nil && nodesEqual(e, item) {
+			removeItem(existing, e)
+		}
+	}
+}
+
+// migrateItem renames the field of an older config named by its header, such
+// as first name becoming first_name or title becoming decapta_title, so its
+// settings are kept instead of a duplicate being added. It returns the
+// renamed item and its last generated value, or nil.
+func (m *merger) migrateItem(path string, existing, generated, last *yaml.Node, name string) (*yaml.Node, *yaml.Node) {
+	header, ok := m.headers[path+"\x00"+name]
+	if !ok || findByName(generated, header) != nil {
+		return nil, nil
+	}
+	e := findByName(existing, header)
+	if e == nil {
+		return nil, nil
+	}
+	findFieldInNode(e, "name").Value = name
+	l := findByName(last, header)
+	if l != nil {
+		// The recorded item is compared under its new name
+		var renamed yaml.Node
+		if err := renamed.Encode(l); err == nil {
+			findFieldInNode(&renamed, "name").Value = name
+			l = &renamed
+		}
+	}
+	return e, l
+}
+
+// sameOrder reports whether the items of both lists that have a name in
+// common are in the same order.
+func sameOrder(a, b *yaml.Node) bool {
+	var namesA, namesB []string
+	for _, item := range a.Content {
+		if findByName(b, nameOf(item)) != nil {
+			namesA = append(namesA, nameOf(item))
+		}
+	}
+	for _, item := range b.Content {
+		if findByName(a, nameOf(item)) != nil {
+			namesB = append(namesB, nameOf(item))
+		}
+	}
+	return reflect.DeepEqual(namesA, namesB)
+}
+
+// reorderByName sorts the items of list that are generated into the order of
+// generated. Other items keep their position.
+func reorderByName(list, generated *yaml.Node) {
+	var slots []int
+	var items []*yaml.Node
+	for i, item := range list.Content {
+		if findByName(generated, nameOf(item)) != nil {
+			slots = append(slots, i)
+		}
+	}
+	for _, item := range generated.Content {
+		if e := findByName(list, nameOf(item)); e != nil {
+			items = append(items, e)
+		}
+	}
+	if len(slots) != len(items) {
+		return // Duplicate names
+	}
+	for i, slot := range slots {
+		list.Content[slot] = items[i]
+	}
+}
+
+func (m *merger) mergeValue(path string, existing, generated, last *yaml.Node) {
+	switch {
+	case nodesEqual(existing, generated):
+	case last == nil:
+		// Not recorded, such as in configs made before the sidecar, so the
+		// existing value is a customisation
+		m.conflicts = append(m.conflicts, fmt.Sprintf("%s differs from the generated value, keeping %s over generated %s",
+			path, describeNode(existing), describeNode(generated)))
+	case nodesEqual(existing, last):
+		replaceNode(existing, generated)
+	case !nodesEqual(generated, last):
+		m.conflicts = append(m.conflicts, fmt.Sprintf("%s was edited, keeping %s over generated %s",
+			path, describeNode(existing), describeNode(generated)))
+	}
+}
+
+func lookup(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping == nil {
+		return nil
+	}
+	return findFieldInNode(mapping, key)
+}
+
+func isNamedList(node *yaml.Node) bool {
+	if node.Kind != yaml.SequenceNode {
+		return false
+	}
+	for _, item := range node.Content {
+		if item.Kind != yaml.MappingNode || findFieldInNode(item, "name") == nil {
+			return false
+		}
+	}
+	return true
+}
+
+func nameOf(item *yaml.Node) string {
+	if name := findFieldInNode(item, "name"); name != nil {
+		return name.Value
+	}
+	return ""
+}
+
+func findByName(list *yaml.Node, name string) *yaml.Node {
+	if list == nil {
+		return nil
+	}
+	for _, item := range list.Content {
+		if item.Kind == yaml.MappingNode && nameOf(item) == name {
+			return item
+		}
+	}
+	return nil
+}
+
+func removeKey(mapping *yaml.Node, key string) {
+	for i := 0; i < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return
+		}
+	}
+}
+
+func removeItem(list *yaml.Node, item *yaml.Node) {
+	for i, n := range list.Content {
+		if n == item {
+			list.Content = append(list.Content[:i], list.Content[i+1:]...)
+			return
+		}
+	}
+}
+
+// replaceNode replaces the value of dst with src, keeping the comments of dst.
+func replaceNode(dst, src *yaml.Node) {
+	head, line, foot := dst.HeadComment, dst.LineComment, dst.FootComment
+	*dst = *src
+	dst.HeadComment, dst.LineComment, dst.FootComment = head, line, foot
+}
+
+// nodesEqual compares the decoded values of two nodes, ignoring style and
+// comments.
+func nodesEqual(a, b *yaml.Node) bool {
+	var va, vb interface{}
+	if err := a.Decode(&va); err != nil {
+		return false
+	}
+	if err := b.Decode(&vb); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
+
+func describeNode(node *yaml.Node) string {
+	if node.Kind == yaml.ScalarNode {
+		return fmt.Sprintf("%q", node.Value)
+	}
+	data, err := yaml.Marshal(node)
+	if err != nil {
+		return "(unprintable)"
+	}
+	var flow yaml.Node
+	if err := yaml.Unmarshal(data, &flow); err == nil && len(flow.Content) > 0 {
+		setFlowStyle(flow.Content[0])
+		if data, err = yaml.Marshal(flow.Content[0]); err == nil {
+			return strings.TrimSpace(string(data))
+		}
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func setFlowStyle(node *yaml.Node) {
+	node.Style |= yaml.FlowStyle
+	for _, child := range node.Content {
+		setFlowStyle(child)
+	}
+}
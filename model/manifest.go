@@ -0,0 +1,243 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultManifestFile is the manifest file name looked up by default.
+const DefaultManifestFile = "decapta.yaml"
+
+// Manifest lists the projects managed from a single CMS configuration.
+// Relative paths are resolved against the directory of the manifest file.
+type Manifest struct {
+	Config        string    `yaml:"config,omitempty"`
+	Template      string    `yaml:"template,omitempty"`
+	IndexTemplate string    `yaml:"index_template,omitempty"`
+	Index         Index     `yaml:"index,omitempty"`
+	Projects      []Project `yaml:"projects"`
+}
+
+// Project is a data directory and its content directory processed with one
+// data type.
+type Project struct {
+	Name    string   `yaml:"name"`
+	Type    string   `yaml:"type"`
+	Data    string   `yaml:"data"`
+	Content string   `yaml:"content,omitempty"`
+	Slug    []string `yaml:"slug,omitempty"`
+	Ignore  []string `yaml:"ignore,omitempty"`
+	Schema  Schema   `yaml:"schema,omitempty"`
+	// Normalize sets the normalization rules of CSV cells in post-process.
+	Normalize Normalize `yaml:"normalize,omitempty"`
+	// Reserved replaces DefaultReservedFields, if set.
+	Reserved []string `yaml:"reserved,omitempty"`
+	// PreviewSnapshot publishes a snapshot of each CSV file for the preview.
+	PreviewSnapshot bool `yaml:"preview_snapshot,omitempty"`
+}
+
+// Schema overrides settings of the generated collections and their fields.
+// Keys use the option names of the Decap CMS configuration.
+type Schema struct {
+	Collection map[string]interface{}            `yaml:"collection,omitempty"`
+	Fields     map[string]map[string]interface{} `yaml:"fields,omitempty"`
+}
+
+// LoadManifest reads a manifest file, applies defaults and resolves all
+// paths relative to the manifest's directory.
+func LoadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading manifest %s: %v", path, err)
+	}
+
+	var manifest Manifest
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("error parsing manifest %s: %v", path, err)
+	}
+
+	baseDir := filepath.Dir(path)
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(baseDir, p)
+	}
+
+	if manifest.Config == "" {
+		manifest.Config = "admin/config.yml"
+	}
+	manifest.Config = resolve(manifest.Config)
+	manifest.Template = resolve(manifest.Template)
+	manifest.IndexTemplate = resolve(manifest.IndexTemplate)
+
+	seen := make(map[string]bool)
+	for i := range manifest.Projects {
+		project := &manifest.Projects[i]
+		if project.Name == "" {
+			return nil, fmt.Errorf("project %d in manifest %s has no name", i+1, path)
+		}
+		if seen[project.Name] {
+			return nil, fmt.Errorf("duplicate project %s in manifest %s", project.Name, path)
+		}
+		seen[project.Name] = true
+
+		if project.Type == "" {
+			return nil, fmt.Errorf("project %s in manifest %s has no type", project.Name, path)
+		}
+		if project.Data == "" {
+			return nil, fmt.Errorf("project %s in manifest %s has no data directory", project.Name, path)
+		}
+		if project.Content == "" {
+			project.Content = filepath.Join("content", project.Name)
+		}
+		project.Data = resolve(project.Data)
+		project.Content = resolve(project.Content)
+	}
+
+	return &manifest, nil
+}
+
+// Select returns the projects with the given names in manifest order, or all
+// projects if no names are given.
+func (m *Manifest) Select(names []string) ([]Project, error) {
+	if len(names) == 0 {
+		return m.Projects, nil
+	}
+
+	for _, name := range names {
+		if _, ok := m.Project(name); !ok {
+			return nil, fmt.Errorf("unknown project %s", name)
+		}
+	}
+
+	var projects []Project
+	for _, project := range m.Projects {
+		if contains(names, project.Name) {
+			projects = append(projects, project)
+		}
+	}
+	return projects, nil
+}
+
+// Project returns the project with the given name.
+func (m *Manifest) Project(name string) (Project, bool) {
+	for _, project := range m.Projects {
+		if project.Name == name {
+			return project, true
+		}
+	}
+	return Project{}, false
+}
+
+// Sync pre-processes the data of each project and upserts its collections
+// into the manifest's central config.
+func (m *Manifest) Sync(ctx context.Context, projects []Project, templateData, indexHTML []byte, opts Options) error {
+	opts.Index = m.Index
+	for _, project := range projects {
+		projectOpts := opts
+		projectOpts.Reserved = project.Reserved
+		err := PreProcess(ctx, project.Type, project.Data, project.Content, project.Slug, project.Ignore, projectOpts)
+		if err != nil {
+			return fmt.Errorf("project %s: pre-process: %w", project.Name, err)
+		}
+
+		projectOpts.Schema = project.Schema
+		projectOpts.PreviewSnapshot = project.PreviewSnapshot
+		err = GenerateConfig(project.Type, project.Data, m.Config, templateData, indexHTML, project.Content, project.Ignore, projectOpts)
+		if err != nil {
+			return fmt.Errorf("project %s: config: %w", project.Name, err)
+		}
+	}
+	return nil
+}
+
+// Build post-processes the content of each project back into its data directory.
+func (m *Manifest) Build(ctx context.Context, projects []Project, opts Options) error {
+	for _, project := range projects {
+		err := project.PostProcess(ctx, opts)
+		if err != nil {
+			return fmt.Errorf("project %s: post-process: %w", project.Name, err)
+		}
+	}
+	return nil
+}
+
+// PostProcess post-processes the content of the project into its data
+// directory, with the project's normalization rules.
+func (p Project) PostProcess(ctx context.Context, opts Options) error {
+	opts.Normalize = p.Normalize
+	return PostProcess(ctx, p.Type, p.Content, p.Data, opts)
+}
+
+// apply overlays the schema onto a generated collection. Fields are matched
+// by name, including the fields of file collections.
+func (s Schema) apply(collection *Collection) error {
+	if len(s.Collection) == 0 && len(s.Fields) == 0 {
+		return nil
+	}
+
+	data, err := yaml.Marshal(collection)
+	if err != nil {
+		return err
+	}
+	var node map[string]interface{}
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return err
+	}
+
+	for key, value := range s.Collection {
+		node[key] = value
+	}
+	s.applyFields(node["fields"])
+	if files, ok := node["files"].([]interface{}); ok {
+		for _, file := range files {
+			if fileNode, ok := file.(map[string]interface{}); ok {
+				s.applyFields(fileNode["fields"])
+			}
+		}
+	}
+
+	data, err = yaml.Marshal(node)
+	if err != nil {
+		return err
+	}
+	*collection = Collection{}
+	return yaml.Unmarshal(data, collection)
+}
+
+func (s Schema) applyFields(fields interface{}) {
+	list, ok := fields.([]interface{})
+	if !ok {
+		return
+	}
+	for _, field := range list {
+		fieldNode, ok := field.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := fieldNode["name"].(string)
+		for key, value := range s.Fields[name] {
+			fieldNode[key] = value
+		}
+		s.applyFields(fieldNode["fields"])
+	}
+}
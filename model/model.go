@@ -16,8 +16,9 @@ package model
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
-	"os"
+	"io/fs"
 	"path/filepath"
 
 	"gopkg.in/yaml.v3"
@@ -28,102 +29,461 @@ const (
 	decaptaPrefix  = "decapta_"
 )
 
-func reservedFields() map[string]bool {
-	return map[string]bool{
-		"data": true,
-	}
+// DefaultReservedFields are the field names that Decap CMS reserves or
+// treats specially. CSV columns with these names are prefixed with decapta_.
+var DefaultReservedFields = []string{"body", "data", "date", "path", "slug", "title"}
+
+// Options configures how the processing steps run.
+type Options struct {
+	// Jobs limits how many files, and how many rows within a file, are
+	// processed concurrently. Values below one process sequentially.
+	Jobs int
+
+	// Output receives all written files. Pre-process and config write to disk
+	// and post-process writes through a Transaction when it is nil.
+	Output Output
+
+	// Schema overrides generated collection and field settings in the config step.
+	Schema Schema
+
+	// Index holds the variables of the index.html written by the config step.
+	Index Index
+
+	// ListView configures the list view options of generated CSV collections.
+	ListView ListView
+
+	// PreviewSnapshot writes a JSON snapshot of each CSV file next to the
+	// config, for the preview to show the neighbouring rows of an entry. The
+	// snapshot is published with the admin UI.
+	PreviewSnapshot bool
+
+	// Normalize sets the normalization rules of CSV cells in post-process.
+	Normalize Normalize
+
+	// Reserved lists the field names that CSV columns are renamed from, by
+	// pre-process and config. DefaultReservedFields is used if it is nil.
+	Reserved []string
+
+	// Only restricts post-process to these top-level entries of the content
+	// directory, CSV content directories or ARB language files, when non-nil.
+	// Pre-process is restricted to the data files with these names.
+	Only map[string]bool
+
+	// OnlyChanged restricts post-process to the content entries changed since
+	// the recorded state, or since the git revision Since if it is set.
+	OnlyChanged bool
+	Since       string
+
+	// OnConflict is called by the config step for each generated value that
+	// is not written because it was edited by hand. Conflicts are ignored if
+	// it is nil.
+	OnConflict func(conflict string)
 }
 
+// Collection is a Decap CMS collection. Options without a typed field are
+// kept in Extra, so an existing config survives decoding and encoding.
 type Collection struct {
-	Name            string  `yaml:"name"`
-	Label           string  `yaml:"label"`
-	Folder          string  `yaml:"folder,omitempty"`
-	Create          bool    `yaml:"create,omitempty"`
-	Slug            string  `yaml:"slug,omitempty"`
-	IdentifierField string  `yaml:"identifier_field,omitempty"`
-	Format          string  `yaml:"format,omitempty"`
-	Extension       string  `yaml:"extension,omitempty"`
-	Editor          Editor  `yaml:"editor,omitempty"`
-	Files           []File  `yaml:"files,omitempty"`
-	Fields          []Field `yaml:"fields,omitempty"`
+	Name                 string          `yaml:"name"`
+	Label                string          `yaml:"label"`
+	LabelSingular        string          `yaml:"label_singular,omitempty"`
+	Description          string          `yaml:"description,omitempty"`
+	Icon                 string          `yaml:"icon,omitempty"`
+	Folder               string          `yaml:"folder,omitempty"`
+	Filter               *Filter         `yaml:"filter,omitempty"`
+	Create               bool            `yaml:"create,omitempty"`
+	Publish              *bool           `yaml:"publish,omitempty"`
+	Hide                 bool            `yaml:"hide,omitempty"`
+	Delete               *bool           `yaml:"delete,omitempty"`
+	Slug                 string          `yaml:"slug,omitempty"`
+	IdentifierField      string          `yaml:"identifier_field,omitempty"`
+	Format               string          `yaml:"format,omitempty"`
+	Extension            string          `yaml:"extension,omitempty"`
+	FrontmatterDelimiter interface{}     `yaml:"frontmatter_delimiter,omitempty"`
+	Path                 string          `yaml:"path,omitempty"`
+	MediaFolder          string          `yaml:"media_folder,omitempty"`
+	PublicFolder         string          `yaml:"public_folder,omitempty"`
+	PreviewPath          string          `yaml:"preview_path,omitempty"`
+	PreviewPathDateField string          `yaml:"preview_path_date_field,omitempty"`
+	Summary              string          `yaml:"summary,omitempty"`
+	SortableFields       *SortableFields `yaml:"sortable_fields,omitempty"`
+	ViewFilters          *ViewFilters    `yaml:"view_filters,omitempty"`
+	ViewGroups           *ViewGroups     `yaml:"view_groups,omitempty"`
+	Nested               *Nested         `yaml:"nested,omitempty"`
+	Meta                 *CollectionMeta `yaml:"meta,omitempty"`
+	I18n                 interface{}     `yaml:"i18n,omitempty"`
+	Editor               Editor          `yaml:"editor,omitempty"`
+	Files                []File          `yaml:"files,omitempty"`
+	Fields               []Field         `yaml:"fields,omitempty"`
+
+	Extra map[string]interface{} `yaml:",inline"`
 }
 
 type Editor struct {
-	Preview bool `yaml:"preview,omitempty"`
+	Preview *bool `yaml:"preview,omitempty"`
+
+	Extra map[string]interface{} `yaml:",inline"`
+}
+
+// Filter restricts a folder collection to entries with a field value.
+type Filter struct {
+	Field   string      `yaml:"field"`
+	Value   interface{} `yaml:"value,omitempty"`
+	Pattern string      `yaml:"pattern,omitempty"`
+}
+
+// SortableFields lists the fields the collection view can be sorted by. It
+// is written as a plain list unless a default sort is set.
+type SortableFields struct {
+	Default *SortDefault `yaml:"default,omitempty"`
+	Fields  []string     `yaml:"fields"`
+}
+
+type SortDefault struct {
+	Field     string `yaml:"field"`
+	Direction string `yaml:"direction,omitempty"`
+}
+
+// ViewFilters are the predefined filters of the collection view. They are
+// written as a plain list unless a default filter is set.
+type ViewFilters struct {
+	Default string `yaml:"default,omitempty"`
+	Filters []View `yaml:"filters"`
+}
+
+// ViewGroups are the predefined groupings of the collection view. They are
+// written as a plain list unless a default group is set.
+type ViewGroups struct {
+	Default string `yaml:"default,omitempty"`
+	Groups  []View `yaml:"groups"`
+}
+
+// View is a filter or group of the collection view. Filter patterns may be
+// a boolean or a regular expression, group patterns a regular expression.
+type View struct {
+	Name    string      `yaml:"name,omitempty"`
+	Label   string      `yaml:"label"`
+	Field   string      `yaml:"field"`
+	Pattern interface{} `yaml:"pattern,omitempty"`
+}
+
+// Nested shows a folder collection as a tree of subfolders.
+type Nested struct {
+	Depth      int    `yaml:"depth"`
+	Summary    string `yaml:"summary,omitempty"`
+	Subfolders *bool  `yaml:"subfolders,omitempty"`
+}
+
+type CollectionMeta struct {
+	Path *MetaPath `yaml:"path,omitempty"`
+}
+
+type MetaPath struct {
+	Widget    string `yaml:"widget"`
+	Label     string `yaml:"label"`
+	IndexFile string `yaml:"index_file"`
 }
 
 type File struct {
-	Name   string  `yaml:"name"`
-	Label  string  `yaml:"label"`
-	File   string  `yaml:"file"`
-	Fields []Field `yaml:"fields"`
+	Name         string  `yaml:"name"`
+	Label        string  `yaml:"label"`
+	File         string  `yaml:"file"`
+	Description  string  `yaml:"description,omitempty"`
+	PreviewPath  string  `yaml:"preview_path,omitempty"`
+	MediaFolder  string  `yaml:"media_folder,omitempty"`
+	PublicFolder string  `yaml:"public_folder,omitempty"`
+	Editor       Editor  `yaml:"editor,omitempty"`
+	Fields       []Field `yaml:"fields"`
+
+	Extra map[string]interface{} `yaml:",inline"`
 }
 
+// Field is a collection field with the options of all built-in widgets.
+// Options without a typed field are kept in Extra.
 type Field struct {
-	Label       string                 `yaml:"label"`
-	Name        string                 `yaml:"name"`
-	Widget      string                 `yaml:"widget"`
-	Modes       []string               `yaml:"modes,omitempty"`
-	Fields      []Field                `yaml:"fields,omitempty"`
-	Collapsed   bool                   `yaml:"collapsed,omitempty"`
-	Hint        string                 `yaml:"hint,omitempty"`
-	Placeholder string                 `yaml:"placeholder,omitempty"`
-	Required    bool                   `yaml:"required,omitempty"`
-	Default     interface{}            `yaml:"default,omitempty"`
-	Pattern     string                 `yaml:"pattern,omitempty"`
-	PatternMsg  string                 `yaml:"pattern_msg,omitempty"`
-	Meta        map[string]interface{} `yaml:"meta,omitempty"`
-}
-
-func writeCollections(collections []Collection, templateContent, indexHTML []byte, outputFile string) error {
+	Label       string      `yaml:"label"`
+	Name        string      `yaml:"name"`
+	Widget      string      `yaml:"widget"`
+	Hint        string      `yaml:"hint,omitempty"`
+	Placeholder string      `yaml:"placeholder,omitempty"`
+	Comment     string      `yaml:"comment,omitempty"`
+	Required    *bool       `yaml:"required,omitempty"`
+	Default     interface{} `yaml:"default,omitempty"`
+	// Pattern is a regular expression and its error message, which was
+	// PatternMsg before.
+	Pattern []string    `yaml:"pattern,omitempty"`
+	I18n    interface{} `yaml:"i18n,omitempty"`
+
+	// list and object
+	Fields            []Field `yaml:"fields,omitempty"`
+	Field             *Field  `yaml:"field,omitempty"`
+	Types             []Field `yaml:"types,omitempty"`
+	TypeKey           string  `yaml:"typeKey,omitempty"`
+	Collapsed         *bool   `yaml:"collapsed,omitempty"`
+	MinimizeCollapsed bool    `yaml:"minimize_collapsed,omitempty"`
+	Summary           string  `yaml:"summary,omitempty"`
+	LabelSingular     string  `yaml:"label_singular,omitempty"`
+	AllowAdd          *bool   `yaml:"allow_add,omitempty"`
+	AddToTop          bool    `yaml:"add_to_top,omitempty"`
+
+	// select and relation
+	Options       []SelectOption `yaml:"options,omitempty"`
+	Multiple      bool           `yaml:"multiple,omitempty"`
+	Collection    string         `yaml:"collection,omitempty"`
+	File          string         `yaml:"file,omitempty"`
+	ValueField    string         `yaml:"value_field,omitempty"`
+	SearchFields  []string       `yaml:"search_fields,omitempty"`
+	DisplayFields []string       `yaml:"display_fields,omitempty"`
+	OptionsLength int            `yaml:"options_length,omitempty"`
+
+	// number, list, select and relation bounds
+	ValueType string   `yaml:"value_type,omitempty"`
+	Min       *float64 `yaml:"min,omitempty"`
+	Max       *float64 `yaml:"max,omitempty"`
+	Step      *float64 `yaml:"step,omitempty"`
+
+	// datetime
+	Format     string      `yaml:"format,omitempty"`
+	DateFormat interface{} `yaml:"date_format,omitempty"`
+	TimeFormat interface{} `yaml:"time_format,omitempty"`
+	PickerUTC  bool        `yaml:"picker_utc,omitempty"`
+
+	// markdown
+	Modes            []string `yaml:"modes,omitempty"`
+	Buttons          []string `yaml:"buttons,omitempty"`
+	EditorComponents []string `yaml:"editor_components,omitempty"`
+	Minimal          bool     `yaml:"minimal,omitempty"`
+	SanitizePreview  bool     `yaml:"sanitize_preview,omitempty"`
+
+	// file and image
+	AllowMultiple *bool                  `yaml:"allow_multiple,omitempty"`
+	ChooseURL     *bool                  `yaml:"choose_url,omitempty"`
+	MediaFolder   string                 `yaml:"media_folder,omitempty"`
+	PublicFolder  string                 `yaml:"public_folder,omitempty"`
+	MediaLibrary  map[string]interface{} `yaml:"media_library,omitempty"`
+
+	// code
+	DefaultLanguage        string            `yaml:"default_language,omitempty"`
+	AllowLanguageSelection bool              `yaml:"allow_language_selection,omitempty"`
+	Keys                   map[string]string `yaml:"keys,omitempty"`
+	OutputCodeOnly         bool              `yaml:"output_code_only,omitempty"`
+
+	// color
+	AllowInput  bool `yaml:"allowInput,omitempty"`
+	EnableAlpha bool `yaml:"enableAlpha,omitempty"`
+
+	// map
+	Decimals *int   `yaml:"decimals,omitempty"`
+	Type     string `yaml:"type,omitempty"`
+
+	// uuid
+	Prefix         string `yaml:"prefix,omitempty"`
+	UseB32Encoding bool   `yaml:"use_b32_encoding,omitempty"`
+	ReadOnly       *bool  `yaml:"read_only,omitempty"`
+
+	Meta  map[string]interface{} `yaml:"meta,omitempty"`
+	Extra map[string]interface{} `yaml:",inline"`
+
+	// header is the column or key a generated field is named after.
+	header string
+}
+
+// SelectOption is an option of a select widget, written as a plain value
+// unless it has a label.
+type SelectOption struct {
+	Label string      `yaml:"label,omitempty"`
+	Value interface{} `yaml:"value"`
+}
+
+func (s *SortableFields) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.SequenceNode {
+		return node.Decode(&s.Fields)
+	}
+	type plain SortableFields
+	return node.Decode((*plain)(s))
+}
+
+func (s SortableFields) MarshalYAML() (interface{}, error) {
+	if s.Default == nil {
+		return s.Fields, nil
+	}
+	type plain SortableFields
+	return plain(s), nil
+}
+
+func (v *ViewFilters) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.SequenceNode {
+		return node.Decode(&v.Filters)
+	}
+	type plain ViewFilters
+	return node.Decode((*plain)(v))
+}
+
+func (v ViewFilters) MarshalYAML() (interface{}, error) {
+	if v.Default == "" {
+		return v.Filters, nil
+	}
+	type plain ViewFilters
+	return plain(v), nil
+}
+
+func (v *ViewGroups) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.SequenceNode {
+		return node.Decode(&v.Groups)
+	}
+	type plain ViewGroups
+	return node.Decode((*plain)(v))
+}
+
+func (v ViewGroups) MarshalYAML() (interface{}, error) {
+	if v.Default == "" {
+		return v.Groups, nil
+	}
+	type plain ViewGroups
+	return plain(v), nil
+}
+
+func (o *SelectOption) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&o.Value)
+	}
+	type plain SelectOption
+	return node.Decode((*plain)(o))
+}
+
+func (o SelectOption) MarshalYAML() (interface{}, error) {
+	if o.Label == "" {
+		return o.Value, nil
+	}
+	type plain SelectOption
+	return plain(o), nil
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// writeCollections upserts the collections into the config, registers their
+// preview templates, keyed by collection or file name, and renders index.html.
+func writeCollections(collections []Collection, previews map[string]preview, templateContent, indexHTML []byte, outputFile string, opts Options) error {
 	var rootNode yaml.Node
+	out := opts.output()
+
+	// Headers are lost by applying the schema
+	headers := make(map[string]string)
+	for _, c := range collections {
+		fieldHeaders(headers, c.Name+".fields", c.Fields)
+		for _, file := range c.Files {
+			fieldHeaders(headers, fmt.Sprintf("%s.files[%s].fields", c.Name, file.Name), file.Fields)
+		}
+	}
+
+	for i := range collections {
+		if err := opts.Schema.apply(&collections[i]); err != nil {
+			return fmt.Errorf("error applying schema to collection %s: %v", collections[i].Name, err)
+		}
+	}
+
+	// Preview the fields as configured after the schema is applied
+	for _, collection := range collections {
+		if p, ok := previews[collection.Name]; ok {
+			p.Fields = previewFields(collection.Fields)
+			previews[collection.Name] = p
+		}
+		for _, file := range collection.Files {
+			if p, ok := previews[file.Name]; ok {
+				p.Fields = previewFields(file.Fields)
+				previews[file.Name] = p
+			}
+		}
+	}
+
+	managedPath := managedFile(outputFile)
+	managed, err := readManaged(out, managedPath)
+	if err != nil {
+		return err
+	}
 
 	// Check if config.yml exists
-	if _, err := os.Stat(outputFile); err == nil {
+	configData, err := out.ReadFile(outputFile)
+	if err == nil {
 		// Load existing config.yml with comment preservation
-		configData, err := os.ReadFile(outputFile)
-		if err != nil {
-			return fmt.Errorf("error reading existing config.yml: %v", err)
-		}
 		err = yaml.Unmarshal(configData, &rootNode)
 		if err != nil {
 			return fmt.Errorf("error parsing existing config.yml: %v", err)
 		}
-	} else {
+	} else if errors.Is(err, fs.ErrNotExist) {
 		// Parse the template file instead if no config.yml exists
 		err := yaml.Unmarshal(templateContent, &rootNode)
 		if err != nil {
 			return fmt.Errorf("error parsing template content: %v", err)
 		}
+		// Values recorded for a previous config do not apply to a new one
+		managed = &yaml.Node{Kind: yaml.MappingNode}
+	} else {
+		return fmt.Errorf("error reading existing config.yml: %v", err)
 	}
 
 	// Find or add the collections node within rootNode
 	collectionsNode := findOrCreateCollectionsNode(&rootNode)
-	upsertCollections(collectionsNode, collections)
+	conflicts := upsertCollections(collectionsNode, collections, managed, headers)
+	for _, conflict := range conflicts {
+		if opts.OnConflict != nil {
+			opts.OnConflict(conflict)
+		}
+	}
 
 	// Marshal updated rootNode to YAML while preserving comments
 	var buf bytes.Buffer
 	enc := yaml.NewEncoder(&buf)
 	enc.SetIndent(2)
 
-	err := enc.Encode(&rootNode)
+	err = enc.Encode(&rootNode)
 	if err != nil {
 		return fmt.Errorf("error generating final YAML: %v", err)
 	}
 
 	// Write final config with preserved comments and structure
-	err = os.WriteFile(outputFile, buf.Bytes(), 0644)
+	err = out.WriteFile(outputFile, buf.Bytes())
 	if err != nil {
 		return fmt.Errorf("error writing config.yml: %v", err)
 	}
 
-	// Write index.html file
-	basePath := filepath.Dir(outputFile)
-	err = os.MkdirAll(basePath, 0755)
+	// Record the generated values to recognise manual edits next time
+	for _, collection := range collections {
+		var node yaml.Node
+		if err := node.Encode(collection); err != nil {
+			return fmt.Errorf("error encoding collection %s: %v", collection.Name, err)
+		}
+		setManaged(managed, collectionKey(collection), &node)
+	}
+	if err := writeManaged(out, managedPath, managed); err != nil {
+		return err
+	}
+
+	adminDir := filepath.Dir(outputFile)
+	if err := writePreviews(out, adminDir, previews); err != nil {
+		return err
+	}
+
+	// Write index.html file, unless an existing one is preserved
+	indexFile := filepath.Join(adminDir, "index.html")
+	if opts.Index.Preserve {
+		_, err := out.ReadFile(indexFile)
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("error reading index.html: %v", err)
+		}
+	}
+
+	index := opts.Index
+	index.Scripts = append([]string{previewScript}, index.Scripts...)
+	indexData, err := RenderIndex(indexHTML, index)
 	if err != nil {
-		return fmt.Errorf("error creating output directory: %v", err)
+		return err
 	}
-	err = os.WriteFile(filepath.Join(basePath, "index.html"), indexHTML, 0644)
+	err = out.WriteFile(indexFile, indexData)
 	if err != nil {
 		return fmt.Errorf("error writing index.html: %v", err)
 	}
@@ -145,57 +505,33 @@ func findOrCreateCollectionsNode(rootNode *yaml.Node) *yaml.Node {
 	return collectionsNode
 }
 
-func upsertCollections(collectionsNode *yaml.Node, collections []Collection) {
+// upsertCollections merges the collections into the collections node,
+// matched by sameCollection. last records the collections generated by the
+// previous run; conflicts between generated values and manual edits are
+// returned.
+func upsertCollections(collectionsNode *yaml.Node, collections []Collection, last *yaml.Node, headers map[string]string) []string {
+	m := &merger{headers: headers}
 	for _, newColl := range collections {
+		var newNode yaml.Node
+		_ = newNode.Encode(newColl)
+
 		upserted := false
 		for _, existingNode := range collectionsNode.Content {
 			existingCollection := Collection{}
 			_ = existingNode.Decode(&existingCollection)
 
-			// Match by Folder path for upsert
-			if existingCollection.Folder == newColl.Folder {
-				// Update only missing fields without overwriting existing configurations
-				mergeCollectionFields(existingNode, newColl)
+			if sameCollection(existingCollection, newColl) {
+				m.mergeMapping(newColl.Name, existingNode, &newNode, lookup(last, collectionKey(newColl)))
 				upserted = true
 				break
 			}
 		}
 		// If no match was found, append the new collection
 		if !upserted {
-			newCollectionNode := yaml.Node{}
-			_ = newCollectionNode.Encode(newColl)
-			collectionsNode.Content = append(collectionsNode.Content, &newCollectionNode)
-		}
-	}
-}
-
-func mergeCollectionFields(existingNode *yaml.Node, newColl Collection) {
-	var tempNode yaml.Node
-	_ = tempNode.Encode(newColl)
-
-	idFieldValue := findFieldInNode(existingNode, decaptaIDField)
-	if idFieldValue == nil && newColl.IdentifierField != "" {
-		existingNode.Content = append(existingNode.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: decaptaIDField}, &yaml.Node{Kind: yaml.ScalarNode, Value: newColl.IdentifierField})
-	}
-
-	// Iterate over newColl fields and upsert only missing fields
-	for i := 0; i < len(tempNode.Content[0].Content); i += 2 {
-		key := tempNode.Content[0].Content[i].Value
-		value := tempNode.Content[0].Content[i+1]
-
-		existingValue := findFieldInNode(existingNode, key)
-		if existingValue == nil {
-			// Field doesn't exist in the existing node, so add it
-			existingNode.Content = append(existingNode.Content, tempNode.Content[0].Content[i], value)
-		} else if key == "fields" {
-			// Recursively merge fields if the key is "fields"
-			mergeFields(existingValue, value)
-		} else if key == "editor" {
-			// Recursively merge editor configuration
-			mergeEditor(existingValue, value)
+			collectionsNode.Content = append(collectionsNode.Content, &newNode)
 		}
 	}
-
+	return m.conflicts
 }
 
 func findFieldInNode(node *yaml.Node, key string) *yaml.Node {
@@ -207,36 +543,41 @@ func findFieldInNode(node *yaml.Node, key string) *yaml.Node {
 	return nil
 }
 
-func mergeFields(existingFieldsNode, newFieldsNode *yaml.Node) {
-	for _, newFieldNode := range newFieldsNode.Content {
-		fieldName := findFieldInNode(newFieldNode, "name").Value
-		existingFieldNode := findFieldByName(existingFieldsNode, fieldName)
-		if existingFieldNode == nil {
-			// Field doesn't exist, so add it
-			existingFieldsNode.Content = append(existingFieldsNode.Content, newFieldNode)
-		} else {
-			// If field exists, no overwrite occurs, preserving manual changes
-			continue
+// collectionPaths returns the content paths of a collection: its folder, or
+// the files of a file collection.
+func collectionPaths(c Collection) []string {
+	if c.Folder != "" {
+		return []string{filepath.Clean(c.Folder)}
+	}
+	var paths []string
+	for _, file := range c.Files {
+		if file.File != "" {
+			paths = append(paths, filepath.Clean(file.File))
 		}
 	}
+	return paths
 }
 
-func findFieldByName(fieldsNode *yaml.Node, fieldName string) *yaml.Node {
-	for _, fieldNode := range fieldsNode.Content {
-		if nameNode := findFieldInNode(fieldNode, "name"); nameNode != nil && nameNode.Value == fieldName {
-			return fieldNode
+// sameCollection reports whether two collections manage the same content, by
+// a common folder or file path. Names are only compared for collections
+// without paths, as projects may generate collections of the same name.
+func sameCollection(a, b Collection) bool {
+	pathsA, pathsB := collectionPaths(a), collectionPaths(b)
+	if len(pathsA) == 0 && len(pathsB) == 0 {
+		return a.Name != "" && a.Name == b.Name
+	}
+	for _, path := range pathsA {
+		if contains(pathsB, path) {
+			return true
 		}
 	}
-	return nil
+	return false
 }
 
-func mergeEditor(existingEditorNode, newEditorNode *yaml.Node) {
-	for i := 0; i < len(newEditorNode.Content); i += 2 {
-		key := newEditorNode.Content[i].Value
-		value := newEditorNode.Content[i+1]
-		existingValue := findFieldInNode(existingEditorNode, key)
-		if existingValue == nil {
-			existingEditorNode.Content = append(existingEditorNode.Content, newEditorNode.Content[i], value)
-		}
+// collectionKey identifies a generated collection in the managed sidecar.
+func collectionKey(c Collection) string {
+	if paths := collectionPaths(c); len(paths) > 0 {
+		return paths[0]
 	}
+	return c.Name
 }
@@ -0,0 +1,600 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const testTemplate = `backend:
+  name: test-repo
+media_folder: _images
+# Collections are generated by decapta
+collections:
+  - name: notes
+    label: Notes
+    folder: content/notes
+    fields:
+      - {name: body, label: Body, widget: markdown}
+`
+
+// testProject is a data directory generated into the content directory.
+type testProject struct {
+	dataType string
+	files    map[string]string
+}
+
+var (
+	csvProject = testProject{"csv", map[string]string{
+		"items.csv": "id,name,price\n1,Apple,1.50\n2,Pear,2.00\n",
+	}}
+	arbProject = testProject{"arb", map[string]string{
+		"app_en.arb": `{"hello": "Hello", "bye": "Bye"}`,
+	}}
+)
+
+// generateConfig pre-processes each project into its own content directory
+// and generates the config of all of them into config.
+func generateConfig(t *testing.T, root, config string, projects []testProject) {
+	t.Helper()
+	for _, project := range projects {
+		dataDir := filepath.Join(root, "data", project.dataType)
+		contentDir := filepath.Join(root, "content", project.dataType)
+		if err := os.MkdirAll(dataDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		for name, content := range project.files {
+			if err := os.WriteFile(filepath.Join(dataDir, name), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := PreProcess(context.Background(), project.dataType, dataDir, contentDir, []string{"id"}, nil, Options{}); err != nil {
+			t.Fatal(err)
+		}
+		if err := GenerateConfig(project.dataType, dataDir, config, []byte(testTemplate), []byte("<html></html>"), contentDir, nil, Options{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// editConfig applies edit to the collections of config, as a user would.
+func editConfig(t *testing.T, config string, edit func(collections *yaml.Node)) {
+	t.Helper()
+	data, err := os.ReadFile(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		t.Fatal(err)
+	}
+	edit(findFieldInNode(root.Content[0], "collections"))
+	data, err = yaml.Marshal(&root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(config, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readCollections(t *testing.T, config string) []Collection {
+	t.Helper()
+	data, err := os.ReadFile(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c struct {
+		Collections []Collection `yaml:"collections"`
+	}
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		t.Fatal(err)
+	}
+	return c.Collections
+}
+
+// setKey sets key of a mapping node to value, adding it if missing.
+func setKey(node *yaml.Node, key, value string) {
+	if v := findFieldInNode(node, key); v != nil {
+		v.Value = value
+		return
+	}
+	node.Content = append(node.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Value: value})
+}
+
+func TestUpsertCollections(t *testing.T) {
+	tests := []struct {
+		name     string
+		projects []testProject
+		// generated names the collections generated by the projects
+		generated []string
+	}{
+		{"csv", []testProject{csvProject}, []string{"csv_items"}},
+		{"arb", []testProject{arbProject}, []string{"translations_en"}},
+		{"mixed", []testProject{csvProject, arbProject}, []string{"csv_items", "translations_en"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			config := filepath.Join(root, "admin", "config.yml")
+			if err := os.MkdirAll(filepath.Dir(config), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(config, []byte(testTemplate), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			generateConfig(t, root, config, tt.projects)
+			first, err := os.ReadFile(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			generateConfig(t, root, config, tt.projects)
+			second, err := os.ReadFile(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(first) != string(second) {
+				t.Errorf("second run changed the config:\n%s\nwant:\n%s", second, first)
+			}
+
+			// Rename the generated collections and add keys by hand. Folder
+			// collections are matched by folder, file collections by file.
+			editConfig(t, config, func(collections *yaml.Node) {
+				for _, node := range collections.Content {
+					name := findFieldInNode(node, "name")
+					if name.Value == "notes" {
+						continue
+					}
+					name.Value = "renamed_" + name.Value
+					setKey(node, "description", "Edited by hand")
+				}
+			})
+			generateConfig(t, root, config, tt.projects)
+			edited, err := os.ReadFile(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			generateConfig(t, root, config, tt.projects)
+			again, err := os.ReadFile(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(edited) != string(again) {
+				t.Errorf("run after edits is not idempotent:\n%s\nwant:\n%s", again, edited)
+			}
+			if !strings.Contains(string(again), "# Collections are generated by decapta") {
+				t.Errorf("template comment lost:\n%s", again)
+			}
+
+			collections := readCollections(t, config)
+			if len(collections) != len(tt.generated)+1 {
+				t.Fatalf("got %d collections, want %d:\n%s", len(collections), len(tt.generated)+1, again)
+			}
+			if collections[0].Name != "notes" || collections[0].Folder != "content/notes" || len(collections[0].Fields) != 1 {
+				t.Errorf("hand-added collection changed: %+v", collections[0])
+			}
+			for i, name := range tt.generated {
+				c := collections[i+1]
+				if c.Name != "renamed_"+name {
+					t.Errorf("collection %d name = %q, want %q", i+1, c.Name, "renamed_"+name)
+				}
+				if c.Description != "Edited by hand" {
+					t.Errorf("collection %s description = %q", c.Name, c.Description)
+				}
+				if len(collectionPaths(c)) == 0 {
+					t.Errorf("collection %s lost its paths", c.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestUpsertMigratesReservedFields(t *testing.T) {
+	for _, sidecar := range []bool{true, false} {
+		t.Run(map[bool]string{true: "sidecar", false: "no sidecar"}[sidecar], func(t *testing.T) {
+			root := t.TempDir()
+			dataDir := filepath.Join(root, "data")
+			contentDir := filepath.Join(root, "content")
+			config := filepath.Join(root, "admin", "config.yml")
+			for _, dir := range []string{dataDir, filepath.Dir(config)} {
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := os.WriteFile(config, []byte(testTemplate), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(dataDir, "items.csv"), []byte("id,Title,first name\n1,Apple,Ann\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			// Configs generated before Title was reserved and headers were
+			// sanitised, which named fields by their header
+			run := func(reserved []string) {
+				t.Helper()
+				opts := Options{Reserved: reserved}
+				if err := PreProcess(context.Background(), "csv", dataDir, contentDir, nil, nil, opts); err != nil {
+					t.Fatal(err)
+				}
+				if err := GenerateConfig("csv", dataDir, config, []byte(testTemplate), []byte("<html></html>"), contentDir, nil, opts); err != nil {
+					t.Fatal(err)
+				}
+			}
+			run([]string{"data"})
+			editConfig(t, config, func(collections *yaml.Node) {
+				fields := findFieldInNode(collections.Content[1], "fields")
+				setKey(findByName(fields, "Title"), "hint", "Edited by hand")
+				firstName := findByName(fields, "first_name")
+				setKey(firstName, "name", "first name")
+				setKey(firstName, "hint", "Edited by hand")
+			})
+			if !sidecar {
+				if err := os.Remove(managedFile(config)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			run(nil)
+
+			var names []string
+			for _, field := range readCollections(t, config)[1].Fields {
+				names = append(names, field.Name)
+				if field.Name != decaptaIDField && field.Name != "id" && field.Hint != "Edited by hand" {
+					t.Errorf("%s hint = %q, want the edited hint", field.Name, field.Hint)
+				}
+			}
+			if got := strings.Join(names, ","); got != "slug,id,decapta_Title,first_name" {
+				t.Errorf("fields = %s, want slug,id,decapta_Title,first_name", got)
+			}
+		})
+	}
+}
+
+func TestUpsertWithoutSidecar(t *testing.T) {
+	root := t.TempDir()
+	config := filepath.Join(root, "admin", "config.yml")
+	if err := os.MkdirAll(filepath.Dir(config), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(config, []byte(testTemplate), 0644); err != nil {
+		t.Fatal(err)
+	}
+	generateConfig(t, root, config, []testProject{csvProject})
+
+	// A config generated before the sidecar existed, with a label edited by
+	// hand
+	if err := os.Remove(managedFile(config)); err != nil {
+		t.Fatal(err)
+	}
+	editConfig(t, config, func(collections *yaml.Node) {
+		fields := findFieldInNode(collections.Content[1], "fields")
+		setKey(findByName(fields, "name"), "label", "Custom")
+	})
+	var conflicts []string
+	opts := Options{OnConflict: func(conflict string) { conflicts = append(conflicts, conflict) }}
+	if err := GenerateConfig("csv", filepath.Join(root, "data", "csv"), config, []byte(testTemplate), []byte("<html></html>"), filepath.Join(root, "content", "csv"), nil, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	fields := readCollections(t, config)[1].Fields
+	for _, field := range fields {
+		if field.Name == "name" && field.Label != "Custom" {
+			t.Errorf("label = %q, want the customised label", field.Label)
+		}
+		if field.Name == decaptaIDField && field.Required != nil {
+			t.Errorf("ID field sets required: %v, the default", *field.Required)
+		}
+	}
+	// Values equal to the generated ones are adopted without a conflict
+	if len(conflicts) != 1 || !strings.Contains(conflicts[0], `keeping "Custom" over generated "name"`) {
+		t.Errorf("conflicts = %q", conflicts)
+	}
+	if _, err := os.Stat(managedFile(config)); err != nil {
+		t.Errorf("sidecar not written: %v", err)
+	}
+}
+
+func TestUpsertReportsConflicts(t *testing.T) {
+	root := t.TempDir()
+	dataDir := filepath.Join(root, "data")
+	contentDir := filepath.Join(root, "content")
+	config := filepath.Join(root, "admin", "config.yml")
+	generateConfig(t, root, config, []testProject{csvProject})
+	editConfig(t, config, func(collections *yaml.Node) {
+		fields := findFieldInNode(collections.Content[len(collections.Content)-1], "fields")
+		setKey(findByName(fields, "name"), "label", "Edited by hand")
+	})
+
+	// The generated label changes too
+	var conflicts []string
+	opts := Options{
+		Schema:     Schema{Fields: map[string]map[string]interface{}{"name": {"label": "Fruit"}}},
+		OnConflict: func(conflict string) { conflicts = append(conflicts, conflict) },
+	}
+	if err := GenerateConfig("csv", filepath.Join(dataDir, "csv"), config, []byte(testTemplate), []byte("<html></html>"), filepath.Join(contentDir, "csv"), nil, opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 1 || !strings.Contains(conflicts[0], `keeping "Edited by hand" over generated "Fruit"`) {
+		t.Errorf("conflicts = %q", conflicts)
+	}
+}
+
+func formatContentChanges(changes []ContentChange) string {
+	var result []string
+	for _, change := range changes {
+		result = append(result, change.Path+" "+string(change.Kind))
+	}
+	return strings.Join(result, ", ")
+}
+
+func TestParseNameStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		diff string
+		want string
+	}{
+		{"empty", "", ""},
+		{"added", "A\titems/3.yaml\n", "items/3.yaml created"},
+		{"deleted", "D\titems/2.yaml\n", "items/2.yaml deleted"},
+		{"modified", "M\titems/1.yaml\n", "items/1.yaml modified"},
+		{"type changed", "T\titems/1.yaml\n", "items/1.yaml modified"},
+		{"renamed", "R100\titems/2.yaml\titems/4.yaml\n", "items/2.yaml deleted, items/4.yaml created"},
+		{"renamed and edited", "R087\ten.yaml\tde.yaml\n", "en.yaml deleted, de.yaml created"},
+		{"copied", "C075\titems/1.yaml\titems/5.yaml\n", "items/5.yaml created"},
+		{"state file", "M\t" + stateFile + "\nM\t.items.yaml\n", ".items.yaml modified"},
+		{"malformed", "M\n\titems/1.yaml\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatContentChanges(parseNameStatus([]byte(tt.diff))); got != tt.want {
+				t.Errorf("parseNameStatus(%q) = %q, want %q", tt.diff, got, tt.want)
+			}
+		})
+	}
+}
+
+func writeContent(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestChangedContent(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(t *testing.T, dir string)
+		want   string
+	}{
+		{"unchanged", func(t *testing.T, dir string) {}, ""},
+		{"created", func(t *testing.T, dir string) {
+			writeContent(t, dir, map[string]string{"items/3.yaml": "name: Cid\n"})
+		}, "items/3.yaml created"},
+		{"modified", func(t *testing.T, dir string) {
+			writeContent(t, dir, map[string]string{"items/1.yaml": "name: Bea\n"})
+		}, "items/1.yaml modified"},
+		{"deleted", func(t *testing.T, dir string) {
+			if err := os.Remove(filepath.Join(dir, "items", "2.yaml")); err != nil {
+				t.Fatal(err)
+			}
+		}, "items/2.yaml deleted"},
+		{"renamed", func(t *testing.T, dir string) {
+			if err := os.Rename(filepath.Join(dir, "en.yaml"), filepath.Join(dir, "de.yaml")); err != nil {
+				t.Fatal(err)
+			}
+		}, "de.yaml created, en.yaml deleted"},
+		{"rewritten unchanged", func(t *testing.T, dir string) {
+			writeContent(t, dir, map[string]string{"items/1.yaml": "name: Ann\n"})
+		}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeContent(t, dir, map[string]string{"items/1.yaml": "name: Ann\n", "items/2.yaml": "name: Bob\n", "en.yaml": "hello: Hello\n"})
+			if err := recordState(DiskOutput{}, dir, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.change(t, dir)
+			changes, err := ChangedContent(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := formatContentChanges(changes); got != tt.want {
+				t.Errorf("changes = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ChangedContent(t.TempDir()); err == nil || !strings.Contains(err.Error(), "run pre-process first") {
+		t.Errorf("changes without a recorded state: %v", err)
+	}
+}
+
+func TestChangedContentSince(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	ctx := context.Background()
+	root := t.TempDir()
+	run := func(args ...string) {
+		t.Helper()
+		if _, err := git(ctx, root, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir := filepath.Join(root, "content")
+	writeContent(t, dir, map[string]string{
+		"items/1.yaml": "name: Ann\n",
+		"items/2.yaml": "name: Bob\nrole: editor\nteam: docs\n",
+		"items/3.yaml": "name: Cid\n",
+		stateFile:      "",
+		"other.yaml":   "",
+	})
+	writeContent(t, root, map[string]string{"outside.yaml": "a: b\n"})
+	run("init", "-q")
+	run("-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "--allow-empty", "-m", "empty")
+	run("add", "-A")
+	run("-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "content")
+
+	writeContent(t, dir, map[string]string{"items/1.yaml": "name: Bea\n", "items/4.yaml": "name: Dan\n", stateFile: "changed"})
+	writeContent(t, root, map[string]string{"outside.yaml": "a: c\n"})
+	if err := os.Rename(filepath.Join(dir, "items", "2.yaml"), filepath.Join(dir, "items", "5.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "items", "3.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	run("add", filepath.Join("content", "items", "5.yaml"), filepath.Join("content", "items", "2.yaml"))
+
+	tests := []struct {
+		rev  string
+		want string
+	}{
+		{"HEAD", "items/1.yaml modified, items/2.yaml deleted, items/3.yaml deleted, items/4.yaml created, items/5.yaml created"},
+		{"HEAD~1", "items/1.yaml created, items/4.yaml created, items/5.yaml created, other.yaml created"},
+	}
+	for _, tt := range tests {
+		changes, err := ChangedContentSince(ctx, dir, tt.rev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := formatContentChanges(changes); got != tt.want {
+			t.Errorf("changes since %s = %q, want %q", tt.rev, got, tt.want)
+		}
+	}
+
+	if changes, err := ChangedContentSince(ctx, filepath.Join(root, "missing"), "HEAD"); err != nil || changes != nil {
+		t.Errorf("changes of a missing directory = %v, %v", changes, err)
+	}
+	if _, err := ChangedContentSince(ctx, dir, "unknown-revision"); err == nil {
+		t.Error("changes since an unknown revision: no error")
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	const valid = `backend:
+  name: github
+  repo: owner/site
+media_folder: images
+collections:
+  - name: notes
+    folder: content/notes
+    identifier_field: slug
+    slug: "{{year}}-{{slug}}"
+    summary: "{{title}} by {{fields.author}}"
+    fields:
+      - {name: slug, widget: string}
+      - {name: title}
+      - {name: author, widget: relation, collection: pages, search_fields: [title], value_field: title}
+  - name: pages
+    files:
+      - name: about
+        file: content/about.md
+        fields:
+          - {name: title}
+`
+	tests := []struct {
+		name   string
+		config string
+		want   []string
+	}{
+		{"valid", valid, nil},
+		{"empty", "", []string{"0:0: config is empty"}},
+		{"not a mapping", "- a\n", []string{"1:1: config must be a mapping"}},
+		{"missing sections", "local_backend: yes please\n", []string{
+			"1:1: backend is required",
+			"1:1: media_folder is required unless media_library is set",
+			"1:1: collections is required",
+		}},
+		{"backend", strings.Replace(valid, "  name: github\n  repo: owner/site\n", "  name: azure\n  repo: site\n", 1), []string{
+			"2:3: backend azure requires app_id",
+			"2:3: backend azure requires tenant_id",
+			"3:9: repo \"site\" must be in the form owner/name",
+		}},
+		{"unknown backend", strings.Replace(valid, "name: github", "name: svn", 1), []string{"2:9: unknown backend \"svn\""}},
+		{"duplicate collection", strings.Replace(valid, "name: pages\n", "name: notes\n", 1), []string{
+			"14:54: collection notes field author relates to unknown collection \"pages\"",
+			"15:11: duplicate collection name \"notes\", first defined on line 6",
+		}},
+		{"missing folder", strings.Replace(valid, "folder: content/notes", "folder: content/posts", 1), []string{
+			"7:13: collection notes path \"content/posts\" does not exist",
+		}},
+		{"file is a directory", strings.Replace(valid, "file: content/about.md", "file: content/notes", 1), []string{
+			"18:15: collection pages file about file \"content/notes\" is a directory",
+		}},
+		{"identifier field", strings.Replace(valid, "identifier_field: slug", "identifier_field: id", 1), []string{
+			"8:23: identifier_field \"id\" is not a field of collection notes",
+		}},
+		{"templates", strings.Replace(valid, "{{fields.author}}", "{{editor}} {{ }}", 1), []string{
+			"10:14: summary references unknown field \"editor\"",
+			"10:14: summary has an empty reference {{ }}",
+		}},
+		{"widgets", strings.Replace(valid, "      - {name: title}\n      - {name: author", "      - {name: title, widget: select}\n      - {name: count, widget: number, value_type: long}\n      - {name: slug}\n      - {name: author", 1), []string{
+			"13:9: collection notes field title is a select widget without options",
+			"14:51: collection notes field count.value_type must be int or float",
+			"15:16: duplicate field name \"slug\" in collection notes",
+		}},
+		{"i18n", strings.Replace(valid, "media_folder: images\n", "media_folder: images\ni18n:\n  structure: single_file\n  locales: [en, de]\n  default_locale: fr\n", 1) + "    i18n:\n      locales: [en, ja]\n", []string{
+			"8:19: i18n.default_locale \"fr\" is not one of the locales",
+			"26:21: locale \"ja\" is not in the top-level i18n locales",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeContent(t, root, map[string]string{"content/notes/1.md": "", "content/about.md": ""})
+			configFile := filepath.Join(root, "config.yml")
+			if err := os.WriteFile(configFile, []byte(tt.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			errs, err := ValidateConfig(configFile, root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range errs {
+				if e.File != configFile {
+					t.Errorf("error in file %s, want %s", e.File, configFile)
+				}
+				got = append(got, fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message))
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("errors =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+
+	if _, err := ValidateConfig(filepath.Join(t.TempDir(), "config.yml"), ""); err == nil {
+		t.Error("validating a missing config: no error")
+	}
+}
@@ -0,0 +1,348 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Normalization rules applied to CSV cells in post-process.
+const (
+	// NormalizePreserve writes the value as edited, but keeps the trailing
+	// newlines of the original cell, which YAML editors tend to add or drop.
+	NormalizePreserve = "preserve"
+	// NormalizeExact writes the value exactly as edited.
+	NormalizeExact = "exact"
+	// NormalizeTrim removes leading and trailing whitespace.
+	NormalizeTrim = "trim"
+	// NormalizeTrimLines removes trailing whitespace from every line and
+	// trailing newlines, as for markdown text.
+	NormalizeTrimLines = "trim-lines"
+)
+
+var normalizeRules = []string{NormalizePreserve, NormalizeExact, NormalizeTrim, NormalizeTrimLines}
+
+// Normalize maps CSV column names to the normalization rule of their cells.
+// The column "*" sets the rule of all other columns, NormalizePreserve if
+// unset. Line breaks always follow the line endings of the original file.
+type Normalize map[string]string
+
+// Validate reports unknown rules.
+func (n Normalize) Validate() error {
+	for column, rule := range n {
+		if !contains(normalizeRules, rule) {
+			return fmt.Errorf("unknown normalization rule %q for column %s, expected one of %s", rule, column, strings.Join(normalizeRules, ", "))
+		}
+	}
+	return nil
+}
+
+func (n Normalize) rule(column string) string {
+	if rule, ok := n[column]; ok {
+		return rule
+	}
+	if rule, ok := n["*"]; ok {
+		return rule
+	}
+	return NormalizePreserve
+}
+
+// apply normalizes the edited value of a cell. original is the cell of the
+// same row in the original CSV file, if there is one. Line breaks follow the
+// original cell, or the file if crlf is set and the cell had none.
+func (n Normalize) apply(column string, value string, original string, hasOriginal bool, crlf bool) string {
+	// Content files and CSV readers use LF line breaks
+	value = strings.ReplaceAll(value, "\r\n", "\n")
+	lf := strings.ReplaceAll(original, "\r\n", "\n")
+	if hasOriginal && strings.Contains(original, "\n") {
+		crlf = strings.Contains(original, "\r\n")
+	}
+
+	value = n.normalize(column, value, lf, hasOriginal)
+	if hasOriginal && value == lf {
+		return original
+	}
+	if crlf {
+		value = strings.ReplaceAll(value, "\n", "\r\n")
+	}
+	return value
+}
+
+// normalize applies the rule of column to a value with LF line breaks.
+func (n Normalize) normalize(column string, value string, original string, hasOriginal bool) string {
+	switch n.rule(column) {
+	case NormalizeExact:
+		return value
+	case NormalizeTrim:
+		return strings.TrimSpace(value)
+	case NormalizeTrimLines:
+		lines := strings.Split(value, "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight(line, " \t")
+		}
+		return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+	default:
+		trimmed := strings.TrimRight(value, "\n")
+		if !hasOriginal || trimmed == "" {
+			return value
+		}
+		return trimmed + original[len(strings.TrimRight(original, "\n")):]
+	}
+}
+
+// formatCell formats a value decoded from a content file as a CSV cell.
+// Missing and null values are empty, numbers keep their digits.
+func formatCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// lineEndings counts the line endings of a stream as it is read.
+type lineEndings struct {
+	r    io.Reader
+	lf   int
+	crlf int
+	last byte
+	read bool
+}
+
+func (l *lineEndings) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	for _, b := range p[:n] {
+		if b == '\n' {
+			l.lf++
+			if l.last == '\r' {
+				l.crlf++
+			}
+		}
+		l.last = b
+		l.read = true
+	}
+	return n, err
+}
+
+// CRLF reports whether most lines end with CRLF.
+func (l *lineEndings) CRLF() bool {
+	return l.crlf > 0 && l.crlf*2 >= l.lf
+}
+
+// FinalNewline reports whether the stream, if not empty, ends with a newline.
+func (l *lineEndings) FinalNewline() bool {
+	return !l.read || l.last == '\n'
+}
+
+// trimFinalNewline writes through to w, except for the final line ending.
+type trimFinalNewline struct {
+	w       io.Writer
+	pending []byte
+}
+
+func (t *trimFinalNewline) Write(p []byte) (int, error) {
+	data := append(t.pending, p...)
+	keep := len(data)
+	if bytes.HasSuffix(data, []byte("\r\n")) {
+		keep -= 2
+	} else if bytes.HasSuffix(data, []byte("\n")) || bytes.HasSuffix(data, []byte("\r")) {
+		keep--
+	}
+	if _, err := t.w.Write(data[:keep]); err != nil {
+		return 0, err
+	}
+	t.pending = append([]byte(nil), data[keep:]...)
+	return len(p), nil
+}
+
+// recordWriter writes CSV records, ending them with CRLF if crlf is set.
+// Unlike csv.Writer.UseCRLF, line breaks within cells are written as given.
+type recordWriter struct {
+	w    io.Writer
+	crlf bool
+	buf  bytes.Buffer
+	csv  *csv.Writer
+}
+
+func newRecordWriter(w io.Writer, crlf bool) *recordWriter {
+	r := &recordWriter{w: w, crlf: crlf}
+	r.csv = csv.NewWriter(&r.buf)
+	return r
+}
+
+func (r *recordWriter) Write(record []string) error {
+	r.buf.Reset()
+	r.csv.Write(record)
+	r.csv.Flush()
+	if err := r.csv.Error(); err != nil {
+		return err
+	}
+	data := r.buf.Bytes()
+	if r.crlf {
+		data = append(data[:len(data)-1], '\r', '\n')
+	}
+	_, err := r.w.Write(data)
+	return err
+}
+
+// originalRows streams the rows of the original CSV file alongside the
+// content files, which are named by row number. Cells keep the CRLF line
+// breaks that csv.Reader drops.
+type originalRows struct {
+	file    *os.File
+	raw     *rawInput
+	reader  *csv.Reader
+	columns map[string]int
+	row     int
+	record  []string
+}
+
+// openOriginalRows opens the original CSV file, nil if there is none.
+func openOriginalRows(path string) *originalRows {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	raw := &rawInput{r: file}
+	reader := csv.NewReader(raw)
+	reader.FieldsPerRecord = -1
+	headers, err := reader.Read()
+	if err != nil {
+		file.Close()
+		return nil
+	}
+	raw.discard(reader.InputOffset())
+
+	columns := make(map[string]int, len(headers))
+	for i, header := range headers {
+		columns[header] = i
+	}
+	return &originalRows{file: file, raw: raw, reader: reader, columns: columns}
+}
+
+// cell returns the original cell of a column in a row, counted from 1. Rows
+// must be requested in ascending order.
+func (o *originalRows) cell(row int, column string) (string, bool) {
+	if o == nil || row < 1 {
+		return "", false
+	}
+	for o.reader != nil && o.row < row {
+		start := o.reader.InputOffset()
+		record, err := o.reader.Read()
+		if err != nil {
+			o.reader = nil
+			o.record = nil
+			break
+		}
+		end := o.reader.InputOffset()
+		restoreCRLF(record, o.raw.bytes(start, end))
+		o.raw.discard(end)
+		o.row++
+		o.record = record
+	}
+	if o.row != row || o.record == nil {
+		return "", false
+	}
+	i, ok := o.columns[column]
+	if !ok || i >= len(o.record) {
+		return "", false
+	}
+	return o.record[i], true
+}
+
+// restoreCRLF restores the CRLF line breaks of the cells of a record from
+// its raw input. The line breaks within a record belong to its quoted
+// cells in order; blank lines before the record are skipped.
+func restoreCRLF(record []string, raw []byte) {
+	for len(raw) > 0 && (raw[0] == '\n' || bytes.HasPrefix(raw, []byte("\r\n"))) {
+		raw = raw[bytes.IndexByte(raw, '\n')+1:]
+	}
+	for i, cell := range record {
+		if !strings.Contains(cell, "\n") {
+			continue
+		}
+		var b strings.Builder
+		for _, line := range strings.SplitAfter(cell, "\n") {
+			if !strings.HasSuffix(line, "\n") {
+				b.WriteString(line)
+				continue
+			}
+			j := bytes.IndexByte(raw, '\n')
+			if j < 0 {
+				return
+			}
+			b.WriteString(line[:len(line)-1])
+			if j > 0 && raw[j-1] == '\r' {
+				b.WriteByte('\r')
+			}
+			b.WriteByte('\n')
+			raw = raw[j+1:]
+		}
+		record[i] = b.String()
+	}
+}
+
+// rawInput keeps the bytes read from r after the last discarded offset.
+type rawInput struct {
+	r      io.Reader
+	buf    []byte
+	offset int64
+}
+
+func (r *rawInput) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.buf = append(r.buf, p[:n]...)
+	return n, err
+}
+
+// bytes returns the input between two offsets not yet discarded.
+func (r *rawInput) bytes(start, end int64) []byte {
+	return r.buf[start-r.offset : end-r.offset]
+}
+
+// discard drops the input before offset.
+func (r *rawInput) discard(offset int64) {
+	r.buf = r.buf[offset-r.offset:]
+	r.offset = offset
+}
+
+func (o *originalRows) Close() error {
+	if o == nil {
+		return nil
+	}
+	return o.file.Close()
+}
@@ -0,0 +1,168 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestNormalizeScalarStyles(t *testing.T) {
+	tests := []struct {
+		name     string
+		yaml     string
+		rule     string
+		original string
+		want     string
+	}{
+		{"plain preserve", "v: text  ", NormalizePreserve, "text\n", "text\n"},
+		{"plain exact", "v: text", NormalizeExact, "text\n", "text"},
+		{"quoted preserve", `v: " text\n\n"`, NormalizePreserve, " text", " text"},
+		{"quoted exact", `v: " text\n\n"`, NormalizeExact, " text", " text\n\n"},
+		{"quoted trim", `v: " text\n\n"`, NormalizeTrim, "", "text"},
+		{"quoted trim-lines", `v: "a  \nb\t\n\n"`, NormalizeTrimLines, "", "a\nb"},
+		{"literal preserve", "v: |\n  a\n  b\n", NormalizePreserve, "a\nb", "a\nb"},
+		{"literal preserve new row", "v: |\n  a\n  b\n", NormalizePreserve, "", "a\nb\n"},
+		{"literal exact", "v: |\n  a\n  b\n", NormalizeExact, "a\nb", "a\nb\n"},
+		{"literal keep trim-lines", "v: |+\n  a  \n  b\n\n", NormalizeTrimLines, "a\nb", "a\nb"},
+		{"literal strip preserve", "v: |-\n  a\n  b\n", NormalizePreserve, "a\nb\n\n", "a\nb\n\n"},
+		{"folded preserve", "v: >\n  a\n  b\n", NormalizePreserve, "a b", "a b"},
+		{"folded exact", "v: >\n  a\n  b\n", NormalizeExact, "a b", "a b\n"},
+		{"folded trim", "v: >\n  a\n\n  b  \n", NormalizeTrim, "", "a\nb"},
+		{"folded strip trim-lines", "v: >-\n  a\n\n  b  \n", NormalizeTrimLines, "", "a\nb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var record map[string]interface{}
+			if err := yaml.Unmarshal([]byte(tt.yaml), &record); err != nil {
+				t.Fatal(err)
+			}
+			n := Normalize{"v": tt.rule}
+			got := n.apply("v", formatCell(record["v"]), tt.original, tt.original != "", false)
+			if got != tt.want {
+				t.Errorf("apply = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeLineEndings(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		original string
+		crlf     bool
+		want     string
+	}{
+		{"unchanged crlf cell", "a\nb", "a\r\nb", false, "a\r\nb"},
+		{"unchanged lf cell in crlf file", "a\nb", "a\nb", true, "a\nb"},
+		{"unchanged mixed cell", "a\nb\nc", "a\r\nb\nc", true, "a\r\nb\nc"},
+		{"edited crlf cell", "a\nc", "a\r\nb", false, "a\r\nc"},
+		{"edited lf cell in crlf file", "a\nc", "a\nb", true, "a\nc"},
+		{"new line break in crlf file", "a\nb", "ab", true, "a\r\nb"},
+		{"new row in lf file", "a\nb", "", false, "a\nb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Normalize{}.apply("v", tt.value, tt.original, tt.original != "", tt.crlf)
+			if got != tt.want {
+				t.Errorf("apply = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCSVLineEndingsRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+		// edit replaces the text of row 1, if set
+		edit string
+		want string
+	}{
+		{
+			name: "crlf rows with lf cells",
+			csv:  "id,text\r\n1,\"a\nb\"\r\n2,\"c\nd\"\r\n",
+		},
+		{
+			name: "lf rows with crlf cells",
+			csv:  "id,text\n1,\"a\r\nb\"\n2,\"c\nd\"\n",
+		},
+		{
+			name: "blank lines and mixed cells",
+			csv:  "id,text,note\r\n\r\n1,\"a\r\nb\nc\",\"x\ny\"\r\n2,plain,\"y\r\n\"\r\n",
+			want: "id,text,note\r\n1,\"a\r\nb\nc\",\"x\ny\"\r\n2,plain,\"y\r\n\"\r\n",
+		},
+		{
+			name: "edited crlf cell",
+			csv:  "id,text\n1,\"a\r\nb\"\n2,\"c\nd\"\n",
+			edit: "a\nb\nc",
+			want: "id,text\n1,\"a\r\nb\r\nc\"\n2,\"c\nd\"\n",
+		},
+		{
+			name: "edited cell in crlf file",
+			csv:  "id,text\r\n1,a\r\n",
+			edit: "a\nb",
+			want: "id,text\r\n1,\"a\r\nb\"\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			csvDir := filepath.Join(root, "data")
+			contentDir := filepath.Join(root, "content")
+			csvFile := filepath.Join(csvDir, "items.csv")
+			if err := os.MkdirAll(csvDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(csvFile, []byte(tt.csv), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.Background()
+			if err := CSVPreProcess(ctx, csvDir, contentDir, []string{"id"}, nil, Options{}); err != nil {
+				t.Fatal(err)
+			}
+			if tt.edit != "" {
+				content, err := yaml.Marshal(map[string]string{"id": "1", "text": tt.edit})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(filepath.Join(contentDir, "items", "1.yaml"), content, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := CSVPostProcess(ctx, contentDir, csvDir, Options{}); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile(csvFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want
+			if want == "" {
+				want = tt.csv
+			}
+			if string(got) != want {
+				t.Errorf("post-process wrote %q, want %q", got, want)
+			}
+		})
+	}
+}
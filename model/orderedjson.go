@@ -0,0 +1,239 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// decodeOrderedJSON decodes a JSON document keeping the key order of objects.
+// Objects decode to OrderedMap, arrays to []interface{} and numbers to
+// json.Number so their original formatting is kept.
+func decodeOrderedJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	value, err := decodeOrderedValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after top-level value")
+	}
+	return value, nil
+}
+
+func decodeOrderedValue(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return tok, nil
+	}
+
+	switch delim {
+	case '{':
+		object := OrderedMap{}
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrderedValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			object = append(object, KVPair{Key: keyTok.(string), Value: value})
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return object, nil
+	case '[':
+		array := []interface{}{}
+		for dec.More() {
+			value, err := decodeOrderedValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return array, nil
+	default:
+		return nil, fmt.Errorf("unexpected delimiter %v", delim)
+	}
+}
+
+// decodeOrderedYAML decodes a YAML node like decodeOrderedJSON: mappings
+// decode to OrderedMap and numbers that are valid JSON to json.Number. Merge
+// keys are skipped, they are kept as written by mergeContentNode.
+func decodeOrderedYAML(node *yaml.Node) (interface{}, error) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		return decodeOrderedYAML(node.Content[0])
+	case yaml.AliasNode:
+		return decodeOrderedYAML(node.Alias)
+	case yaml.MappingNode:
+		object := OrderedMap{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if isMergeKey(node.Content[i]) {
+				// Inherited keys take the position of the merge key
+				inherited, err := decodeMergedYAML(node.Content[i+1])
+				if err != nil {
+					return nil, err
+				}
+				for _, pair := range inherited {
+					key, _ := mappingEntry(node, pair.Key)
+					if _, seen := object.Get(pair.Key); key == nil && !seen {
+						object = append(object, pair)
+					}
+				}
+				continue
+			}
+			value, err := decodeOrderedYAML(node.Content[i+1])
+			if err != nil {
+				return nil, err
+			}
+			object = append(object, KVPair{Key: node.Content[i].Value, Value: value})
+		}
+		return object, nil
+	case yaml.SequenceNode:
+		array := []interface{}{}
+		for _, item := range node.Content {
+			value, err := decodeOrderedYAML(item)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		return array, nil
+	}
+
+	switch node.ShortTag() {
+	case "!!int", "!!float":
+		if json.Valid([]byte(node.Value)) {
+			return json.Number(node.Value), nil
+		}
+	}
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// decodeMergedYAML decodes the value of a merge key: a mapping, or a list of
+// mappings where the first one defining a key wins.
+func decodeMergedYAML(node *yaml.Node) (OrderedMap, error) {
+	sources := []*yaml.Node{node}
+	if node.Kind == yaml.SequenceNode {
+		sources = node.Content
+	}
+	var merged OrderedMap
+	for _, source := range sources {
+		value, err := decodeOrderedYAML(source)
+		if err != nil {
+			return nil, err
+		}
+		object, ok := value.(OrderedMap)
+		if !ok {
+			return nil, fmt.Errorf("line %d: merge key value is not a mapping", source.Line)
+		}
+		for _, pair := range object {
+			if _, ok := merged.Get(pair.Key); !ok {
+				merged = append(merged, pair)
+			}
+		}
+	}
+	return merged, nil
+}
+
+// isMergeKey reports whether a mapping key is the merge key "<<".
+func isMergeKey(key *yaml.Node) bool {
+	return key.Kind == yaml.ScalarNode && key.ShortTag() == "!!merge"
+}
+
+// isDate reports whether a time has no time of day and no offset, as YAML
+// dates and TOML local dates decode.
+func isDate(t time.Time) bool {
+	_, offset := t.Zone()
+	return offset == 0 && t.Equal(t.Truncate(24*time.Hour))
+}
+
+// orderedYAMLNode encodes a value decoded by decodeOrderedJSON, keeping the
+// key order of objects and the formatting of numbers. Times without a time
+// of day are written as dates, and TOML local times as strings.
+func orderedYAMLNode(value interface{}) (*yaml.Node, error) {
+	switch v := value.(type) {
+	case OrderedMap:
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, kv := range v {
+			key := &yaml.Node{}
+			if err := key.Encode(kv.Key); err != nil {
+				return nil, err
+			}
+			child, err := orderedYAMLNode(kv.Value)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, key, child)
+		}
+		return node, nil
+	case []interface{}:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range v {
+			child, err := orderedYAMLNode(item)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		return node, nil
+	case json.Number:
+		tag := "!!float"
+		if _, err := v.Int64(); err == nil {
+			tag = "!!int"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: string(v)}, nil
+	case time.Time:
+		if v.Location() == tomlLocalTime {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v.Format(tomlTimeFormat)}, nil
+		}
+		if isDate(v) {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!timestamp", Value: v.Format("2006-01-02")}, nil
+		}
+	}
+
+	node := &yaml.Node{}
+	if err := node.Encode(value); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
@@ -0,0 +1,254 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// Output receives the files written and removed by a processing step. Paths
+// are the same paths that would be used with the os package. ReadFile sees
+// the files written so far, so steps can build on each other's output.
+type Output interface {
+	Create(path string) (io.WriteCloser, error)
+	WriteFile(path string, data []byte) error
+	ReadFile(path string) ([]byte, error)
+	Remove(path string) error
+}
+
+// DiskOutput writes files directly to the filesystem, creating parent
+// directories as needed.
+type DiskOutput struct{}
+
+func (DiskOutput) Create(path string) (io.WriteCloser, error) {
+	err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+	return os.Create(path)
+}
+
+func (DiskOutput) WriteFile(path string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (DiskOutput) ReadFile(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+func (DiskOutput) Remove(path string) error {
+	return os.Remove(path)
+}
+
+// output returns the configured Output, writing to disk by default.
+func (opts Options) output() Output {
+	if opts.Output != nil {
+		return opts.Output
+	}
+	return DiskOutput{}
+}
+
+// Plan is an Output that keeps all writes in memory so they can be compared
+// against the filesystem without touching it.
+type Plan struct {
+	mu      sync.Mutex
+	files   map[string][]byte
+	removed map[string]bool
+}
+
+func NewPlan() *Plan {
+	return &Plan{
+		files:   make(map[string][]byte),
+		removed: make(map[string]bool),
+	}
+}
+
+func (p *Plan) Create(path string) (io.WriteCloser, error) {
+	return &planFile{plan: p, path: path}, nil
+}
+
+func (p *Plan) WriteFile(path string, data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	path = filepath.Clean(path)
+	p.files[path] = append([]byte(nil), data...)
+	delete(p.removed, path)
+	return nil
+}
+
+func (p *Plan) Remove(path string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	path = filepath.Clean(path)
+	delete(p.files, path)
+	p.removed[path] = true
+	return nil
+}
+
+// ReadFile returns the planned content of path, falling back to the
+// filesystem for files the plan did not touch.
+func (p *Plan) ReadFile(path string) ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	path = filepath.Clean(path)
+	if data, ok := p.files[path]; ok {
+		return append([]byte(nil), data...), nil
+	}
+	if p.removed[path] {
+		return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+	}
+	return os.ReadFile(path)
+}
+
+type planFile struct {
+	bytes.Buffer
+	plan *Plan
+	path string
+}
+
+func (f *planFile) Close() error {
+	return f.plan.WriteFile(f.path, f.Bytes())
+}
+
+// ChangeKind describes how a planned file differs from the filesystem.
+type ChangeKind string
+
+const (
+	ChangeCreated  ChangeKind = "created"
+	ChangeModified ChangeKind = "modified"
+	ChangeDeleted  ChangeKind = "deleted"
+)
+
+// Change is a single file that a Plan would create, modify or delete.
+type Change struct {
+	Path string     `json:"path"`
+	Kind ChangeKind `json:"kind"`
+	Old  []byte     `json:"-"`
+	New  []byte     `json:"-"`
+}
+
+// Changes compares the plan with the filesystem and returns the files that
+// would change, sorted by path. Unchanged files are left out.
+func (p *Plan) Changes() ([]Change, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var changes []Change
+	for path, data := range p.files {
+		existing, err := os.ReadFile(path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			changes = append(changes, Change{Path: path, Kind: ChangeCreated, New: data})
+		case err != nil:
+			return nil, fmt.Errorf("error reading %s: %v", path, err)
+		case !bytes.Equal(existing, data):
+			changes = append(changes, Change{Path: path, Kind: ChangeModified, Old: existing, New: data})
+		}
+	}
+	for path := range p.removed {
+		existing, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", path, err)
+		}
+		changes = append(changes, Change{Path: path, Kind: ChangeDeleted, Old: existing})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+// WriteUnifiedDiff writes a unified diff of the changes to w.
+func WriteUnifiedDiff(w io.Writer, changes []Change) error {
+	for _, change := range changes {
+		fromFile, toFile := "a/"+filepath.ToSlash(change.Path), "b/"+filepath.ToSlash(change.Path)
+		switch change.Kind {
+		case ChangeCreated:
+			fromFile = "/dev/null"
+		case ChangeDeleted:
+			toFile = "/dev/null"
+		}
+
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        splitLines(change.Old),
+			B:        splitLines(change.New),
+			FromFile: fromFile,
+			ToFile:   toFile,
+			Context:  3,
+		})
+		if err != nil {
+			return fmt.Errorf("error diffing %s: %v", change.Path, err)
+		}
+		if _, err := io.WriteString(w, diff); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitLines splits data into lines keeping their line endings. A missing
+// final newline is added so the diff output stays line oriented.
+func splitLines(data []byte) []string {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += "\n"
+	return lines
+}
+
+// WriteChangeSummary writes the changes as a JSON document to w.
+func WriteChangeSummary(w io.Writer, changes []Change) error {
+	summary := struct {
+		Changed bool     `json:"changed"`
+		Files   []Change `json:"files"`
+	}{
+		Changed: len(changes) > 0,
+		Files:   changes,
+	}
+	if summary.Files == nil {
+		summary.Files = []Change{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(summary)
+}
@@ -0,0 +1,142 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+)
+
+type indexedError struct {
+	index int
+	err   error
+}
+
+// pool runs tasks on a bounded number of goroutines. The first failing task
+// cancels the context handed to all other tasks. Pools created from the
+// context of a task share the bound of the outer pool, so rows processed
+// within file tasks do not multiply the number of workers.
+type pool struct {
+	parent context.Context
+	ctx    context.Context
+	cancel context.CancelFunc
+	sem    chan struct{}
+	// nested pools run tasks on the calling goroutine while the workers
+	// of the outer pool are busy, as waiting for them could deadlock.
+	nested bool
+	wg     sync.WaitGroup
+
+	mu   sync.Mutex
+	errs []indexedError
+}
+
+type poolKey struct{}
+
+func newPool(ctx context.Context, jobs int) *pool {
+	if jobs < 1 {
+		jobs = 1
+	}
+	sem, nested := ctx.Value(poolKey{}).(chan struct{})
+	if !nested {
+		sem = make(chan struct{}, jobs)
+	}
+	poolCtx, cancel := context.WithCancel(ctx)
+	return &pool{
+		parent: ctx,
+		ctx:    context.WithValue(poolCtx, poolKey{}, sem),
+		cancel: cancel,
+		sem:    sem,
+		nested: nested,
+	}
+}
+
+// Go schedules fn and blocks while all workers are busy, or runs fn itself
+// in a nested pool. The index orders the errors reported by Wait. Tasks
+// scheduled after cancellation are skipped.
+func (p *pool) Go(index int, fn func(ctx context.Context) error) {
+	if p.nested {
+		select {
+		case p.sem <- struct{}{}:
+		default:
+			p.run(index, fn)
+			return
+		}
+	} else {
+		select {
+		case p.sem <- struct{}{}:
+		case <-p.ctx.Done():
+			return
+		}
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer func() {
+			<-p.sem
+			p.wg.Done()
+		}()
+		p.run(index, fn)
+	}()
+}
+
+func (p *pool) run(index int, fn func(ctx context.Context) error) {
+	if p.ctx.Err() != nil {
+		return
+	}
+	if err := fn(p.ctx); err != nil {
+		p.mu.Lock()
+		p.errs = append(p.errs, indexedError{index: index, err: err})
+		p.mu.Unlock()
+		p.cancel()
+	}
+}
+
+// Done reports whether the pool was cancelled, either by a failed task or by
+// the parent context.
+func (p *pool) Done() bool {
+	return p.ctx.Err() != nil
+}
+
+// Wait blocks until all scheduled tasks returned. It reports the task errors
+// joined in index order, leaving out cancellations caused by the first
+// failure, or the parent context's error when it was cancelled.
+func (p *pool) Wait() error {
+	p.wg.Wait()
+	p.cancel()
+
+	sort.Slice(p.errs, func(i, j int) bool {
+		return p.errs[i].index < p.errs[j].index
+	})
+
+	var errs []error
+	for _, e := range p.errs {
+		if errors.Is(e.err, context.Canceled) {
+			continue
+		}
+		errs = append(errs, e.err)
+	}
+	if len(errs) == 0 {
+		if err := p.parent.Err(); err != nil {
+			return err
+		}
+		if len(p.errs) > 0 {
+			return p.errs[0].err
+		}
+		return nil
+	}
+	return errors.Join(errs...)
+}
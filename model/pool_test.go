@@ -0,0 +1,60 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNestedPoolsShareBound(t *testing.T) {
+	const jobs = 3
+	var running, peak, done int32
+	task := func(ctx context.Context) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			max := atomic.LoadInt32(&peak)
+			if n <= max || atomic.CompareAndSwapInt32(&peak, max, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		atomic.AddInt32(&done, 1)
+		return nil
+	}
+
+	p := newPool(context.Background(), jobs)
+	for i := 0; i < 4; i++ {
+		p.Go(i, func(ctx context.Context) error {
+			rows := newPool(ctx, jobs)
+			for j := 0; j < 10; j++ {
+				rows.Go(j, task)
+			}
+			return rows.Wait()
+		})
+	}
+	if err := p.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if done != 40 {
+		t.Errorf("ran %d tasks, want 40", done)
+	}
+	if peak > jobs {
+		t.Errorf("%d tasks ran at once, want at most %d", peak, jobs)
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+//go:embed preview.js
+var previewRuntime []byte
+
+const (
+	// previewScript is written next to config.yml and loaded by index.html.
+	previewScript = "decapta-preview.js"
+	// previewSnapshotDir holds the JSON snapshots of CSV files, a directory
+	// of pages per collection.
+	previewSnapshotDir = "previews"
+	// previewPageSize is the number of rows per snapshot page.
+	previewPageSize = 100
+	// previewIDs maps the decapta ID of each row to its index in a snapshot.
+	previewIDs  = "ids.json"
+	previewsVar = "var DECAPTA_PREVIEWS = "
+)
+
+// preview describes the preview template registered for a folder collection
+// or, for file collections, a file.
+type preview struct {
+	Type     string         `json:"type"`
+	Fields   []previewField `json:"fields,omitempty"`
+	Snapshot string         `json:"snapshot,omitempty"`
+	PageSize int            `json:"page_size,omitempty"`
+}
+
+type previewField struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+}
+
+func previewFields(fields []Field) []previewField {
+	var result []previewField
+	for _, field := range fields {
+		if field.Name == decaptaIDField {
+			continue
+		}
+		result = append(result, previewField{Name: field.Name, Label: field.Label})
+	}
+	return result
+}
+
+// writePreviews upserts the previews into the preview script of adminDir, so
+// the previews of collections generated by other runs are kept.
+func writePreviews(out Output, adminDir string, previews map[string]preview) error {
+	scriptPath := filepath.Join(adminDir, previewScript)
+
+	all := make(map[string]preview)
+	existing, err := out.ReadFile(scriptPath)
+	if err == nil {
+		all, err = parsePreviews(existing)
+		if err != nil {
+			return fmt.Errorf("error parsing %s: %v", scriptPath, err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error reading %s: %v", scriptPath, err)
+	}
+
+	for name, p := range previews {
+		all[name] = p
+	}
+
+	data, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(previewsVar)
+	buf.Write(data)
+	buf.WriteString(";\n")
+	buf.Write(previewRuntime)
+
+	if err := out.WriteFile(scriptPath, buf.Bytes()); err != nil {
+		return fmt.Errorf("error writing %s: %v", scriptPath, err)
+	}
+	return nil
+}
+
+func parsePreviews(script []byte) (map[string]preview, error) {
+	previews := make(map[string]preview)
+	scanner := bufio.NewScanner(bytes.NewReader(script))
+	scanner.Buffer(nil, len(script)+1)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, previewsVar) {
+			continue
+		}
+		data := strings.TrimSuffix(strings.TrimPrefix(line, previewsVar), ";")
+		if err := json.Unmarshal([]byte(data), &previews); err != nil {
+			return nil, err
+		}
+		return previews, nil
+	}
+	return previews, scanner.Err()
+}
+
+// writeCSVSnapshot streams a CSV file into JSON pages of previewPageSize
+// rows in dir, used by the preview to show the neighbouring rows of an entry
+// without loading the whole file. Rows are found by their decapta ID, built
+// from slugFields as in pre-process or, if empty, the row number. Pages of
+// earlier, longer files are removed.
+func writeCSVSnapshot(out Output, csvFilePath string, dir string, fields, slugFields []string) error {
+	// Files written but not yet on disk, as in a dry run, are read from out
+	var csvFile io.Reader
+	if _, ok := out.(DiskOutput); ok {
+		f, err := os.Open(csvFilePath)
+		if err != nil {
+			return fmt.Errorf("error opening CSV file %s: %v", csvFilePath, err)
+		}
+		defer f.Close()
+		csvFile = f
+	} else {
+		data, err := out.ReadFile(csvFilePath)
+		if err != nil {
+			return fmt.Errorf("error opening CSV file %s: %v", csvFilePath, err)
+		}
+		csvFile = bytes.NewReader(data)
+	}
+
+	reader := csv.NewReader(csvFile)
+	reader.FieldsPerRecord = -1
+	headers, err := reader.Read()
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("error reading CSV file %s: %v", csvFilePath, err)
+	}
+
+	fieldData, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	pages := 0
+	var rows [][]string
+	ids := make(map[string]int)
+	writePage := func() error {
+		rowData, err := json.Marshal(rows)
+		if err != nil {
+			return err
+		}
+		page := filepath.Join(dir, fmt.Sprintf("%d.json", pages))
+		data := []byte(fmt.Sprintf("{\"fields\":%s,\"rows\":%s}\n", fieldData, rowData))
+		if err := out.WriteFile(page, data); err != nil {
+			return fmt.Errorf("error writing preview snapshot %s: %v", page, err)
+		}
+		pages++
+		rows = rows[:0]
+		return nil
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading CSV file %s: %v", csvFilePath, err)
+		}
+
+		// Slug fields are named by their header
+		data := make(map[string]interface{}, len(headers))
+		for j, value := range record {
+			if j < len(headers) {
+				data[headers[j]] = value
+			}
+		}
+		row := pages*previewPageSize + len(rows)
+		id := generateIdentifierField(data, slugFields)
+		if id == "" {
+			id = strconv.Itoa(row + 1)
+		}
+		if _, ok := ids[id]; !ok {
+			ids[id] = row
+		}
+
+		rows = append(rows, record)
+		if len(rows) == previewPageSize {
+			if err := writePage(); err != nil {
+				return err
+			}
+		}
+	}
+	if len(rows) > 0 || pages == 0 {
+		if err := writePage(); err != nil {
+			return err
+		}
+	}
+
+	idData, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+	idPath := filepath.Join(dir, previewIDs)
+	if err := out.WriteFile(idPath, append(idData, '\n')); err != nil {
+		return fmt.Errorf("error writing preview snapshot %s: %v", idPath, err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error reading preview snapshot %s: %v", dir, err)
+	}
+	for _, entry := range entries {
+		page, err := strconv.Atoi(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil || page < pages {
+			continue
+		}
+		if err := out.Remove(filepath.Join(dir, entry.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("error removing preview snapshot %s: %v", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
+// removeCSVSnapshot removes the pages of the snapshot in dir and the single
+// file snapshots were written to before they were split into pages.
+func removeCSVSnapshot(out Output, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error reading preview snapshot %s: %v", dir, err)
+	}
+	paths := []string{dir + ".json"}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".json") {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if err := out.Remove(path); err != nil {
+			return fmt.Errorf("error removing preview snapshot %s: %v", path, err)
+		}
+	}
+	return nil
+}
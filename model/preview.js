@@ -0,0 +1,186 @@
+// Preview templates generated by https://github.com/kyodo-tech/decapta.
+// DECAPTA_PREVIEWS is upserted by the config step; do not edit this file.
+(function () {
+  var previews = DECAPTA_PREVIEWS;
+  var neighbours = 2;
+
+  function plain(value) {
+    if (value && typeof value.toJS === "function") {
+      return value.toJS();
+    }
+    return value;
+  }
+
+  function text(value) {
+    value = plain(value);
+    if (value === undefined || value === null) {
+      return "";
+    }
+    if (typeof value === "object") {
+      return JSON.stringify(value);
+    }
+    return String(value);
+  }
+
+  var tableStyle = { borderCollapse: "collapse", width: "100%", fontFamily: "sans-serif", fontSize: "14px" };
+  var cellStyle = { border: "1px solid #ddd", padding: "4px 8px", textAlign: "left", verticalAlign: "top", whiteSpace: "pre-wrap" };
+  var headStyle = Object.assign({}, cellStyle, { background: "#f5f5f5" });
+  var currentStyle = Object.assign({}, cellStyle, { background: "#fff8dc" });
+
+  function cell(value, style) {
+    return h("td", { style: style || cellStyle }, text(value));
+  }
+
+  // csvPreview renders a row as a labelled table, followed by the
+  // neighbouring rows from the pages of the CSV file's snapshot. The row is
+  // found by its decapta ID, or by its file name if the ID is empty.
+  function csvPreview(preview) {
+    var pages = {};
+    var ids = null;
+
+    function load(name) {
+      return fetch(preview.snapshot + "/" + name).then(function (response) {
+        return response.ok ? response.json() : null;
+      }).catch(function () {
+        return null;
+      });
+    }
+
+    function loadPage(page) {
+      pages[page] = pages[page] || load(page + ".json");
+      return pages[page];
+    }
+
+    function loadIDs() {
+      ids = ids || load("ids.json");
+      return ids;
+    }
+
+    function rowID(entry) {
+      return text(entry.getIn(["data", "slug"])) || text(entry.get("slug"));
+    }
+
+    return createClass({
+      getInitialState: function () {
+        return { fields: null, rows: {}, index: -1 };
+      },
+
+      componentDidMount: function () {
+        var self = this;
+        var id = rowID(this.props.entry);
+        var size = preview.page_size;
+        if (!preview.snapshot || !size || !id) {
+          return;
+        }
+        loadIDs().then(function (rowIDs) {
+          var index = rowIDs && Object.prototype.hasOwnProperty.call(rowIDs, id) ? rowIDs[id] : -1;
+          if (index < 0) {
+            return;
+          }
+          var first = Math.floor(Math.max(0, index - neighbours) / size);
+          var last = Math.floor((index + neighbours) / size);
+          var loads = [];
+          for (var page = first; page <= last; page++) {
+            loads.push(loadPage(page));
+          }
+          return Promise.all(loads).then(function (data) {
+            var fields = null;
+            var rows = {};
+            data.forEach(function (snapshot, i) {
+              if (!snapshot) {
+                return;
+              }
+              fields = snapshot.fields;
+              snapshot.rows.forEach(function (row, j) {
+                rows[(first + i) * size + j] = row;
+              });
+            });
+            self.setState({ fields: fields, rows: rows, index: index });
+          });
+        });
+      },
+
+      render: function () {
+        var entry = this.props.entry;
+        var fields = preview.fields || [];
+
+        var rows = fields.map(function (field) {
+          return h("tr", { key: field.name },
+            h("th", { style: headStyle }, field.label),
+            cell(entry.getIn(["data", field.name])));
+        });
+        var children = [h("table", { key: "row", style: tableStyle }, h("tbody", {}, rows))];
+
+        var snapshotFields = this.state.fields;
+        var snapshotRows = this.state.rows;
+        var index = this.state.index;
+        if (snapshotFields && index >= 0) {
+          var body = [];
+          for (var i = Math.max(0, index - neighbours); i <= index + neighbours; i++) {
+            var current = i === index;
+            var row = snapshotRows[i];
+            if (!current && !row) {
+              continue;
+            }
+            var values = fields.map(function (field) {
+              return current ? entry.getIn(["data", field.name]) : row[snapshotFields.indexOf(field.name)];
+            });
+            body.push(h("tr", { key: i },
+              h("th", { style: headStyle }, String(i + 1)),
+              values.map(function (value, column) {
+                return h("td", { key: column, style: current ? currentStyle : cellStyle }, text(value));
+              })));
+          }
+          children.push(h("h4", { key: "title", style: { fontFamily: "sans-serif" } }, "Neighbouring rows"));
+          children.push(h("table", { key: "neighbours", style: tableStyle },
+            h("thead", {}, h("tr", {},
+              h("th", { style: headStyle }, "#"),
+              fields.map(function (field) {
+                return h("th", { key: field.name, style: headStyle }, field.label);
+              }))),
+            h("tbody", {}, body)));
+        }
+
+        return h("div", {}, children);
+      },
+    });
+  }
+
+  // substitute replaces {placeholder} with the example value from the ARB
+  // metadata.
+  function substitute(value, metadata) {
+    var placeholders = (metadata && metadata.placeholders) || {};
+    return String(value).replace(/\{(\w+)\}/g, function (match, name) {
+      var placeholder = placeholders[name];
+      if (placeholder && placeholder.example !== undefined) {
+        return String(placeholder.example);
+      }
+      return match;
+    });
+  }
+
+  // arbPreview renders each translation with its placeholders substituted.
+  function arbPreview(preview) {
+    return createClass({
+      render: function () {
+        var data = plain(this.props.entry.get("data")) || {};
+        var rows = (preview.fields || []).map(function (field) {
+          var entry = data[field.name];
+          var value = entry && typeof entry === "object" ? entry.value : entry;
+          var metadata = entry && typeof entry === "object" ? entry.metadata : null;
+          return h("tr", { key: field.name },
+            h("th", { style: headStyle }, field.name),
+            cell(substitute(text(value), metadata)),
+            h("td", { style: Object.assign({}, cellStyle, { color: "#888" }) }, metadata && metadata.description || ""));
+        });
+        return h("table", { style: tableStyle }, h("tbody", {}, rows));
+      },
+    });
+  }
+
+  Object.keys(previews).forEach(function (name) {
+    var preview = previews[name];
+    var component = preview.type === "arb" ? arbPreview(preview) : csvPreview(preview);
+    CMS.registerPreviewTemplate(name, component);
+  });
+})();
@@ -0,0 +1,161 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readSnapshotPage(t *testing.T, dir string, page int) [][]string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, fmt.Sprintf("%d.json", page)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snapshot struct {
+		Fields []string   `json:"fields"`
+		Rows   [][]string `json:"rows"`
+	}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(snapshot.Fields, ",") != "id,name" {
+		t.Errorf("fields = %v", snapshot.Fields)
+	}
+	return snapshot.Rows
+}
+
+func TestCSVSnapshotPages(t *testing.T) {
+	root := t.TempDir()
+	csvDir := filepath.Join(root, "data")
+	contentDir := filepath.Join(root, "content")
+	config := filepath.Join(root, "admin", "config.yml")
+	snapshotDir := filepath.Join(root, "admin", "previews", "csv_items")
+	if err := os.MkdirAll(csvDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var csv strings.Builder
+	csv.WriteString("id,name\n")
+	for i := 1; i <= 2*previewPageSize+50; i++ {
+		fmt.Fprintf(&csv, "%d,item %d\n", i, i)
+	}
+	if err := os.WriteFile(filepath.Join(csvDir, "items.csv"), []byte(csv.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := CSVPreProcess(ctx, csvDir, contentDir, []string{"id"}, nil, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := CSVGenerateConfig(csvDir, config, []byte(testTemplate), []byte("<html></html>"), contentDir, nil, Options{PreviewSnapshot: true}); err != nil {
+		t.Fatal(err)
+	}
+	for page, want := range []int{previewPageSize, previewPageSize, 50} {
+		if rows := readSnapshotPage(t, snapshotDir, page); len(rows) != want {
+			t.Errorf("page %d has %d rows, want %d", page, len(rows), want)
+		}
+	}
+
+	// Post-process refreshes the snapshot with edited and removed rows
+	if err := os.WriteFile(filepath.Join(contentDir, "items", "2.yaml"), []byte("id: \"2\"\nname: edited\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for i := previewPageSize + 1; i <= 2*previewPageSize+50; i++ {
+		if err := os.Remove(filepath.Join(contentDir, "items", fmt.Sprintf("%d.yaml", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := CSVPostProcess(ctx, contentDir, csvDir, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	rows := readSnapshotPage(t, snapshotDir, 0)
+	if len(rows) != previewPageSize || rows[1][1] != "edited" {
+		t.Errorf("page 0 after post-process: %d rows, row 2 = %v", len(rows), rows[1])
+	}
+	for _, page := range []string{"1.json", "2.json"} {
+		if _, err := os.Stat(filepath.Join(snapshotDir, page)); !os.IsNotExist(err) {
+			t.Errorf("stale page %s: %v", page, err)
+		}
+	}
+
+	// Pre-process keeps the snapshot location for the next post-process
+	if err := CSVPreProcess(ctx, csvDir, contentDir, []string{"id"}, nil, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	layout, err := readColumnOrder(filepath.Join(contentDir, ".items.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if layout.Preview != snapshotDir {
+		t.Errorf("layout preview = %q, want %q", layout.Preview, snapshotDir)
+	}
+
+	// Without the option, the published snapshot is removed
+	if err := CSVGenerateConfig(csvDir, config, []byte(testTemplate), []byte("<html></html>"), contentDir, nil, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"0.json", previewIDs} {
+		if _, err := os.Stat(filepath.Join(snapshotDir, name)); !os.IsNotExist(err) {
+			t.Errorf("snapshot %s after disabling: %v", name, err)
+		}
+	}
+	if layout, err := readColumnOrder(filepath.Join(contentDir, ".items.yaml")); err != nil || layout.Preview != "" {
+		t.Errorf("layout preview after disabling = %q, %v", layout.Preview, err)
+	}
+}
+
+func TestCSVSnapshotIDs(t *testing.T) {
+	tests := []struct {
+		name string
+		slug []string
+		want map[string]int
+	}{
+		{"row numbers", nil, map[string]int{"1": 0, "2": 1, "3": 2}},
+		{"slug fields", []string{"code", "name"}, map[string]int{"b-x": 0, "a-y": 1, "a-": 2}},
+		{"first duplicate", []string{"code"}, map[string]int{"b": 0, "a": 1}},
+		{"missing slug field", []string{"id"}, map[string]int{"1": 0, "2": 1, "3": 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			csvPath := filepath.Join(dir, "items.csv")
+			if err := os.WriteFile(csvPath, []byte("code,name\nb,x\na,y\na,\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			snapshotDir := filepath.Join(dir, "snapshot")
+			if err := writeCSVSnapshot(DiskOutput{}, csvPath, snapshotDir, []string{"code", "name"}, tt.slug); err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(filepath.Join(snapshotDir, previewIDs))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids map[string]int
+			if err := json.Unmarshal(data, &ids); err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.want) {
+				t.Errorf("ids = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUnsupportedType is returned for data types without a processing module.
+var ErrUnsupportedType = errors.New("unsupported data type")
+
+// PreProcess runs the pre-process step of the module for dataType and
+// records the checksums of the written content files.
+func PreProcess(ctx context.Context, dataType string, dataDir string, contentDir string, slugFields, ignoredFiles []string, opts Options) error {
+	state := newStateOutput(opts.output(), contentDir)
+	opts.Output = state
+
+	var err error
+	switch dataType {
+	case "arb":
+		err = ARBPreProcess(ctx, dataDir, contentDir, opts)
+	case "csv":
+		err = CSVPreProcess(ctx, dataDir, contentDir, slugFields, ignoredFiles, opts)
+	case "json":
+		err = JSONPreProcess(ctx, dataDir, contentDir, slugFields, ignoredFiles, opts)
+	case "jsonl":
+		err = JSONLPreProcess(ctx, dataDir, contentDir, slugFields, ignoredFiles, opts)
+	case "toml":
+		err = TOMLPreProcess(ctx, dataDir, contentDir, slugFields, ignoredFiles, opts)
+	case "xlsx":
+		err = XLSXPreProcess(ctx, dataDir, contentDir, slugFields, ignoredFiles, opts)
+	case "yaml":
+		err = YAMLPreProcess(ctx, dataDir, contentDir, slugFields, ignoredFiles, opts)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedType, dataType)
+	}
+	if err != nil {
+		return err
+	}
+	if opts.Only != nil {
+		if err := removeDeletedContent(state, dataType, dataDir, contentDir, opts.Only); err != nil {
+			return err
+		}
+	}
+
+	return state.save()
+}
+
+// removeDeletedContent removes the content of the data files named in only
+// that no longer exist in dataDir, so they are not post-processed back.
+func removeDeletedContent(out Output, dataType string, dataDir string, contentDir string, only map[string]bool) error {
+	for name := range only {
+		if _, err := os.Stat(filepath.Join(dataDir, name)); !errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		// The content entry of a data file, as named by pre-process
+		var entry string
+		switch dataType {
+		case "arb":
+			if strings.HasSuffix(name, ".arb") {
+				entry = extractLanguage(name)
+			}
+		case "csv":
+			entry = strings.TrimSuffix(name, ".csv")
+			if entry == name {
+				entry = ""
+			}
+		default:
+			if f, ok := recordFormats[dataType]; ok {
+				entry, _, _ = f.dataName(name)
+			}
+		}
+		if entry == "" {
+			continue
+		}
+
+		var paths []string
+		for _, file := range []string{entry + ".yaml", "." + entry + ".yaml"} {
+			if _, err := os.Stat(filepath.Join(contentDir, file)); err == nil {
+				paths = append(paths, filepath.Join(contentDir, file))
+			}
+		}
+		dir := filepath.Join(contentDir, entry)
+		var dirs []string
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				dirs = append(dirs, path)
+			} else {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("error reading content directory %s: %v", dir, err)
+		}
+
+		for _, path := range paths {
+			if err := out.Remove(path); err != nil {
+				return fmt.Errorf("error removing content file %s: %v", path, err)
+			}
+		}
+		// Directories are left in place if files are kept, as in a dry run
+		for i := len(dirs) - 1; i >= 0; i-- {
+			if entries, err := os.ReadDir(dirs[i]); err == nil && len(entries) == 0 {
+				if err := os.Remove(dirs[i]); err != nil {
+					return fmt.Errorf("error removing content directory %s: %v", dirs[i], err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// PostProcess runs the post-process step of the module for dataType. The
+// processed content is then recorded as unchanged.
+func PostProcess(ctx context.Context, dataType string, contentDir string, dataDir string, opts Options) error {
+	if opts.OnlyChanged {
+		changes, err := DetectChanges(ctx, contentDir, opts.Since)
+		if err != nil {
+			return err
+		}
+		opts.Only = ChangedEntries(changes)
+		if len(opts.Only) == 0 {
+			return nil
+		}
+	}
+
+	var err error
+	switch dataType {
+	case "arb":
+		err = ARBPostProcess(ctx, contentDir, dataDir, opts)
+	case "csv":
+		err = CSVPostProcess(ctx, contentDir, dataDir, opts)
+	case "json":
+		err = JSONPostProcess(ctx, contentDir, dataDir, opts)
+	case "jsonl":
+		err = JSONLPostProcess(ctx, contentDir, dataDir, opts)
+	case "toml":
+		err = TOMLPostProcess(ctx, contentDir, dataDir, opts)
+	case "xlsx":
+		err = XLSXPostProcess(ctx, contentDir, dataDir, opts)
+	case "yaml":
+		err = YAMLPostProcess(ctx, contentDir, dataDir, opts)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedType, dataType)
+	}
+	if err != nil {
+		return err
+	}
+
+	return recordState(opts.output(), contentDir, opts.Only)
+}
+
+// GenerateConfig runs the config step of the module for dataType.
+func GenerateConfig(dataType string, dataDir string, outputFile string, templateData, indexHTML []byte, contentDir string, ignoredFiles []string, opts Options) error {
+	switch dataType {
+	case "arb":
+		return ARBGenerateConfig(dataDir, outputFile, templateData, indexHTML, contentDir, opts)
+	case "csv":
+		return CSVGenerateConfig(dataDir, outputFile, templateData, indexHTML, contentDir, ignoredFiles, opts)
+	case "json":
+		return JSONGenerateConfig(dataDir, outputFile, templateData, indexHTML, contentDir, ignoredFiles, opts)
+	case "jsonl":
+		return JSONLGenerateConfig(dataDir, outputFile, templateData, indexHTML, contentDir, ignoredFiles, opts)
+	case "toml":
+		return TOMLGenerateConfig(dataDir, outputFile, templateData, indexHTML, contentDir, ignoredFiles, opts)
+	case "xlsx":
+		return XLSXGenerateConfig(dataDir, outputFile, templateData, indexHTML, contentDir, ignoredFiles, opts)
+	case "yaml":
+		return YAMLGenerateConfig(dataDir, outputFile, templateData, indexHTML, contentDir, ignoredFiles, opts)
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedType, dataType)
+	}
+}
@@ -0,0 +1,924 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// layoutKindMap marks data files holding a single mapping rather than a list
+// of records, edited as a file collection.
+const layoutKindMap = "map"
+
+// recordFormat reads and writes data files holding a list of records, such
+// as a JSON array of objects. Each record becomes a content file, like a CSV
+// row. A data file holding a single mapping has a single content file named
+// after the data file.
+type recordFormat struct {
+	// Name is the data type, used to name collections.
+	Name string
+	// Label names the format in collection labels and errors.
+	Label string
+	// Extensions are the file extensions of data files, the first is the
+	// default.
+	Extensions []string
+	// Decode returns the records of a data file and the layout to restore it.
+	Decode func(data []byte) ([]OrderedMap, dataLayout, error)
+	// Encode writes records back in the layout of the original file, which is
+	// nil if there is none.
+	Encode func(records []OrderedMap, layout dataLayout, original []byte) ([]byte, error)
+}
+
+// dataName returns the name of a data file without its extension, and the
+// extension. ok is false for files of other formats.
+func (f recordFormat) dataName(file string) (name string, ext string, ok bool) {
+	for _, ext := range f.Extensions {
+		if strings.HasSuffix(file, ext) && len(file) > len(ext) {
+			return strings.TrimSuffix(file, ext), ext, true
+		}
+	}
+	return "", "", false
+}
+
+// dataFile returns the path of the data file recorded in layout.
+func (f recordFormat) dataFile(dataDir string, dataName string, layout dataLayout) string {
+	ext := layout.Extension
+	if ext == "" {
+		ext = f.Extensions[0]
+	}
+	return filepath.Join(dataDir, dataName+ext)
+}
+
+// dataFiles lists the data files of a format in dataDir.
+func (f recordFormat) dataFiles(dataDir string, ignoredFiles []string) ([]string, error) {
+	files, err := os.ReadDir(dataDir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s directory: %v", f.Label, err)
+	}
+
+	var names []string
+	for _, file := range files {
+		if file.IsDir() || contains(ignoredFiles, file.Name()) {
+			continue
+		}
+		if _, _, ok := f.dataName(file.Name()); ok {
+			names = append(names, file.Name())
+		}
+	}
+	return names, nil
+}
+
+func (f recordFormat) readFile(path string) ([]OrderedMap, dataLayout, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, dataLayout{}, fmt.Errorf("error reading %s file %s: %v", f.Label, path, err)
+	}
+	records, layout, err := f.Decode(data)
+	if err != nil {
+		return nil, dataLayout{}, fmt.Errorf("error parsing %s file %s: %v", f.Label, path, err)
+	}
+	return records, layout, nil
+}
+
+// recordsPreProcess creates a content file per record of each data file.
+func recordsPreProcess(ctx context.Context, f recordFormat, dataDir string, contentDir string, slugFields, ignoredFiles []string, opts Options) error {
+	files, err := f.dataFiles(dataDir, ignoredFiles)
+	if err != nil {
+		return err
+	}
+
+	p := newPool(ctx, opts.Jobs)
+	for i, name := range files {
+		if opts.Only != nil && !opts.Only[name] {
+			continue
+		}
+
+		path := filepath.Join(dataDir, name)
+		p.Go(i, func(ctx context.Context) error {
+			return recordsPreProcessFile(ctx, f, path, contentDir, slugFields, opts)
+		})
+	}
+
+	return p.Wait()
+}
+
+func recordsPreProcessFile(ctx context.Context, f recordFormat, path string, contentDir string, slugFields []string, opts Options) error {
+	records, layout, err := f.readFile(path)
+	if err != nil {
+		return err
+	}
+
+	nameOfKey := layout.setColumns(records, opts.Reserved)
+	dataName, ext, _ := f.dataName(filepath.Base(path))
+	if ext != f.Extensions[0] {
+		layout.Extension = ext
+	}
+	dataContentDir := filepath.Join(contentDir, dataName)
+	layoutFilePath := filepath.Join(contentDir, fmt.Sprintf(".%s.yaml", dataName))
+	out := opts.output()
+
+	if layout.Kind == layoutKindMap {
+		if err := writeContentFile(out, dataContentDir+".yaml", renameKeys(records[0], nameOfKey)); err != nil {
+			return err
+		}
+	} else if err := writeRecords(ctx, out, dataContentDir, records, nameOfKey, slugFields, opts.Jobs); err != nil {
+		return err
+	}
+
+	if err := writeColumnOrder(out, layout, layoutFilePath); err != nil {
+		return fmt.Errorf("error writing layout to file %s: %v", layoutFilePath, err)
+	}
+	return nil
+}
+
+// setColumns records the keys of records and their field names, which it
+// returns by key. The field names of the keys of nested objects are returned
+// by the path of keys to them, see nestedPath.
+func (layout *dataLayout) setColumns(records []OrderedMap, reserved []string) map[string]string {
+	keys := recordKeys(records)
+	names := fieldNames(keys, reserved)
+	nameOfKey := make(map[string]string, len(keys))
+	for i, key := range keys {
+		nameOfKey[key] = names[i]
+	}
+
+	layout.Columns = names
+	layout.Headers = nil
+	for i, key := range keys {
+		if key != names[i] {
+			layout.Headers = keys
+			break
+		}
+	}
+
+	layout.Nested = nil
+	layout.setNested(nil, records, nameOfKey)
+	return nameOfKey
+}
+
+// setNested records the keys of the nested objects of objects that differ
+// from their field names.
+func (layout *dataLayout) setNested(path []string, objects []OrderedMap, nameOfKey map[string]string) {
+	for _, key := range recordKeys(objects) {
+		children := nestedObjects(recordValues(objects, key))
+		if len(children) == 0 {
+			continue
+		}
+		childPath := append(path[:len(path):len(path)], key)
+		keys := recordKeys(children)
+		for i, name := range nestedFieldNames(keys) {
+			if keys[i] != name {
+				keyPath := append(childPath[:len(childPath):len(childPath)], keys[i])
+				nameOfKey[nestedPath(keyPath)] = name
+				layout.Nested = append(layout.Nested, nestedKey{Path: keyPath, Name: name})
+			}
+		}
+		layout.setNested(childPath, children, nameOfKey)
+	}
+}
+
+// nestedFieldNames maps the keys of nested objects to field names. Reserved
+// names only concern the top-level fields of a collection.
+func nestedFieldNames(keys []string) []string {
+	return fieldNames(keys, []string{})
+}
+
+// nestedObjects returns the objects among values and the items of arrays
+// among them.
+func nestedObjects(values []interface{}) []OrderedMap {
+	var objects []OrderedMap
+	for _, value := range values {
+		switch v := value.(type) {
+		case OrderedMap:
+			objects = append(objects, v)
+		case []interface{}:
+			for _, item := range v {
+				if object, ok := item.(OrderedMap); ok {
+					objects = append(objects, object)
+				}
+			}
+		}
+	}
+	return objects
+}
+
+// nestedPath joins a path of keys to a nested key.
+func nestedPath(path []string) string {
+	return strings.Join(path, "\x00")
+}
+
+// renameNested renames the keys of the nested objects of a value at a path
+// of keys to field names.
+func renameNested(path []string, value interface{}, nameOfKey map[string]string) interface{} {
+	switch v := value.(type) {
+	case OrderedMap:
+		renamed := make(OrderedMap, len(v))
+		for i, kv := range v {
+			keyPath := append(path[:len(path):len(path)], kv.Key)
+			name, ok := nameOfKey[nestedPath(keyPath)]
+			if !ok {
+				name = kv.Key
+			}
+			renamed[i] = KVPair{Key: name, Value: renameNested(keyPath, kv.Value, nameOfKey)}
+		}
+		return renamed
+	case []interface{}:
+		renamed := make([]interface{}, len(v))
+		for i, item := range v {
+			renamed[i] = renameNested(path, item, nameOfKey)
+		}
+		return renamed
+	default:
+		return value
+	}
+}
+
+// restoreNested renames the field names of the nested objects of a value at
+// a path of keys back to their keys.
+func restoreNested(path []string, value interface{}, keyOfName map[string]string) interface{} {
+	switch v := value.(type) {
+	case OrderedMap:
+		restored := make(OrderedMap, len(v))
+		for i, kv := range v {
+			key, ok := keyOfName[nestedPath(append(path[:len(path):len(path)], kv.Key))]
+			if !ok {
+				key = kv.Key
+			}
+			keyPath := append(path[:len(path):len(path)], key)
+			restored[i] = KVPair{Key: key, Value: restoreNested(keyPath, kv.Value, keyOfName)}
+		}
+		return restored
+	case []interface{}:
+		restored := make([]interface{}, len(v))
+		for i, item := range v {
+			restored[i] = restoreNested(path, item, keyOfName)
+		}
+		return restored
+	default:
+		return value
+	}
+}
+
+// renameKeys returns a record with its keys renamed to field names.
+func renameKeys(record OrderedMap, nameOfKey map[string]string) OrderedMap {
+	content := make(OrderedMap, 0, len(record))
+	for _, kv := range record {
+		content = append(content, KVPair{Key: nameOfKey[kv.Key], Value: renameNested([]string{kv.Key}, kv.Value, nameOfKey)})
+	}
+	return content
+}
+
+// writeRecords writes a content file per record into dir, 1.yaml to n.yaml,
+// and removes stale content files.
+func writeRecords(ctx context.Context, out Output, dir string, records []OrderedMap, nameOfKey map[string]string, slugFields []string, jobs int) error {
+	p := newPool(ctx, jobs)
+	for i, record := range records {
+		if p.Done() {
+			break
+		}
+
+		data := make(map[string]interface{}, len(record))
+		for _, kv := range record {
+			data[kv.Key] = kv.Value
+		}
+
+		// The decapta ID first, then the keys of the record in their order
+		content := make(OrderedMap, 0, len(record)+1)
+		content = append(content, KVPair{Key: decaptaIDField, Value: generateIdentifierField(data, slugFields)})
+		for _, kv := range record {
+			content = append(content, KVPair{Key: nameOfKey[kv.Key], Value: renameNested([]string{kv.Key}, kv.Value, nameOfKey)})
+		}
+
+		filename := filepath.Join(dir, fmt.Sprintf("%d.yaml", i+1))
+		p.Go(i+1, func(ctx context.Context) error {
+			return writeContentFile(out, filename, content)
+		})
+	}
+
+	if err := p.Wait(); err != nil {
+		return err
+	}
+
+	return removeStaleRows(out, dir, len(records))
+}
+
+// recordList returns the objects of an array value, such as the records of
+// a mapping entry.
+func recordList(value interface{}) []OrderedMap {
+	array, _ := value.([]interface{})
+	records := make([]OrderedMap, 0, len(array))
+	for _, item := range array {
+		if record, ok := item.(OrderedMap); ok {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// recordKeys returns the keys of all records in order of first appearance.
+func recordKeys(records []OrderedMap) []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, record := range records {
+		for _, kv := range record {
+			if !seen[kv.Key] {
+				seen[kv.Key] = true
+				keys = append(keys, kv.Key)
+			}
+		}
+	}
+	return keys
+}
+
+// recordsPostProcess recreates the data files from the content files. Data
+// files are only replaced once every file has been written successfully.
+func recordsPostProcess(ctx context.Context, f recordFormat, contentDir string, dataDir string, opts Options) error {
+	dirs, err := os.ReadDir(contentDir)
+	if err != nil {
+		return fmt.Errorf("error reading content directory: %v", err)
+	}
+
+	out := opts.Output
+	var tx *Transaction
+	if out == nil {
+		tx, err = NewTransaction(dataDir)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		out = tx
+	}
+
+	p := newPool(ctx, opts.Jobs)
+	for i, dir := range dirs {
+		if !dir.IsDir() {
+			if isMapContentFile(contentDir, dir.Name()) && (opts.Only == nil || opts.Only[dir.Name()] || opts.Only[strings.TrimSuffix(dir.Name(), ".yaml")]) {
+				dataName := strings.TrimSuffix(dir.Name(), ".yaml")
+				p.Go(i, func(ctx context.Context) error {
+					return recordsPostProcessFile(f, contentDir, dataName, dataDir, out)
+				})
+			}
+			continue
+		}
+		if opts.Only != nil && !opts.Only[dir.Name()] {
+			continue
+		}
+
+		dataName := dir.Name()
+		p.Go(i, func(ctx context.Context) error {
+			return recordsPostProcessDir(ctx, f, contentDir, dataName, dataDir, out)
+		})
+	}
+
+	if err := p.Wait(); err != nil {
+		return err
+	}
+
+	if tx != nil {
+		return tx.Commit()
+	}
+	return nil
+}
+
+// recordsPostProcessDir writes the data file of a single content directory.
+// Values that were not edited keep their original formatting, and records
+// their original key order.
+func recordsPostProcessDir(ctx context.Context, f recordFormat, contentDir string, dataName string, dataDir string, out Output) error {
+	dataContentDir := filepath.Join(contentDir, dataName)
+
+	files, err := os.ReadDir(dataContentDir)
+	if err != nil {
+		return fmt.Errorf("error reading %s content directory %s: %v", f.Label, dataContentDir, err)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return extractFileNumber(files[i].Name()) < extractFileNumber(files[j].Name())
+	})
+
+	layout, keyOfName, err := readRecordLayout(contentDir, dataName)
+	if err != nil {
+		return err
+	}
+	dataFilePath := f.dataFile(dataDir, dataName, layout)
+	original, originals := f.readOriginal(dataFilePath)
+
+	records, err := readRecords(ctx, dataContentDir, files, keyOfName, originals)
+	if err != nil {
+		return err
+	}
+	return f.writeFile(out, dataFilePath, records, layout, original)
+}
+
+// readRecords reads the content files of dir, sorted by row number, as
+// records restored against the original records of their rows.
+func readRecords(ctx context.Context, dir string, files []os.DirEntry, keyOfName map[string]string, originals []OrderedMap) ([]OrderedMap, error) {
+	var records []OrderedMap
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), ".yaml") {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		edited, err := readRecord(filepath.Join(dir, file.Name()), keyOfName)
+		if err != nil {
+			return nil, err
+		}
+
+		var originalRecord OrderedMap
+		if row := extractFileNumber(file.Name()); row >= 1 && row <= len(originals) {
+			originalRecord = originals[row-1]
+		}
+		records = append(records, restoreRecord(edited, originalRecord))
+	}
+	return records, nil
+}
+
+// recordsPostProcessFile writes the data file of a content file holding a
+// single mapping.
+func recordsPostProcessFile(f recordFormat, contentDir string, dataName string, dataDir string, out Output) error {
+	layout, keyOfName, err := readRecordLayout(contentDir, dataName)
+	if err != nil {
+		return err
+	}
+	dataFilePath := f.dataFile(dataDir, dataName, layout)
+	original, originals := f.readOriginal(dataFilePath)
+
+	edited, err := readRecord(filepath.Join(contentDir, dataName+".yaml"), keyOfName)
+	if err != nil {
+		return err
+	}
+	var originalRecord OrderedMap
+	if len(originals) == 1 {
+		originalRecord = originals[0]
+	}
+
+	return f.writeFile(out, dataFilePath, []OrderedMap{restoreRecord(edited, originalRecord)}, layout, original)
+}
+
+// isMapContentFile reports whether a file in contentDir is the content file
+// of a data file holding a single mapping.
+func isMapContentFile(contentDir string, name string) bool {
+	if strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".yaml") {
+		return false
+	}
+	layout, err := readColumnOrder(filepath.Join(contentDir, "."+name))
+	return err == nil && layout.Kind == layoutKindMap
+}
+
+// readRecordLayout reads the layout of a data file and maps field names back
+// to the original keys.
+func readRecordLayout(contentDir string, dataName string) (dataLayout, map[string]string, error) {
+	layoutFilePath := filepath.Join(contentDir, fmt.Sprintf(".%s.yaml", dataName))
+	layout, err := readColumnOrder(layoutFilePath)
+	if err != nil {
+		return layout, nil, fmt.Errorf("error reading layout from file %s: %v", layoutFilePath, err)
+	}
+	return layout, layout.keyOfName(), nil
+}
+
+// keyOfName maps the field names of the layout back to the original keys.
+// Field names of nested objects are mapped by the path of keys to their
+// object followed by the name.
+func (layout dataLayout) keyOfName() map[string]string {
+	keyOfName := make(map[string]string, len(layout.Columns)+len(layout.Nested))
+	for i, name := range layout.Columns {
+		keyOfName[name] = name
+		if len(layout.Headers) == len(layout.Columns) {
+			keyOfName[name] = layout.Headers[i]
+		}
+	}
+	for _, nested := range layout.Nested {
+		last := len(nested.Path) - 1
+		keyOfName[nestedPath(append(nested.Path[:last:last], nested.Name))] = nested.Path[last]
+	}
+	return keyOfName
+}
+
+// readRecord reads a content file as a record with the original keys.
+func readRecord(path string, keyOfName map[string]string) (OrderedMap, error) {
+	yamlContent, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading YAML file %s: %v", path, err)
+	}
+	var content OrderedMap
+	if err := yaml.Unmarshal(yamlContent, &content); err != nil {
+		return nil, fmt.Errorf("error unmarshaling YAML file %s: %v", path, err)
+	}
+
+	record := make(OrderedMap, 0, len(content))
+	for _, kv := range content {
+		if kv.Key == decaptaIDField {
+			continue
+		}
+		key, ok := keyOfName[kv.Key]
+		if !ok {
+			key = kv.Key
+		}
+		record = append(record, KVPair{Key: key, Value: restoreNested([]string{key}, kv.Value, keyOfName)})
+	}
+	return record, nil
+}
+
+// readOriginal reads the data file being replaced. A missing or unparsable
+// original only loses formatting.
+func (f recordFormat) readOriginal(path string) ([]byte, []OrderedMap) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil
+	}
+	records, _, err := f.Decode(data)
+	if err != nil {
+		return nil, nil
+	}
+	return data, records
+}
+
+func (f recordFormat) writeFile(out Output, path string, records []OrderedMap, layout dataLayout, original []byte) error {
+	data, err := f.Encode(records, layout, original)
+	if err != nil {
+		return fmt.Errorf("error generating %s file %s: %v", f.Label, path, err)
+	}
+	if err := out.WriteFile(path, data); err != nil {
+		return fmt.Errorf("error writing %s file %s: %v", f.Label, path, err)
+	}
+	return nil
+}
+
+// restoreRecord returns an edited record in the key order of the original,
+// with new keys last. Unchanged values keep their original formatting, such
+// as the digits of a number, and empty values the CMS added for keys the
+// original did not have are dropped. Records without an original are kept
+// as edited.
+func restoreRecord(edited, original OrderedMap) OrderedMap {
+	if original == nil {
+		return edited
+	}
+	restored := make(OrderedMap, 0, len(edited))
+	for _, kv := range original {
+		value, ok := edited.Get(kv.Key)
+		if !ok {
+			continue
+		}
+		restored = append(restored, KVPair{Key: kv.Key, Value: restoreValue(value, kv.Value)})
+	}
+	for _, kv := range edited {
+		if _, ok := original.Get(kv.Key); ok || isEmptyValue(kv.Value) {
+			continue
+		}
+		restored = append(restored, kv)
+	}
+	return restored
+}
+
+// isEmptyValue reports whether a value is null, an empty string or array, or
+// an object of empty values, as the CMS writes for fields left blank.
+func isEmptyValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case OrderedMap:
+		for _, kv := range v {
+			if !isEmptyValue(kv.Value) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+func restoreValue(edited, original interface{}) interface{} {
+	// The datetime widget writes strings
+	if originalTime, ok := original.(time.Time); ok {
+		if s, ok := edited.(string); ok {
+			if t, err := parseDate(s); err == nil {
+				edited = t
+			} else if t, err := time.Parse(tomlTimeFormat, s); err == nil && originalTime.Location() == tomlLocalTime {
+				edited = t
+			}
+		}
+		// Edited times keep the time zone of the original
+		if t, ok := edited.(time.Time); ok {
+			edited = t.In(originalTime.Location())
+		}
+	}
+	if valuesEqual(edited, original) {
+		return original
+	}
+	// Edited numbers keep the type of the original, the number widget writes
+	// 2 for 2.0
+	if originalNumber, ok := original.(json.Number); ok && strings.ContainsAny(string(originalNumber), ".eE") {
+		if n, ok := edited.(json.Number); ok && !strings.ContainsAny(string(n), ".eE") {
+			edited = n + ".0"
+		}
+	}
+	editedMap, ok1 := edited.(OrderedMap)
+	originalMap, ok2 := original.(OrderedMap)
+	if ok1 && ok2 {
+		return restoreRecord(editedMap, originalMap)
+	}
+	return edited
+}
+
+// valuesEqual compares decoded values, ignoring key order and number
+// formatting.
+func valuesEqual(a, b interface{}) bool {
+	switch av := a.(type) {
+	case OrderedMap:
+		bv, ok := b.(OrderedMap)
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for _, kv := range av {
+			value, ok := bv.Get(kv.Key)
+			if !ok || !valuesEqual(kv.Value, value) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok || len(av) != len(bv) {
+			return false
+		}
+		for i := range av {
+			if !valuesEqual(av[i], bv[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		bv, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if av == bv {
+			return true
+		}
+		f1, err1 := av.Float64()
+		f2, err2 := bv.Float64()
+		return err1 == nil && err2 == nil && f1 == f2
+	case time.Time:
+		bv, ok := b.(time.Time)
+		return ok && av.Equal(bv)
+	default:
+		return a == b
+	}
+}
+
+// recordsGenerateConfig generates a folder collection per data file, with
+// fields inferred from all records, which may have different keys.
+func recordsGenerateConfig(f recordFormat, dataDir string, outputFile string, templateData, indexHTML []byte, contentDir string, ignoredFiles []string, opts Options) error {
+	files, err := f.dataFiles(dataDir, ignoredFiles)
+	if err != nil {
+		return err
+	}
+
+	var collections []Collection
+	for _, name := range files {
+		records, layout, err := f.readFile(filepath.Join(dataDir, name))
+		if err != nil {
+			return err
+		}
+		dataName, _, _ := f.dataName(name)
+
+		collectionName := fmt.Sprintf("%s_%s", f.Name, dataName)
+		label := fmt.Sprintf("%s Data (%s)", f.Label, dataName)
+		if layout.Kind == layoutKindMap {
+			collections = append(collections, fileCollection(collectionName, label, dataName, filepath.Join(contentDir, dataName+".yaml"), records[0], opts))
+			continue
+		}
+		collections = append(collections, folderCollection(collectionName, label, filepath.Join(contentDir, dataName), records, opts))
+	}
+
+	err = writeCollections(collections, map[string]preview{}, templateData, indexHTML, outputFile, opts)
+	if err != nil {
+		return fmt.Errorf("error writing config: %v", err)
+	}
+	return nil
+}
+
+// recordFields returns a field per key of records, named as in content files.
+func recordFields(records []OrderedMap, reserved []string) []Field {
+	var fields []Field
+	keys := recordKeys(records)
+	names := fieldNames(keys, reserved)
+	for i, key := range keys {
+		field := inferField(names[i], key, recordValues(records, key))
+		field.Required = boolPtr(false)
+		field.header = key
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// folderCollection returns the collection of a list of records, with a
+// content file per record in folder.
+func folderCollection(name string, label string, folder string, records []OrderedMap, opts Options) Collection {
+	fields := []Field{{
+		Label:  "Decapta ID",
+		Name:   decaptaIDField,
+		Widget: "string",
+	}}
+	fields = append(fields, recordFields(records, opts.Reserved)...)
+
+	collection := Collection{
+		Name:            name,
+		Label:           label,
+		Slug:            "{{slug}}",
+		Folder:          folder,
+		Create:          true,
+		Extension:       "yaml",
+		Format:          "yaml",
+		IdentifierField: decaptaIDField,
+		Fields:          fields,
+	}
+	// Fields are inferred from all records, the list view from a sample
+	sample := records
+	if len(sample) > typeDetectionSampleSize {
+		sample = sample[:typeDetectionSampleSize]
+	}
+	opts.ListView.apply(&collection, fields[1:], recordSample(sample, recordKeys(records)))
+	return collection
+}
+
+// fileCollection returns the collection of a single mapping, edited in the
+// content file file.
+func fileCollection(name string, label string, fileName string, file string, record OrderedMap, opts Options) Collection {
+	return Collection{
+		Name:  name,
+		Label: label,
+		Files: []File{{
+			Name:   fileName,
+			Label:  fileName,
+			File:   file,
+			Fields: recordFields([]OrderedMap{record}, opts.Reserved),
+		}},
+	}
+}
+
+// recordValues returns the values of key in the records that have it.
+func recordValues(records []OrderedMap, key string) []interface{} {
+	var values []interface{}
+	for _, record := range records {
+		if value, ok := record.Get(key); ok {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// recordSample formats the scalar values of records as rows for the list
+// view, with a column per key.
+func recordSample(records []OrderedMap, keys []string) [][]string {
+	sample := make([][]string, len(records))
+	for i, record := range records {
+		row := make([]string, len(keys))
+		for j, key := range keys {
+			value, _ := record.Get(key)
+			switch value.(type) {
+			case OrderedMap, []interface{}:
+			default:
+				row[j] = formatCell(value)
+			}
+		}
+		sample[i] = row
+	}
+	return sample
+}
+
+// inferField returns the widget for the values of a key: nested objects
+// become object widgets and arrays list widgets. Values of mixed types are
+// edited as strings.
+func inferField(name string, label string, values []interface{}) Field {
+	field := Field{Label: label, Name: name, Widget: "string"}
+
+	var kind string
+	var present []interface{}
+	for _, value := range values {
+		if value == nil {
+			continue
+		}
+		valueKind := jsonTypeName(value)
+		if kind != "" && valueKind != kind {
+			return field
+		}
+		kind = valueKind
+		present = append(present, value)
+	}
+
+	switch kind {
+	case "boolean":
+		field.Widget = "boolean"
+	case "number":
+		field.Widget = "number"
+		field.ValueType = "int"
+		for _, value := range present {
+			if _, err := value.(json.Number).Int64(); err != nil {
+				field.ValueType = "float"
+			}
+		}
+	case "datetime":
+		field.Widget = "datetime"
+		dates, times := true, true
+		for _, value := range present {
+			dates = dates && isDate(value.(time.Time))
+			times = times && value.(time.Time).Location() == tomlLocalTime
+		}
+		switch {
+		case times:
+			field.Format = "HH:mm:ss"
+			field.DateFormat = false
+		case dates:
+			field.Format = "YYYY-MM-DD"
+			field.TimeFormat = false
+		}
+	case "string":
+		for _, value := range present {
+			if strings.Contains(value.(string), "\n") {
+				field.Widget = "markdown"
+				field.Modes = []string{"raw"}
+			}
+		}
+	case "object":
+		objects := make([]OrderedMap, len(present))
+		for i, value := range present {
+			objects[i] = value.(OrderedMap)
+		}
+		field.Widget = "object"
+		field.Fields = inferFields(objects)
+		if len(field.Fields) == 0 {
+			field.Widget = "string"
+		}
+	case "array":
+		var items []interface{}
+		for _, value := range present {
+			items = append(items, value.([]interface{})...)
+		}
+		field.Widget = "list"
+		if objects, ok := allObjects(items); ok {
+			field.Fields = inferFields(objects)
+		} else {
+			item := inferField("item", "Item", items)
+			field.Field = &item
+		}
+	}
+	return field
+}
+
+// inferFields returns the fields of nested objects, named as in content
+// files and labelled by their keys.
+func inferFields(objects []OrderedMap) []Field {
+	var fields []Field
+	keys := recordKeys(objects)
+	names := nestedFieldNames(keys)
+	for i, key := range keys {
+		field := inferField(names[i], key, recordValues(objects, key))
+		field.Required = boolPtr(false)
+		field.header = key
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+func allObjects(items []interface{}) ([]OrderedMap, bool) {
+	if len(items) == 0 {
+		return nil, false
+	}
+	objects := make([]OrderedMap, len(items))
+	for i, item := range items {
+		object, ok := item.(OrderedMap)
+		if !ok {
+			return nil, false
+		}
+		objects[i] = object
+	}
+	return objects, true
+}
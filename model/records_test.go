@@ -0,0 +1,197 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const nestedJSON = `[
+  {
+    "id": 1,
+    "meta": {
+      "a.b": "dotted",
+      "first name": "Ann",
+      "x/y": {
+        "in stock": true
+      }
+    },
+    "links": [
+      {
+        "link text": "Home"
+      }
+    ]
+  }
+]
+`
+
+func TestNestedKeysRoundTrip(t *testing.T) {
+	root := t.TempDir()
+	dataDir := filepath.Join(root, "data")
+	contentDir := filepath.Join(root, "content")
+	config := filepath.Join(root, "admin", "config.yml")
+	dataFile := filepath.Join(dataDir, "items.json")
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(dataFile, []byte(nestedJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if err := JSONPreProcess(ctx, dataDir, contentDir, nil, nil, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	contentFile := filepath.Join(contentDir, "items", "1.yaml")
+	content, err := os.ReadFile(contentFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a_b:", "first_name:", "x_y:", "in_stock:", "link_text:"} {
+		if !strings.Contains(string(content), name) {
+			t.Errorf("content file has no %s:\n%s", name, content)
+		}
+	}
+
+	// Config fields are named as in the content file
+	if err := JSONGenerateConfig(dataDir, config, []byte(testTemplate), []byte("<html></html>"), contentDir, nil, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	var collect func(fields []Field)
+	collect = func(fields []Field) {
+		for _, field := range fields {
+			names = append(names, field.Name)
+			collect(field.Fields)
+		}
+	}
+	collections := readCollections(t, config)
+	collect(collections[len(collections)-1].Fields)
+	if got := strings.Join(names, ","); got != "slug,id,meta,a_b,first_name,x_y,in_stock,links,link_text" {
+		t.Errorf("fields = %s", got)
+	}
+
+	// Post-process restores the keys, for edited values too
+	edited := strings.Replace(string(content), "Ann", "Bea", 1)
+	if err := os.WriteFile(contentFile, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := JSONPostProcess(ctx, contentDir, dataDir, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(dataFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Replace(nestedJSON, "Ann", "Bea", 1); string(got) != want {
+		t.Errorf("post-process wrote:\n%s\nwant:\n%s", got, want)
+	}
+
+	var layout dataLayout
+	layoutData, err := os.ReadFile(filepath.Join(contentDir, ".items.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal(layoutData, &layout); err != nil {
+		t.Fatal(err)
+	}
+	if len(layout.Nested) != 5 {
+		t.Errorf("layout records %d nested keys, want 5: %+v", len(layout.Nested), layout.Nested)
+	}
+}
+
+func TestJSONLRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		edit  func(content string) string
+		want  string
+		error string
+	}{
+		{name: "records", data: "{\"id\":1,\"name\":\"Ann\"}\n{\"id\":2,\"name\":\"Bob\"}\n"},
+		{name: "different keys", data: "{\"id\":1,\"tags\":[\"a\",\"b\"]}\n{\"name\":\"Bob\",\"id\":2}\n"},
+		{name: "numbers and HTML", data: "{\"price\":1.50,\"big\":12345678901234567890,\"note\":\"<b>&</b>\",\"none\":null}\n"},
+		{name: "nested objects", data: "{\"id\":1,\"meta\":{\"first name\":\"Ann\",\"x\":{\"y\":true}}}\n"},
+		{name: "CRLF", data: "{\"id\":1}\r\n{\"id\":2}\r\n"},
+		{name: "no final newline", data: "{\"id\":1}\n{\"id\":2}"},
+		{name: "blank lines", data: "{\"id\":1}\n\n  \n{\"id\":2}\n", want: "{\"id\":1}\n{\"id\":2}\n"},
+		{
+			name: "edited value",
+			data: "{\"id\":1,\"name\":\"Ann\",\"price\":1.50}\n",
+			edit: func(content string) string { return strings.Replace(content, "Ann", "Bea", 1) },
+			want: "{\"id\":1,\"name\":\"Bea\",\"price\":1.50}\n",
+		},
+		{name: "not an object", data: "{\"id\":1}\n[1]\n", error: "line 2: expected an object"},
+		{name: "invalid JSON", data: "{\"id\":1}\n\n{\"id\":\n", error: "line 3:"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			dataDir := filepath.Join(root, "data")
+			contentDir := filepath.Join(root, "content")
+			dataFile := filepath.Join(dataDir, "items.jsonl")
+			if err := os.MkdirAll(dataDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(dataFile, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.Background()
+			err := JSONLPreProcess(ctx, dataDir, contentDir, nil, nil, Options{})
+			if tt.error != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.error) {
+					t.Errorf("pre-process error = %v, want %q", err, tt.error)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.edit != nil {
+				contentFile := filepath.Join(contentDir, "items", "1.yaml")
+				content, err := os.ReadFile(contentFile)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(contentFile, []byte(tt.edit(string(content))), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := JSONLPostProcess(ctx, contentDir, dataDir, Options{}); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile(dataFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want
+			if want == "" {
+				want = tt.data
+			}
+			if string(got) != want {
+				t.Errorf("post-process wrote %q, want %q", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,405 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// stateFile records the checksum of every content file as of the last
+// pre-process or post-process, relative to the content directory.
+const stateFile = ".decapta.sum"
+
+// ContentChange is a content file that was created, modified or deleted
+// since the content directory was last processed.
+type ContentChange struct {
+	Path string     `json:"path"`
+	Kind ChangeKind `json:"kind"`
+}
+
+// Entry returns the top-level content entry the change belongs to: the
+// content directory of a CSV file or the content file of an ARB language.
+func (c ContentChange) Entry() string {
+	entry := strings.SplitN(c.Path, "/", 2)[0]
+	// Column order files belong to their CSV content directory
+	if strings.HasPrefix(entry, ".") && strings.HasSuffix(entry, ".yaml") {
+		return strings.TrimSuffix(strings.TrimPrefix(entry, "."), ".yaml")
+	}
+	return entry
+}
+
+// ChangedEntries returns the set of content entries affected by changes,
+// suitable for Options.Only.
+func ChangedEntries(changes []ContentChange) map[string]bool {
+	entries := make(map[string]bool)
+	for _, change := range changes {
+		entries[change.Entry()] = true
+	}
+	return entries
+}
+
+// DetectChanges lists the changed content files of contentDir, against the
+// git revision since if it is set and against the recorded state otherwise.
+func DetectChanges(ctx context.Context, contentDir string, since string) ([]ContentChange, error) {
+	if since != "" {
+		return ChangedContentSince(ctx, contentDir, since)
+	}
+	return ChangedContent(contentDir)
+}
+
+// ChangedContent compares the files in contentDir with the checksums recorded
+// by the last pre-process or post-process.
+func ChangedContent(contentDir string) ([]ContentChange, error) {
+	recorded, err := readState(DiskOutput{}, contentDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("no recorded state in %s, run pre-process first", contentDir)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := hashContent(contentDir, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []ContentChange
+	for path, sum := range current {
+		recordedSum, ok := recorded[path]
+		switch {
+		case !ok:
+			changes = append(changes, ContentChange{Path: path, Kind: ChangeCreated})
+		case recordedSum != sum:
+			changes = append(changes, ContentChange{Path: path, Kind: ChangeModified})
+		}
+	}
+	for path := range recorded {
+		if _, ok := current[path]; !ok {
+			changes = append(changes, ContentChange{Path: path, Kind: ChangeDeleted})
+		}
+	}
+
+	sortContentChanges(changes)
+	return changes, nil
+}
+
+// ChangedContentSince lists the content files changed since the git revision
+// rev, including uncommitted and untracked files, using the git repository
+// containing contentDir.
+func ChangedContentSince(ctx context.Context, contentDir string, rev string) ([]ContentChange, error) {
+	if _, err := os.Stat(contentDir); errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	diff, err := git(ctx, contentDir, "diff", "--name-status", "--relative", rev, "--", ".")
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := git(ctx, contentDir, "ls-files", "--others", "--exclude-standard", "--", ".")
+	if err != nil {
+		return nil, err
+	}
+
+	changes := parseNameStatus(diff)
+	scanner := bufio.NewScanner(bytes.NewReader(untracked))
+	for scanner.Scan() {
+		if path := scanner.Text(); path != "" && path != stateFile {
+			changes = append(changes, ContentChange{Path: path, Kind: ChangeCreated})
+		}
+	}
+
+	sortContentChanges(changes)
+	return changes, nil
+}
+
+// parseNameStatus reads the changes listed by git diff --name-status. A
+// renamed file is deleted at its old path and created at its new one, and a
+// copied file created at its new path.
+func parseNameStatus(diff []byte) []ContentChange {
+	var changes []ContentChange
+	scanner := bufio.NewScanner(bytes.NewReader(diff))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 2 || fields[0] == "" {
+			continue
+		}
+		status, path := fields[0], fields[len(fields)-1]
+		switch status[0] {
+		case 'A':
+			changes = appendContentChange(changes, path, ChangeCreated)
+		case 'D':
+			changes = appendContentChange(changes, path, ChangeDeleted)
+		case 'R':
+			changes = appendContentChange(changes, fields[1], ChangeDeleted)
+			changes = appendContentChange(changes, path, ChangeCreated)
+		case 'C':
+			changes = appendContentChange(changes, path, ChangeCreated)
+		default:
+			changes = appendContentChange(changes, path, ChangeModified)
+		}
+	}
+	return changes
+}
+
+// appendContentChange appends a change of path, unless it is the state file.
+func appendContentChange(changes []ContentChange, path string, kind ChangeKind) []ContentChange {
+	if path == "" || path == stateFile {
+		return changes
+	}
+	return append(changes, ContentChange{Path: path, Kind: kind})
+}
+
+func git(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func sortContentChanges(changes []ContentChange) {
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+}
+
+// recordState updates the checksums of contentDir from the files on disk.
+// If entries is non-nil only files of these content entries are updated and
+// the recorded state of all other entries is kept.
+func recordState(out Output, contentDir string, entries map[string]bool) error {
+	recorded, err := readState(out, contentDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if recorded == nil {
+		recorded = make(map[string]string)
+	}
+
+	current, err := hashContent(contentDir, entries)
+	if err != nil {
+		return err
+	}
+
+	for path := range recorded {
+		if entries == nil || entries[(ContentChange{Path: path}).Entry()] {
+			delete(recorded, path)
+		}
+	}
+	for path, sum := range current {
+		recorded[path] = sum
+	}
+
+	return writeState(out, contentDir, recorded)
+}
+
+// hashContent returns the checksums of all files in contentDir, optionally
+// limited to the given content entries.
+func hashContent(contentDir string, entries map[string]bool) (map[string]string, error) {
+	sums := make(map[string]string)
+	err := filepath.WalkDir(contentDir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path == contentDir {
+			return filepath.SkipDir
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(contentDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == stateFile {
+			return nil
+		}
+		if entries != nil && !entries[(ContentChange{Path: rel}).Entry()] {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		sums[rel] = hex.EncodeToString(sum[:])
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error hashing content directory %s: %v", contentDir, err)
+	}
+	return sums, nil
+}
+
+func readState(out Output, contentDir string) (map[string]string, error) {
+	data, err := out.ReadFile(filepath.Join(contentDir, stateFile))
+	if err != nil {
+		return nil, err
+	}
+
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		sum, path, ok := strings.Cut(scanner.Text(), "  ")
+		if !ok {
+			return nil, fmt.Errorf("malformed line in %s: %q", stateFile, scanner.Text())
+		}
+		sums[path] = sum
+	}
+	return sums, scanner.Err()
+}
+
+func writeState(out Output, contentDir string, sums map[string]string) error {
+	paths := make([]string, 0, len(sums))
+	for path := range sums {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var buf bytes.Buffer
+	for _, path := range paths {
+		fmt.Fprintf(&buf, "%s  %s\n", sums[path], path)
+	}
+
+	statePath := filepath.Join(contentDir, stateFile)
+	if err := out.WriteFile(statePath, buf.Bytes()); err != nil {
+		return fmt.Errorf("error writing %s: %v", statePath, err)
+	}
+	return nil
+}
+
+// stateOutput records the checksum of every file written into contentDir so
+// the state can be saved without reading the files back.
+type stateOutput struct {
+	Output
+	contentDir string
+
+	mu      sync.Mutex
+	sums    map[string]string
+	removed map[string]bool
+}
+
+func newStateOutput(out Output, contentDir string) *stateOutput {
+	return &stateOutput{
+		Output:     out,
+		contentDir: contentDir,
+		sums:       make(map[string]string),
+		removed:    make(map[string]bool),
+	}
+}
+
+func (o *stateOutput) Create(path string) (io.WriteCloser, error) {
+	w, err := o.Output.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &hashingWriter{WriteCloser: w, hash: sha256.New(), done: func(sum string) { o.record(path, sum) }}, nil
+}
+
+func (o *stateOutput) WriteFile(path string, data []byte) error {
+	if err := o.Output.WriteFile(path, data); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	o.record(path, hex.EncodeToString(sum[:]))
+	return nil
+}
+
+func (o *stateOutput) Remove(path string) error {
+	if err := o.Output.Remove(path); err != nil {
+		return err
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if rel, ok := o.rel(path); ok {
+		delete(o.sums, rel)
+		o.removed[rel] = true
+	}
+	return nil
+}
+
+func (o *stateOutput) record(path string, sum string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if rel, ok := o.rel(path); ok {
+		o.sums[rel] = sum
+		delete(o.removed, rel)
+	}
+}
+
+func (o *stateOutput) rel(path string) (string, bool) {
+	rel, err := filepath.Rel(o.contentDir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// save merges the recorded checksums into the state file of contentDir.
+func (o *stateOutput) save() error {
+	recorded, err := readState(o.Output, o.contentDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if recorded == nil {
+		recorded = make(map[string]string)
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for path := range o.removed {
+		delete(recorded, path)
+	}
+	for path, sum := range o.sums {
+		recorded[path] = sum
+	}
+	return writeState(o.Output, o.contentDir, recorded)
+}
+
+type hashingWriter struct {
+	io.WriteCloser
+	hash hash.Hash
+	done func(sum string)
+}
+
+func (w *hashingWriter) Write(p []byte) (int, error) {
+	w.hash.Write(p)
+	return w.WriteCloser.Write(p)
+}
+
+func (w *hashingWriter) Close() error {
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+	w.done(hex.EncodeToString(w.hash.Sum(nil)))
+	return nil
+}
@@ -0,0 +1,838 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Time zones of the TOML date and time types without an offset, which keep
+// the type of a value through pre-process and post-process.
+var (
+	tomlLocalDatetime = time.FixedZone("datetime-local", 0)
+	tomlLocalDate     = time.FixedZone("date-local", 0)
+	tomlLocalTime     = time.FixedZone("time-local", 0)
+	// tomlUTC marks offset date-times in UTC, which time.UTC would make
+	// indistinguishable from dates written by the CMS.
+	tomlUTC = time.FixedZone("UTC", 0)
+)
+
+// tomlTimeFormat is the format of TOML local times.
+const tomlTimeFormat = "15:04:05.999999999"
+
+var bareTOMLKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// tomlFormat reads TOML files as a single mapping. Top-level arrays of tables
+// are split into folder collections by the TOML functions.
+var tomlFormat = recordFormat{
+	Name:       "toml",
+	Label:      "TOML",
+	Extensions: []string{".toml"},
+	Decode:     decodeTOMLRecords,
+	Encode:     encodeTOMLRecords,
+}
+
+// tomlLayout records what post-process needs to restore a TOML file: the
+// order of its top-level keys, the field names of the keys edited as a file
+// collection, and the arrays of tables edited as folder collections.
+type tomlLayout struct {
+	dataLayout `yaml:",inline"`
+	// Keys are the top-level keys in document order.
+	Keys []string `yaml:"keys"`
+	// Tables are the top-level arrays of tables.
+	Tables []tomlTable `yaml:"tables,omitempty"`
+}
+
+// tomlTable is an array of tables with a content file per table.
+type tomlTable struct {
+	Key string `yaml:"key"`
+	// Dir is the content directory of the tables, within the directory of
+	// the TOML file.
+	Dir        string `yaml:"dir"`
+	dataLayout `yaml:",inline"`
+}
+
+// TOMLPreProcess reads TOML files and creates a file per table of each
+// top-level array of tables, and a file with the other keys, for Decap CMS.
+func TOMLPreProcess(ctx context.Context, tomlDir string, contentDir string, slugFields, ignoredFiles []string, opts Options) error {
+	files, err := tomlFormat.dataFiles(tomlDir, ignoredFiles)
+	if err != nil {
+		return err
+	}
+
+	p := newPool(ctx, opts.Jobs)
+	for i, name := range files {
+		if opts.Only != nil && !opts.Only[name] {
+			continue
+		}
+
+		path := filepath.Join(tomlDir, name)
+		p.Go(i, func(ctx context.Context) error {
+			return tomlPreProcessFile(ctx, path, contentDir, slugFields, opts)
+		})
+	}
+
+	return p.Wait()
+}
+
+func tomlPreProcessFile(ctx context.Context, path string, contentDir string, slugFields []string, opts Options) error {
+	records, dataLayout, err := tomlFormat.readFile(path)
+	if err != nil {
+		return err
+	}
+	doc := records[0]
+
+	dataName, _, _ := tomlFormat.dataName(filepath.Base(path))
+	layout := tomlLayout{dataLayout: dataLayout}
+	out := opts.output()
+
+	root, tables := splitTOMLTables(doc)
+	var tableKeys []string
+	for _, kv := range doc {
+		layout.Keys = append(layout.Keys, kv.Key)
+		if _, ok := tables.Get(kv.Key); ok {
+			tableKeys = append(tableKeys, kv.Key)
+		}
+	}
+
+	if len(root) > 0 {
+		nameOfKey := layout.setColumns([]OrderedMap{root}, opts.Reserved)
+		if err := writeContentFile(out, filepath.Join(contentDir, dataName+".yaml"), renameKeys(root, nameOfKey)); err != nil {
+			return err
+		}
+	}
+
+	// Content directories are named after the keys, as safely as fields
+	dirs := fieldNames(tableKeys, nil)
+	for i, key := range tableKeys {
+		value, _ := tables.Get(key)
+		table := tomlTable{Key: key, Dir: dirs[i]}
+		tableRecords := recordList(value)
+		nameOfKey := table.setColumns(tableRecords, opts.Reserved)
+		dir := filepath.Join(contentDir, dataName, table.Dir)
+		if err := writeRecords(ctx, out, dir, tableRecords, nameOfKey, slugFields, opts.Jobs); err != nil {
+			return err
+		}
+		layout.Tables = append(layout.Tables, table)
+	}
+
+	layoutFilePath := filepath.Join(contentDir, fmt.Sprintf(".%s.yaml", dataName))
+	yamlData, err := yaml.Marshal(layout)
+	if err != nil {
+		return fmt.Errorf("error writing layout to file %s: %v", layoutFilePath, err)
+	}
+	if err := out.WriteFile(layoutFilePath, yamlData); err != nil {
+		return fmt.Errorf("error writing layout to file %s: %v", layoutFilePath, err)
+	}
+	return nil
+}
+
+// splitTOMLTables splits a document into the top-level arrays of tables and
+// the other keys.
+func splitTOMLTables(doc OrderedMap) (root OrderedMap, tables OrderedMap) {
+	for _, kv := range doc {
+		if isTOMLTableArray(kv.Value) {
+			tables = append(tables, kv)
+		} else {
+			root = append(root, kv)
+		}
+	}
+	return root, tables
+}
+
+// TOMLPostProcess reads the content files and recreates the TOML files. TOML
+// files are only replaced once every file has been written successfully.
+func TOMLPostProcess(ctx context.Context, contentDir string, tomlDir string, opts Options) error {
+	entries, err := os.ReadDir(contentDir)
+	if err != nil {
+		return fmt.Errorf("error reading content directory: %v", err)
+	}
+
+	out := opts.Output
+	var tx *Transaction
+	if out == nil {
+		tx, err = NewTransaction(tomlDir)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		out = tx
+	}
+
+	// A TOML file has a content file, a content directory or both
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() {
+			if strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".yaml") {
+				continue
+			}
+			name = strings.TrimSuffix(name, ".yaml")
+		}
+		if !contains(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	p := newPool(ctx, opts.Jobs)
+	for i, name := range names {
+		if opts.Only != nil && !opts.Only[name] && !opts.Only[name+".yaml"] {
+			continue
+		}
+
+		dataName := name
+		p.Go(i, func(ctx context.Context) error {
+			return tomlPostProcessFile(ctx, contentDir, dataName, tomlDir, out)
+		})
+	}
+
+	if err := p.Wait(); err != nil {
+		return err
+	}
+
+	if tx != nil {
+		return tx.Commit()
+	}
+	return nil
+}
+
+func tomlPostProcessFile(ctx context.Context, contentDir string, dataName string, tomlDir string, out Output) error {
+	layoutFilePath := filepath.Join(contentDir, fmt.Sprintf(".%s.yaml", dataName))
+	yamlContent, err := os.ReadFile(layoutFilePath)
+	if err != nil {
+		return fmt.Errorf("error reading layout from file %s: %v", layoutFilePath, err)
+	}
+	var layout tomlLayout
+	if err := yaml.Unmarshal(yamlContent, &layout); err != nil {
+		return fmt.Errorf("error reading layout from file %s: %v", layoutFilePath, err)
+	}
+
+	dataFilePath := tomlFormat.dataFile(tomlDir, dataName, layout.dataLayout)
+	original, originals := tomlFormat.readOriginal(dataFilePath)
+	var originalDoc OrderedMap
+	if len(originals) == 1 {
+		originalDoc = originals[0]
+	}
+	originalRoot, _ := splitTOMLTables(originalDoc)
+
+	var root OrderedMap
+	rootFilePath := filepath.Join(contentDir, dataName+".yaml")
+	if _, err := os.Stat(rootFilePath); err == nil {
+		edited, err := readRecord(rootFilePath, layout.keyOfName())
+		if err != nil {
+			return err
+		}
+		root = restoreRecord(edited, originalRoot)
+	}
+
+	tables := make(map[string][]OrderedMap, len(layout.Tables))
+	for _, table := range layout.Tables {
+		dir := filepath.Join(contentDir, dataName, table.Dir)
+		files, err := os.ReadDir(dir)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("error reading TOML content directory %s: %v", dir, err)
+		}
+		sort.Slice(files, func(i, j int) bool {
+			return extractFileNumber(files[i].Name()) < extractFileNumber(files[j].Name())
+		})
+
+		originalTables, _ := originalDoc.Get(table.Key)
+		records, err := readRecords(ctx, dir, files, table.keyOfName(), recordList(originalTables))
+		if err != nil {
+			return err
+		}
+		tables[table.Key] = records
+	}
+
+	// Top-level keys in their original order, new keys last
+	var doc OrderedMap
+	for _, key := range layout.Keys {
+		if records, ok := tables[key]; ok {
+			doc = append(doc, KVPair{Key: key, Value: recordArray(records)})
+		} else if value, ok := root.Get(key); ok {
+			doc = append(doc, KVPair{Key: key, Value: value})
+		}
+	}
+	for _, kv := range root {
+		if !contains(layout.Keys, kv.Key) {
+			doc = append(doc, kv)
+		}
+	}
+
+	return tomlFormat.writeFile(out, dataFilePath, []OrderedMap{doc}, layout.dataLayout, original)
+}
+
+// TOMLGenerateConfig generates the config.yml for TOML files: a folder
+// collection per top-level array of tables and a file collection with the
+// other keys.
+func TOMLGenerateConfig(tomlDir string, outputFile string, templateData, indexHTML []byte, contentDir string, ignoredFiles []string, opts Options) error {
+	files, err := tomlFormat.dataFiles(tomlDir, ignoredFiles)
+	if err != nil {
+		return err
+	}
+
+	var collections []Collection
+	for _, name := range files {
+		records, _, err := tomlFormat.readFile(filepath.Join(tomlDir, name))
+		if err != nil {
+			return err
+		}
+		dataName, _, _ := tomlFormat.dataName(name)
+
+		root, tables := splitTOMLTables(records[0])
+		if len(root) > 0 {
+			collections = append(collections, fileCollection(
+				fmt.Sprintf("toml_%s", dataName),
+				fmt.Sprintf("TOML Data (%s)", dataName),
+				dataName,
+				filepath.Join(contentDir, dataName+".yaml"),
+				root, opts))
+		}
+
+		var tableKeys []string
+		for _, kv := range tables {
+			tableKeys = append(tableKeys, kv.Key)
+		}
+		dirs := fieldNames(tableKeys, nil)
+		for i, kv := range tables {
+			collections = append(collections, folderCollection(
+				fmt.Sprintf("toml_%s_%s", dataName, dirs[i]),
+				fmt.Sprintf("TOML Data (%s.%s)", dataName, kv.Key),
+				filepath.Join(contentDir, dataName, dirs[i]),
+				recordList(kv.Value), opts))
+		}
+	}
+
+	err = writeCollections(collections, map[string]preview{}, templateData, indexHTML, outputFile, opts)
+	if err != nil {
+		return fmt.Errorf("error writing config: %v", err)
+	}
+	return nil
+}
+
+func decodeTOMLRecords(data []byte) ([]OrderedMap, dataLayout, error) {
+	layout := dataLayout{Kind: layoutKindMap}
+	var raw map[string]interface{}
+	md, err := toml.Decode(string(data), &raw)
+	if err != nil {
+		return nil, layout, err
+	}
+
+	// Keys are listed in document order, the keys of all tables of an array
+	// under the same parent. Implicit tables such as a in [a.b] are not
+	// listed themselves.
+	order := make(map[string][]string)
+	seen := make(map[string]bool)
+	for _, key := range md.Keys() {
+		for i := 1; i <= len(key); i++ {
+			parent := key[:i-1].String()
+			child := key[i-1]
+			if id := parent + "\x00" + child; !seen[id] {
+				seen[id] = true
+				order[parent] = append(order[parent], child)
+			}
+		}
+	}
+	doc, _ := tomlValue(raw, nil, nil, order, tomlNumbers(data)).(OrderedMap)
+
+	if bytes.Contains(data, []byte("\r\n")) {
+		layout.LineEnding = "crlf"
+	}
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		layout.FinalNewline = boolPtr(false)
+	}
+	return []OrderedMap{doc}, layout, nil
+}
+
+// tomlValue converts a decoded TOML value to the values of content files:
+// tables become OrderedMap in document order, and numbers json.Number in
+// their original notation. at is the path of the value with the index of
+// each array item, to look up the notation in numbers.
+func tomlValue(value interface{}, path toml.Key, at []string, order map[string][]string, numbers map[string]string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for _, key := range order[path.String()] {
+			if _, ok := v[key]; ok {
+				keys = append(keys, key)
+			}
+		}
+		// Keys of inline tables in arrays are not listed
+		var rest []string
+		for key := range v {
+			if !contains(keys, key) {
+				rest = append(rest, key)
+			}
+		}
+		sort.Strings(rest)
+
+		table := make(OrderedMap, 0, len(v))
+		for _, key := range append(keys, rest...) {
+			table = append(table, KVPair{Key: key, Value: tomlValue(v[key], append(path[:len(path):len(path)], key), append(at[:len(at):len(at)], key), order, numbers)})
+		}
+		return table
+	case []map[string]interface{}:
+		array := make([]interface{}, len(v))
+		for i, item := range v {
+			array[i] = tomlValue(item, path, append(at[:len(at):len(at)], strconv.Itoa(i)), order, numbers)
+		}
+		return array
+	case []interface{}:
+		array := make([]interface{}, len(v))
+		for i, item := range v {
+			array[i] = tomlValue(item, path, append(at[:len(at):len(at)], strconv.Itoa(i)), order, numbers)
+		}
+		return array
+	case int64:
+		if n, ok := numbers[strings.Join(at, "\x00")]; ok {
+			if i, err := strconv.ParseInt(n, 10, 64); err == nil && i == v {
+				return json.Number(n)
+			}
+		}
+		return json.Number(strconv.FormatInt(v, 10))
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return v
+		}
+		// Floats keep their notation, such as 9.50 or 1e3
+		if n, ok := numbers[strings.Join(at, "\x00")]; ok && strings.ContainsAny(n, ".eE") {
+			if f, err := strconv.ParseFloat(n, 64); err == nil && f == v {
+				return json.Number(n)
+			}
+		}
+		return json.Number(formatTOMLFloat(v))
+	case time.Time:
+		switch v.Location().String() {
+		case "datetime-local":
+			return wallClock(v, tomlLocalDatetime)
+		case "date-local":
+			return wallClock(v, tomlLocalDate)
+		case "time-local":
+			return wallClock(v, tomlLocalTime)
+		}
+		if v.Location() == time.UTC {
+			return v.In(tomlUTC)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+var decimalTOMLNumber = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// tomlNumbers returns the notation of the decimal numbers assigned to keys
+// of tables, by their path joined with NUL and the index of each array of
+// tables in it. Numbers in arrays and inline tables are not listed.
+func tomlNumbers(data []byte) map[string]string {
+	numbers := make(map[string]string)
+	counts := make(map[string]int)
+	last := make(map[string]int)
+	var table []string
+	var depth int      // Brackets of a multi-line array or inline table
+	var closing string // Delimiter of a multi-line string
+
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(strings.TrimSuffix(line, "\r"))
+		switch {
+		case closing != "":
+			if i := strings.Index(line, closing); i >= 0 {
+				closing = ""
+				depth = tomlDepth(line[i+3:], depth)
+			}
+			continue
+		case depth > 0:
+			depth = tomlDepth(line, depth)
+			continue
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, "["):
+			array := strings.HasPrefix(line, "[[")
+			end := strings.LastIndex(line, "]")
+			if end < 0 {
+				continue
+			}
+			keys := splitTOMLKey(strings.Trim(line[:end], "[] \t"))
+			table = table[:0]
+			for i, key := range keys {
+				table = append(table, key)
+				id := strings.Join(table, "\x00")
+				if array && i == len(keys)-1 {
+					last[id] = counts[id]
+					counts[id]++
+				}
+				if index, ok := last[id]; ok {
+					table = append(table, strconv.Itoa(index))
+				}
+			}
+			continue
+		}
+
+		eq := tomlKeyEnd(line)
+		if eq < 0 {
+			continue
+		}
+		value := strings.TrimSpace(line[eq+1:])
+		if i := strings.Index(value, "#"); i >= 0 && decimalTOMLNumber.MatchString(strings.TrimSpace(value[:i])) {
+			value = strings.TrimSpace(value[:i])
+		}
+		switch {
+		case decimalTOMLNumber.MatchString(value):
+			path := append(table[:len(table):len(table)], splitTOMLKey(line[:eq])...)
+			numbers[strings.Join(path, "\x00")] = value
+		case strings.HasPrefix(value, `"""`) || strings.HasPrefix(value, "'''"):
+			if !strings.Contains(value[3:], value[:3]) {
+				closing = value[:3]
+			}
+		default:
+			depth = tomlDepth(value, 0)
+		}
+	}
+	return numbers
+}
+
+// tomlKeyEnd returns the index of the = after the key of a line, or -1.
+func tomlKeyEnd(line string) int {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '=':
+			return i
+		}
+	}
+	return -1
+}
+
+// splitTOMLKey splits a dotted key into its unquoted parts.
+func splitTOMLKey(key string) []string {
+	var parts []string
+	var part strings.Builder
+	var quote rune
+	for _, r := range key {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			part.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '.':
+			parts = append(parts, part.String())
+			part.Reset()
+		case r != ' ' && r != '\t':
+			part.WriteRune(r)
+		}
+	}
+	return append(parts, part.String())
+}
+
+// tomlDepth returns the bracket depth after a line of a value, skipping
+// strings and comments.
+func tomlDepth(line string, depth int) int {
+	var quote rune
+	var escaped bool
+	for _, r := range line {
+		switch {
+		case escaped:
+			escaped = false
+		case quote == '"' && r == '\\':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return depth
+		case r == '[' || r == '{':
+			depth++
+		case r == ']' || r == '}':
+			depth--
+		}
+	}
+	return depth
+}
+
+func wallClock(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+// formatTOMLFloat formats a float that reads back as a float.
+func formatTOMLFloat(f float64) string {
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	s := strconv.FormatFloat(f, format, -1, 64)
+	if !strings.ContainsAny(s, ".eE") {
+		s += ".0"
+	}
+	return s
+}
+
+func encodeTOMLRecords(records []OrderedMap, layout dataLayout, original []byte) ([]byte, error) {
+	var w tomlWriter
+	if err := w.table(nil, records[0], false); err != nil {
+		return nil, err
+	}
+	data := append([]byte(tomlHeadComment(original)), w.buf.Bytes()...)
+	return restoreLineEndings(data, layout), nil
+}
+
+// tomlHeadComment returns the comment lines at the top of a TOML file, and
+// the blank line after them.
+func tomlHeadComment(original []byte) string {
+	lines := strings.Split(strings.ReplaceAll(string(original), "\r\n", "\n"), "\n")
+	end := 0
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "#") {
+			end = i + 1
+		} else if line != "" {
+			break
+		}
+	}
+	if end == 0 {
+		return ""
+	}
+	comment := strings.Join(lines[:end], "\n") + "\n"
+	if end < len(lines)-1 && strings.TrimSpace(lines[end]) == "" {
+		comment += "\n"
+	}
+	return comment
+}
+
+// tomlWriter writes TOML in the key order of tables. The keys of a table
+// precede its subtables and arrays of tables, as TOML requires.
+type tomlWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *tomlWriter) table(path []string, table OrderedMap, arrayItem bool) error {
+	var nested []KVPair
+	var keys int
+	for _, kv := range table {
+		if kv.Value == nil {
+			continue // TOML has no null
+		}
+		if _, ok := kv.Value.(OrderedMap); ok || isTOMLTableArray(kv.Value) {
+			nested = append(nested, kv)
+			continue
+		}
+		keys++
+	}
+
+	// Tables with only subtables are defined by them
+	if len(path) > 0 && (arrayItem || keys > 0 || len(nested) == 0) {
+		if w.buf.Len() > 0 {
+			w.buf.WriteByte('\n')
+		}
+		header := tomlKeyPath(path)
+		if arrayItem {
+			fmt.Fprintf(&w.buf, "[[%s]]\n", header)
+		} else {
+			fmt.Fprintf(&w.buf, "[%s]\n", header)
+		}
+	}
+
+	for _, kv := range table {
+		if kv.Value == nil {
+			continue
+		}
+		if _, ok := kv.Value.(OrderedMap); ok || isTOMLTableArray(kv.Value) {
+			continue
+		}
+		value, err := tomlInline(kv.Value)
+		if err != nil {
+			return fmt.Errorf("error encoding %s: %v", tomlKeyPath(append(path, kv.Key)), err)
+		}
+		fmt.Fprintf(&w.buf, "%s = %s\n", tomlKey(kv.Key), value)
+	}
+
+	for _, kv := range nested {
+		childPath := append(path[:len(path):len(path)], kv.Key)
+		if child, ok := kv.Value.(OrderedMap); ok {
+			if err := w.table(childPath, child, false); err != nil {
+				return err
+			}
+			continue
+		}
+		for _, item := range kv.Value.([]interface{}) {
+			if err := w.table(childPath, item.(OrderedMap), true); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isTOMLTableArray reports whether a value is a non-empty array of tables.
+func isTOMLTableArray(value interface{}) bool {
+	array, ok := value.([]interface{})
+	if !ok || len(array) == 0 {
+		return false
+	}
+	for _, item := range array {
+		if _, ok := item.(OrderedMap); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// tomlInline encodes a value on a single line, or a multi-line string.
+func tomlInline(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return tomlString(v), nil
+	case json.Number:
+		return string(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "nan", nil
+		case math.IsInf(v, 1):
+			return "inf", nil
+		case math.IsInf(v, -1):
+			return "-inf", nil
+		}
+		return formatTOMLFloat(v), nil
+	case time.Time:
+		switch {
+		case v.Location() == tomlLocalDatetime:
+			return v.Format("2006-01-02T15:04:05.999999999"), nil
+		case v.Location() == tomlLocalDate:
+			return v.Format("2006-01-02"), nil
+		case v.Location() == tomlLocalTime:
+			return v.Format(tomlTimeFormat), nil
+		case v.Location() == time.UTC && isDate(v):
+			// Dates written by the CMS
+			return v.Format("2006-01-02"), nil
+		}
+		return v.Format(time.RFC3339Nano), nil
+	case OrderedMap:
+		var parts []string
+		for _, kv := range v {
+			if kv.Value == nil {
+				continue
+			}
+			item, err := tomlInline(kv.Value)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, fmt.Sprintf("%s = %s", tomlKey(kv.Key), item))
+		}
+		if len(parts) == 0 {
+			return "{}", nil
+		}
+		return "{ " + strings.Join(parts, ", ") + " }", nil
+	case []interface{}:
+		var parts []string
+		for _, item := range v {
+			if item == nil {
+				continue
+			}
+			part, err := tomlInline(item)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, part)
+		}
+		return "[" + strings.Join(parts, ", ") + "]", nil
+	default:
+		return "", fmt.Errorf("unsupported value %v of type %T", value, value)
+	}
+}
+
+func tomlKey(key string) string {
+	if bareTOMLKey.MatchString(key) {
+		return key
+	}
+	return tomlString(key)
+}
+
+func tomlKeyPath(path []string) string {
+	keys := make([]string, len(path))
+	for i, key := range path {
+		keys[i] = tomlKey(key)
+	}
+	return strings.Join(keys, ".")
+}
+
+// tomlString encodes a basic string, multi-line if it has line breaks.
+func tomlString(s string) string {
+	multiline := strings.Contains(s, "\n")
+	var b strings.Builder
+	if multiline {
+		b.WriteString(`"""` + "\n")
+	} else {
+		b.WriteByte('"')
+	}
+	for _, r := range s {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '"':
+			b.WriteString(`\"`)
+		case r == '\n' && multiline:
+			b.WriteByte('\n')
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteByte('\t')
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&b, `\u%04X`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	if multiline {
+		b.WriteString(`"""`)
+	} else {
+		b.WriteByte('"')
+	}
+	return b.String()
+}
@@ -0,0 +1,122 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const pricedTOML = `# Shop data
+# maintained by hand
+
+title = "Shop"
+rate = 1.50
+limit = 1e3
+
+[[products]]
+name = "Notebook"
+price = 9.50
+stock = 10
+
+[[products]]
+name = "Pencil"
+price = 0.80
+stock = 120
+
+[[products.sizes]]
+width = 2.0
+
+[owner]
+name = "Ada"
+share = 0.250
+`
+
+func TestTOMLRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		// edits replace text in content files, by path in the content
+		// directory
+		edits map[string][2]string
+		want  string
+	}{
+		{
+			name: "unchanged",
+			data: pricedTOML,
+		},
+		{
+			name: "line endings",
+			data: strings.ReplaceAll(pricedTOML, "\n", "\r\n"),
+		},
+		{
+			name:  "price edited",
+			data:  pricedTOML,
+			edits: map[string][2]string{"shop/products/2.yaml": {"price: 0.80", "price: 0.85"}},
+			want:  strings.Replace(pricedTOML, "price = 0.80", "price = 0.85", 1),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			dataDir := filepath.Join(root, "data")
+			contentDir := filepath.Join(root, "content")
+			dataFile := filepath.Join(dataDir, "shop.toml")
+			if err := os.MkdirAll(dataDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(dataFile, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.Background()
+			if err := TOMLPreProcess(ctx, dataDir, contentDir, nil, nil, Options{}); err != nil {
+				t.Fatal(err)
+			}
+			for name, edit := range tt.edits {
+				path := filepath.Join(contentDir, filepath.FromSlash(name))
+				content, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.Contains(string(content), edit[0]) {
+					t.Fatalf("%s does not contain %q:\n%s", name, edit[0], content)
+				}
+				content = []byte(strings.Replace(string(content), edit[0], edit[1], 1))
+				if err := os.WriteFile(path, content, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := TOMLPostProcess(ctx, contentDir, dataDir, Options{}); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile(dataFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want
+			if want == "" {
+				want = tt.data
+			}
+			if string(got) != want {
+				t.Errorf("post-process wrote:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Transaction stages output files in a temporary directory next to the
+// target directory and moves them into place only on Commit, so a failing
+// run never leaves truncated or partially updated files behind.
+type Transaction struct {
+	dir     string
+	staging string
+
+	mu      sync.Mutex
+	staged  map[string]bool
+	removed map[string]bool
+	closed  bool
+}
+
+// NewTransaction starts a transaction writing into dir, creating it if needed.
+func NewTransaction(dir string) (*Transaction, error) {
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return nil, fmt.Errorf("error creating output directory %s: %v", dir, err)
+	}
+
+	// Stage inside the target directory so renames stay on one filesystem
+	staging, err := os.MkdirTemp(dir, ".decapta-staging-")
+	if err != nil {
+		return nil, fmt.Errorf("error creating staging directory in %s: %v", dir, err)
+	}
+
+	return &Transaction{
+		dir:     dir,
+		staging: staging,
+		staged:  make(map[string]bool),
+		removed: make(map[string]bool),
+	}, nil
+}
+
+// Create opens a staged file for writing. path must be inside the target
+// directory. Closing the file flushes it to disk.
+func (t *Transaction) Create(path string) (io.WriteCloser, error) {
+	stagedPath, err := t.stage(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(stagedPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error creating staged file for %s: %v", path, err)
+	}
+	return &syncedFile{File: f}, nil
+}
+
+// WriteFile stages a complete file. path must be inside the target directory.
+func (t *Transaction) WriteFile(path string, data []byte) error {
+	f, err := t.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing staged file for %s: %v", path, err)
+	}
+	return f.Close()
+}
+
+// Remove stages the removal of path, which must be inside the target directory.
+func (t *Transaction) Remove(path string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	name, err := t.name(path)
+	if err != nil {
+		return err
+	}
+	delete(t.staged, name)
+	t.removed[name] = true
+	return nil
+}
+
+// ReadFile returns the staged content of path, falling back to the target
+// directory for files the transaction did not touch.
+func (t *Transaction) ReadFile(path string) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	name, err := t.name(path)
+	if err != nil {
+		return nil, err
+	}
+	if t.staged[name] {
+		return os.ReadFile(filepath.Join(t.staging, name))
+	}
+	if t.removed[name] {
+		return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+	}
+	return os.ReadFile(path)
+}
+
+func (t *Transaction) stage(path string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	name, err := t.name(path)
+	if err != nil {
+		return "", err
+	}
+
+	stagedPath := filepath.Join(t.staging, name)
+	err = os.MkdirAll(filepath.Dir(stagedPath), os.ModePerm)
+	if err != nil {
+		return "", fmt.Errorf("error creating staging directory for %s: %v", path, err)
+	}
+	delete(t.removed, name)
+	t.staged[name] = true
+	return stagedPath, nil
+}
+
+// name returns path relative to the target directory. Callers hold t.mu.
+func (t *Transaction) name(path string) (string, error) {
+	if t.closed {
+		return "", errors.New("transaction already finished")
+	}
+
+	name, err := filepath.Rel(t.dir, path)
+	if err != nil || name == "." || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside of %s", path, t.dir)
+	}
+	return name, nil
+}
+
+// rename moves files into place, replaced in tests to inject failures.
+var rename = os.Rename
+
+// Commit moves all staged files into the target directory and applies staged
+// removals. If a file cannot be moved, files already moved are restored to
+// their previous content. Should that fail too, the staging directory with
+// the backups of the previous files is kept and named in the error.
+func (t *Transaction) Commit() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return errors.New("transaction already finished")
+	}
+	t.closed = true
+
+	names := make([]string, 0, len(t.staged)+len(t.removed))
+	for name := range t.staged {
+		names = append(names, name)
+	}
+	for name := range t.removed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	backupDir := filepath.Join(t.staging, ".backup")
+
+	// Keep existing files aside until every staged file is in place
+	var committed []string
+	backedUp := make(map[string]bool)
+	rollback := func(err error) error {
+		var errs []error
+		for i := len(committed) - 1; i >= 0; i-- {
+			name := committed[i]
+			target := filepath.Join(t.dir, name)
+			if backedUp[name] {
+				if err := rename(filepath.Join(backupDir, name), target); err != nil {
+					errs = append(errs, err)
+				}
+			} else if !t.removed[name] {
+				if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+					errs = append(errs, err)
+				}
+			}
+		}
+		if len(errs) > 0 {
+			return fmt.Errorf("%v; restoring the previous files failed, their backups are kept in %s: %v", err, backupDir, errors.Join(errs...))
+		}
+		os.RemoveAll(t.staging)
+		return err
+	}
+
+	// Directories whose entries changed, synced once all files are in place
+	dirs := map[string]bool{t.dir: true}
+	for _, name := range names {
+		target := filepath.Join(t.dir, name)
+		dirs[filepath.Dir(target)] = true
+
+		if _, err := os.Stat(target); err == nil {
+			backup := filepath.Join(backupDir, name)
+			if err := os.MkdirAll(filepath.Dir(backup), os.ModePerm); err != nil {
+				return rollback(fmt.Errorf("error creating backup directory for %s: %v", name, err))
+			}
+			if err := rename(target, backup); err != nil {
+				return rollback(fmt.Errorf("error backing up %s: %v", target, err))
+			}
+			backedUp[name] = true
+		}
+
+		if t.removed[name] {
+			committed = append(committed, name)
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+			committed = append(committed, name)
+			return rollback(fmt.Errorf("error creating directory for %s: %v", target, err))
+		}
+		if err := rename(filepath.Join(t.staging, name), target); err != nil {
+			committed = append(committed, name)
+			return rollback(fmt.Errorf("error moving %s into place: %v", target, err))
+		}
+		committed = append(committed, name)
+	}
+	os.RemoveAll(t.staging)
+
+	synced := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		synced = append(synced, dir)
+	}
+	sort.Strings(synced)
+	for _, dir := range synced {
+		if err := syncDir(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rollback discards all staged files. It is a no-op after Commit, so it can
+// be deferred right after NewTransaction.
+func (t *Transaction) Rollback() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+	return os.RemoveAll(t.staging)
+}
+
+// syncedFile flushes its content to disk before closing.
+type syncedFile struct {
+	*os.File
+}
+
+func (f *syncedFile) Close() error {
+	if err := f.File.Sync(); err != nil {
+		f.File.Close()
+		return fmt.Errorf("error syncing %s: %v", f.Name(), err)
+	}
+	return f.File.Close()
+}
+
+// syncDir flushes directory entries so renames survive a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	// Some platforms do not support syncing directories
+	if err := d.Sync(); err != nil && !errors.Is(err, os.ErrInvalid) {
+		return fmt.Errorf("error syncing directory %s: %v", dir, err)
+	}
+	return nil
+}
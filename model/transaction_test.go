@@ -0,0 +1,286 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// failRename makes the renames fail for which fail returns true, until the
+// test ends.
+func failRename(t *testing.T, fail func(from, to string) bool) {
+	t.Helper()
+	rename = func(from, to string) error {
+		if fail(from, to) {
+			return errors.New("injected failure")
+		}
+		return os.Rename(from, to)
+	}
+	t.Cleanup(func() { rename = os.Rename })
+}
+
+// transactionDir returns a directory holding a.txt and sub/b.txt.
+func transactionDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range map[string]string{"a.txt": "a", "sub/b.txt": "b"} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		name, _ := filepath.Rel(dir, path)
+		data, err := os.ReadFile(path)
+		files[filepath.ToSlash(name)] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func equalTree(t *testing.T, got, want map[string]string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("files = %v, want %v", got, want)
+		return
+	}
+	for name, content := range want {
+		if got[name] != content {
+			t.Errorf("files = %v, want %v", got, want)
+			return
+		}
+	}
+}
+
+// stage writes a.txt and sub/c.txt and removes sub/b.txt.
+func stage(t *testing.T, dir string) *Transaction {
+	t.Helper()
+	tx, err := NewTransaction(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.WriteFile(filepath.Join(dir, "a.txt"), []byte("A")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.WriteFile(filepath.Join(dir, "sub", "c.txt"), []byte("C")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Remove(filepath.Join(dir, "sub", "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func TestTransactionCommit(t *testing.T) {
+	dir := transactionDir(t)
+	tx := stage(t, dir)
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	equalTree(t, readTree(t, dir), map[string]string{"a.txt": "A", "sub/c.txt": "C"})
+}
+
+func TestTransactionRollback(t *testing.T) {
+	dir := transactionDir(t)
+	tx := stage(t, dir)
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	equalTree(t, readTree(t, dir), map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+	if err := tx.Commit(); err == nil {
+		t.Error("commit after rollback succeeded")
+	}
+}
+
+func TestTransactionCommitRestoresOriginals(t *testing.T) {
+	tests := []struct {
+		name string
+		fail func(from, to string) bool
+	}{
+		{"failed move", func(from, to string) bool {
+			return strings.HasSuffix(to, filepath.Join("sub", "c.txt")) && !strings.Contains(to, ".backup")
+		}},
+		{"failed backup", func(from, to string) bool {
+			return strings.HasSuffix(to, filepath.Join(".backup", "sub", "b.txt"))
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := transactionDir(t)
+			tx := stage(t, dir)
+			failRename(t, tt.fail)
+
+			err := tx.Commit()
+			if err == nil || !strings.Contains(err.Error(), "injected failure") {
+				t.Fatalf("commit error = %v, want the injected failure", err)
+			}
+			// The originals are back and the staging directory is gone
+			equalTree(t, readTree(t, dir), map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+		})
+	}
+}
+
+func TestTransactionFailedRollbackKeepsBackups(t *testing.T) {
+	dir := transactionDir(t)
+	tx := stage(t, dir)
+	// Moving c.txt fails, and so does restoring a.txt
+	failRename(t, func(from, to string) bool {
+		return strings.HasSuffix(to, filepath.Join("sub", "c.txt")) || strings.Contains(from, ".backup")
+	})
+
+	err := tx.Commit()
+	if err == nil || !strings.Contains(err.Error(), tx.staging) {
+		t.Fatalf("commit error = %v, want the staging directory named", err)
+	}
+	backup, err := os.ReadFile(filepath.Join(tx.staging, ".backup", "a.txt"))
+	if err != nil || string(backup) != "a" {
+		t.Errorf("backup of a.txt = %q, %v, want the original", backup, err)
+	}
+}
+
+func TestPlanChanges(t *testing.T) {
+	tests := []struct {
+		name    string
+		plan    func(p *Plan) error
+		changes string
+		diff    string
+	}{
+		{
+			name: "unchanged",
+			plan: func(p *Plan) error { return p.WriteFile("a.txt", []byte("a")) },
+		},
+		{
+			name:    "modified",
+			plan:    func(p *Plan) error { return p.WriteFile("a.txt", []byte("A\n")) },
+			changes: "a.txt modified",
+			diff:    "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-a\n+A\n",
+		},
+		{
+			name: "created",
+			plan: func(p *Plan) error {
+				f, err := p.Create(filepath.Join("sub", "c.txt"))
+				if err != nil {
+					return err
+				}
+				f.Write([]byte("C\n"))
+				return f.Close()
+			},
+			changes: "sub/c.txt created",
+			diff:    "--- /dev/null\n+++ b/sub/c.txt\n@@ -0,0 +1 @@\n+C\n",
+		},
+		{
+			name:    "deleted",
+			plan:    func(p *Plan) error { return p.Remove(filepath.Join("sub", "b.txt")) },
+			changes: "sub/b.txt deleted",
+			diff:    "--- a/sub/b.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-b\n",
+		},
+		{
+			name: "missing file removed",
+			plan: func(p *Plan) error { return p.Remove("missing.txt") },
+		},
+		{
+			name: "created then removed",
+			plan: func(p *Plan) error {
+				if err := p.WriteFile("new.txt", []byte("new")); err != nil {
+					return err
+				}
+				return p.Remove("new.txt")
+			},
+		},
+		{
+			name: "removed then written",
+			plan: func(p *Plan) error {
+				if err := p.Remove("a.txt"); err != nil {
+					return err
+				}
+				return p.WriteFile("a.txt", []byte("a"))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := transactionDir(t)
+			t.Chdir(dir)
+
+			p := NewPlan()
+			if err := tt.plan(p); err != nil {
+				t.Fatal(err)
+			}
+			changes, err := p.Changes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, change := range changes {
+				got = append(got, filepath.ToSlash(change.Path)+" "+string(change.Kind))
+			}
+			if strings.Join(got, ", ") != tt.changes {
+				t.Errorf("changes = %v, want %q", got, tt.changes)
+			}
+
+			var diff strings.Builder
+			if err := WriteUnifiedDiff(&diff, changes); err != nil {
+				t.Fatal(err)
+			}
+			if diff.String() != tt.diff {
+				t.Errorf("diff = %q, want %q", diff.String(), tt.diff)
+			}
+
+			var summary bytes.Buffer
+			if err := WriteChangeSummary(&summary, changes); err != nil {
+				t.Fatal(err)
+			}
+			var decoded struct {
+				Changed bool     `json:"changed"`
+				Files   []Change `json:"files"`
+			}
+			if err := json.Unmarshal(summary.Bytes(), &decoded); err != nil {
+				t.Fatal(err)
+			}
+			if decoded.Changed != (len(changes) > 0) || decoded.Files == nil || len(decoded.Files) != len(changes) {
+				t.Errorf("summary = %s", summary.String())
+			}
+			for i, file := range decoded.Files {
+				if file.Path != changes[i].Path || file.Kind != changes[i].Kind {
+					t.Errorf("summary file %d = %+v, want %+v", i, file, changes[i])
+				}
+			}
+
+			// The plan never touches the filesystem
+			equalTree(t, readTree(t, dir), map[string]string{"a.txt": "a", "sub/b.txt": "b"})
+		})
+	}
+}
@@ -0,0 +1,510 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigError is a problem found in a Decap CMS config, at a YAML position.
+type ConfigError struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e ConfigError) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Message)
+}
+
+// backendRepos lists the Decap CMS backends and whether they require a repo.
+var backendRepos = map[string]bool{
+	"github":      true,
+	"gitlab":      true,
+	"bitbucket":   true,
+	"azure":       true,
+	"gitea":       true,
+	"git-gateway": false,
+	"test-repo":   false,
+	"proxy":       false,
+}
+
+// i18nStructures lists the supported i18n content structures.
+var i18nStructures = []string{"multiple_folders", "multiple_files", "single_file"}
+
+// templateVariables are the values available to slug and summary templates
+// besides the collection fields.
+var templateVariables = map[string][]string{
+	"slug":    {"slug", "year", "month", "day", "hour", "minute", "second"},
+	"summary": {"slug", "dirname", "filename", "extension", "path", "commit_date", "commit_author", "year", "month", "day", "hour", "minute", "second"},
+}
+
+var templateReference = regexp.MustCompile(`{{\s*([^}|]*?)\s*(\|[^}]*)?}}`)
+
+// ValidateConfig checks a Decap CMS config against the rules Decap applies
+// when loading it: backend settings, unique collection names, identifier
+// fields, the options required by widgets, i18n settings and the fields
+// referenced by slug and summary templates. Folders and files of collections
+// must exist relative to root. It returns every problem found, in file
+// order.
+func ValidateConfig(configFile string, root string) ([]ConfigError, error) {
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", configFile, err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", configFile, err)
+	}
+
+	v := &validator{file: configFile, root: root}
+	if len(doc.Content) == 0 {
+		v.errorf(&doc, "config is empty")
+		return v.errors, nil
+	}
+	v.validate(doc.Content[0])
+
+	sort.SliceStable(v.errors, func(i, j int) bool {
+		a, b := v.errors[i], v.errors[j]
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return v.errors, nil
+}
+
+type validator struct {
+	file   string
+	root   string
+	errors []ConfigError
+	// i18n is the top-level i18n setting, nil if unset.
+	i18n    *yaml.Node
+	locales []string
+}
+
+func (v *validator) errorf(node *yaml.Node, format string, args ...interface{}) {
+	v.errors = append(v.errors, ConfigError{
+		File:    v.file,
+		Line:    node.Line,
+		Column:  node.Column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) validate(config *yaml.Node) {
+	if config.Kind != yaml.MappingNode {
+		v.errorf(config, "config must be a mapping")
+		return
+	}
+
+	v.validateBackend(config)
+
+	if mapValue(config, "media_folder") == nil && mapValue(config, "media_library") == nil {
+		v.errorf(config, "media_folder is required unless media_library is set")
+	}
+
+	if i18n := mapValue(config, "i18n"); i18n != nil {
+		v.i18n = i18n
+		v.locales = v.validateI18n("i18n", i18n, nil)
+	}
+
+	collections := mapValue(config, "collections")
+	if collections == nil {
+		v.errorf(config, "collections is required")
+		return
+	}
+	if collections.Kind != yaml.SequenceNode {
+		v.errorf(collections, "collections must be a list")
+		return
+	}
+	if len(collections.Content) == 0 {
+		v.errorf(collections, "collections must not be empty")
+	}
+
+	names := collectionNames(collections)
+	seen := make(map[string]*yaml.Node)
+	for _, collection := range collections.Content {
+		if collection.Kind != yaml.MappingNode {
+			v.errorf(collection, "collection must be a mapping")
+			continue
+		}
+		name := mapValue(collection, "name")
+		if name == nil || name.Value == "" {
+			v.errorf(collection, "collection is missing a name")
+		} else if first, ok := seen[name.Value]; ok {
+			v.errorf(name, "duplicate collection name %q, first defined on line %d", name.Value, first.Line)
+		} else {
+			seen[name.Value] = name
+		}
+		v.validateCollection(collection, names)
+	}
+}
+
+func (v *validator) validateBackend(config *yaml.Node) {
+	backend := mapValue(config, "backend")
+	if backend == nil {
+		v.errorf(config, "backend is required")
+		return
+	}
+	if backend.Kind != yaml.MappingNode {
+		v.errorf(backend, "backend must be a mapping")
+		return
+	}
+
+	name := mapValue(backend, "name")
+	if name == nil || name.Value == "" {
+		v.errorf(backend, "backend is missing a name")
+		return
+	}
+	needsRepo, ok := backendRepos[name.Value]
+	if !ok {
+		v.errorf(name, "unknown backend %q", name.Value)
+		return
+	}
+	if repo := mapValue(backend, "repo"); needsRepo {
+		if repo == nil || repo.Value == "" {
+			v.errorf(backend, "backend %s requires repo", name.Value)
+		} else if !strings.Contains(repo.Value, "/") {
+			v.errorf(repo, "repo %q must be in the form owner/name", repo.Value)
+		}
+	}
+	if name.Value == "azure" {
+		for _, key := range []string{"app_id", "tenant_id"} {
+			if mapValue(backend, key) == nil {
+				v.errorf(backend, "backend azure requires %s", key)
+			}
+		}
+	}
+
+	if local := mapValue(config, "local_backend"); local != nil {
+		switch local.Kind {
+		case yaml.ScalarNode:
+			if local.ShortTag() != "!!bool" {
+				v.errorf(local, "local_backend must be a boolean or a mapping")
+			}
+		case yaml.MappingNode:
+		default:
+			v.errorf(local, "local_backend must be a boolean or a mapping")
+		}
+	}
+}
+
+// validateI18n checks an i18n setting and returns its locales. Collection
+// and file settings inherit from the top-level setting, parent, and may only
+// narrow its locales.
+func (v *validator) validateI18n(path string, i18n *yaml.Node, parent []string) []string {
+	if i18n.Kind == yaml.ScalarNode && i18n.ShortTag() == "!!bool" {
+		return parent
+	}
+	if i18n.Kind != yaml.MappingNode {
+		v.errorf(i18n, "%s must be a boolean or a mapping", path)
+		return parent
+	}
+
+	if structure := mapValue(i18n, "structure"); structure != nil {
+		if !contains(i18nStructures, structure.Value) {
+			v.errorf(structure, "%s.structure must be one of %s", path, strings.Join(i18nStructures, ", "))
+		}
+	} else if parent == nil {
+		v.errorf(i18n, "%s.structure is required", path)
+	}
+
+	locales := parent
+	if node := mapValue(i18n, "locales"); node != nil {
+		locales = nil
+		if node.Kind != yaml.SequenceNode || len(node.Content) == 0 {
+			v.errorf(node, "%s.locales must be a non-empty list", path)
+		}
+		for _, locale := range node.Content {
+			if contains(locales, locale.Value) {
+				v.errorf(locale, "duplicate locale %q", locale.Value)
+				continue
+			}
+			if parent != nil && !contains(parent, locale.Value) {
+				v.errorf(locale, "locale %q is not in the top-level i18n locales", locale.Value)
+			}
+			locales = append(locales, locale.Value)
+		}
+	} else if parent == nil {
+		v.errorf(i18n, "%s.locales is required", path)
+	}
+
+	if defaultLocale := mapValue(i18n, "default_locale"); defaultLocale != nil {
+		if !contains(locales, defaultLocale.Value) {
+			v.errorf(defaultLocale, "%s.default_locale %q is not one of the locales", path, defaultLocale.Value)
+		}
+	}
+	return locales
+}
+
+func (v *validator) validateCollection(collection *yaml.Node, names []string) {
+	name := "collection"
+	if node := mapValue(collection, "name"); node != nil {
+		name = fmt.Sprintf("collection %s", node.Value)
+	}
+
+	i18n := false
+	if node := mapValue(collection, "i18n"); node != nil {
+		if v.i18n == nil {
+			v.errorf(node, "%s sets i18n, but the config has no top-level i18n", name)
+		} else {
+			v.validateI18n(name+".i18n", node, v.locales)
+			i18n = !(node.ShortTag() == "!!bool" && node.Value == "false")
+		}
+	}
+
+	folder := mapValue(collection, "folder")
+	files := mapValue(collection, "files")
+	switch {
+	case folder != nil && files != nil:
+		v.errorf(collection, "%s has both folder and files", name)
+	case folder == nil && files == nil:
+		v.errorf(collection, "%s needs either folder or files", name)
+	case folder != nil:
+		v.validatePath(folder, name, true)
+		fields := mapValue(collection, "fields")
+		if fields == nil {
+			v.errorf(collection, "%s is missing fields", name)
+			return
+		}
+		v.validateFields(name, fields, names, i18n)
+		v.validateIdentifier(collection, name, fields)
+		for _, key := range []string{"slug", "summary"} {
+			if template := mapValue(collection, key); template != nil {
+				v.validateTemplate(key, template, fields)
+			}
+		}
+	case files != nil:
+		v.validateFiles(name, files, names, i18n)
+	}
+}
+
+func (v *validator) validateFiles(name string, files *yaml.Node, names []string, i18n bool) {
+	if files.Kind != yaml.SequenceNode || len(files.Content) == 0 {
+		v.errorf(files, "%s.files must be a non-empty list", name)
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, file := range files.Content {
+		if file.Kind != yaml.MappingNode {
+			v.errorf(file, "file must be a mapping")
+			continue
+		}
+
+		fileName := mapValue(file, "name")
+		if fileName == nil || fileName.Value == "" {
+			v.errorf(file, "file of %s is missing a name", name)
+			continue
+		}
+		if seen[fileName.Value] {
+			v.errorf(fileName, "duplicate file name %q in %s", fileName.Value, name)
+		}
+		seen[fileName.Value] = true
+		filePath := fmt.Sprintf("%s file %s", name, fileName.Value)
+
+		if path := mapValue(file, "file"); path == nil {
+			v.errorf(file, "%s is missing file", filePath)
+		} else {
+			v.validatePath(path, filePath, false)
+		}
+
+		if node := mapValue(file, "i18n"); node != nil {
+			if !i18n {
+				v.errorf(node, "%s sets i18n, but its collection does not", filePath)
+			} else {
+				v.validateI18n(filePath+".i18n", node, v.locales)
+			}
+		}
+
+		if fields := mapValue(file, "fields"); fields == nil {
+			v.errorf(file, "%s is missing fields", filePath)
+		} else {
+			v.validateFields(filePath, fields, names, i18n)
+		}
+	}
+}
+
+// validatePath checks that a collection folder or file exists below root.
+func (v *validator) validatePath(node *yaml.Node, name string, dir bool) {
+	if node.Value == "" {
+		v.errorf(node, "%s has an empty path", name)
+		return
+	}
+	if strings.Contains(node.Value, "{{") {
+		return // Resolved per entry
+	}
+
+	path := filepath.Join(v.root, filepath.FromSlash(strings.TrimPrefix(node.Value, "/")))
+	info, err := os.Stat(path)
+	switch {
+	case err != nil:
+		v.errorf(node, "%s path %q does not exist", name, node.Value)
+	case dir && !info.IsDir():
+		v.errorf(node, "%s folder %q is not a directory", name, node.Value)
+	case !dir && info.IsDir():
+		v.errorf(node, "%s file %q is a directory", name, node.Value)
+	}
+}
+
+// validateIdentifier checks that entries of a folder collection can be
+// identified: by identifier_field, or else a title field.
+func (v *validator) validateIdentifier(collection *yaml.Node, name string, fields *yaml.Node) {
+	identifier := mapValue(collection, "identifier_field")
+	if identifier == nil {
+		if findByName(fields, "title") == nil {
+			v.errorf(collection, "%s has no title field and no identifier_field", name)
+		}
+		return
+	}
+	if findByName(fields, identifier.Value) == nil {
+		v.errorf(identifier, "identifier_field %q is not a field of %s", identifier.Value, name)
+	}
+}
+
+// validateTemplate checks that the {{field}} references of a slug or summary
+// template name a field or a template variable.
+func (v *validator) validateTemplate(key string, template *yaml.Node, fields *yaml.Node) {
+	for _, match := range templateReference.FindAllStringSubmatch(template.Value, -1) {
+		ref := strings.TrimPrefix(match[1], "fields.")
+		field := strings.SplitN(ref, ".", 2)[0]
+		if field == "" {
+			v.errorf(template, "%s has an empty reference %s", key, match[0])
+			continue
+		}
+		if contains(templateVariables[key], field) || findByName(fields, field) != nil {
+			continue
+		}
+		v.errorf(template, "%s references unknown field %q", key, field)
+	}
+}
+
+func (v *validator) validateFields(path string, fields *yaml.Node, names []string, i18n bool) {
+	if fields.Kind != yaml.SequenceNode {
+		v.errorf(fields, "%s.fields must be a list", path)
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, field := range fields.Content {
+		if field.Kind != yaml.MappingNode {
+			v.errorf(field, "field of %s must be a mapping", path)
+			continue
+		}
+		name := mapValue(field, "name")
+		if name == nil || name.Value == "" {
+			v.errorf(field, "field of %s is missing a name", path)
+			continue
+		}
+		if seen[name.Value] {
+			v.errorf(name, "duplicate field name %q in %s", name.Value, path)
+		}
+		seen[name.Value] = true
+		fieldPath := fmt.Sprintf("%s field %s", path, name.Value)
+
+		if node := mapValue(field, "i18n"); node != nil {
+			switch {
+			case !i18n:
+				v.errorf(node, "%s sets i18n, but its collection does not", fieldPath)
+			case node.ShortTag() != "!!bool" && !contains([]string{"translate", "duplicate", "none"}, node.Value):
+				v.errorf(node, "%s.i18n must be a boolean, translate, duplicate or none", fieldPath)
+			}
+		}
+
+		v.validateWidget(fieldPath, field, names, i18n)
+	}
+}
+
+// validateWidget checks the options that the widget of a field requires.
+func (v *validator) validateWidget(path string, field *yaml.Node, names []string, i18n bool) {
+	widget := "string"
+	if node := mapValue(field, "widget"); node != nil {
+		widget = node.Value
+	}
+
+	switch widget {
+	case "select":
+		options := mapValue(field, "options")
+		if options == nil {
+			v.errorf(field, "%s is a select widget without options", path)
+		} else if options.Kind != yaml.SequenceNode || len(options.Content) == 0 {
+			v.errorf(options, "%s.options must be a non-empty list", path)
+		}
+	case "relation":
+		for _, key := range []string{"collection", "search_fields", "value_field"} {
+			if mapValue(field, key) == nil {
+				v.errorf(field, "%s is a relation widget without %s", path, key)
+			}
+		}
+		if collection := mapValue(field, "collection"); collection != nil && !contains(names, collection.Value) {
+			v.errorf(collection, "%s relates to unknown collection %q", path, collection.Value)
+		}
+	case "number":
+		if valueType := mapValue(field, "value_type"); valueType != nil && !contains([]string{"int", "float"}, valueType.Value) {
+			v.errorf(valueType, "%s.value_type must be int or float", path)
+		}
+	case "markdown":
+		if modes := mapValue(field, "modes"); modes != nil {
+			for _, mode := range modes.Content {
+				if mode.Value != "raw" && mode.Value != "rich_text" {
+					v.errorf(mode, "%s has unknown mode %q", path, mode.Value)
+				}
+			}
+		}
+	case "object":
+		fields := mapValue(field, "fields")
+		if fields == nil {
+			v.errorf(field, "%s is an object widget without fields", path)
+		} else {
+			v.validateFields(path, fields, names, i18n)
+		}
+	case "list":
+		if fields := mapValue(field, "fields"); fields != nil {
+			v.validateFields(path, fields, names, i18n)
+		}
+		if single := mapValue(field, "field"); single != nil {
+			v.validateFields(path, &yaml.Node{Kind: yaml.SequenceNode, Content: []*yaml.Node{single}}, names, i18n)
+		}
+		if types := mapValue(field, "types"); types != nil {
+			v.validateFields(path, types, names, i18n)
+		}
+	}
+}
+
+func collectionNames(collections *yaml.Node) []string {
+	var names []string
+	for _, collection := range collections.Content {
+		if name := mapValue(collection, "name"); name != nil {
+			names = append(names, name.Value)
+		}
+	}
+	return names
+}
+
+// mapValue returns the value of key in a mapping node, nil if node is not a
+// mapping or has no such key.
+func mapValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	return findFieldInNode(node, key)
+}
@@ -0,0 +1,617 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DivergenceKind classifies how a round-tripped file differs from the original.
+type DivergenceKind string
+
+const (
+	DivergenceMissingFile  DivergenceKind = "missing file"
+	DivergenceRenamedFile  DivergenceKind = "renamed file"
+	DivergenceHeaders      DivergenceKind = "changed headers"
+	DivergenceRowCount     DivergenceKind = "changed row count"
+	DivergenceValue        DivergenceKind = "changed value"
+	DivergenceTypeCoercion DivergenceKind = "type coercion"
+	DivergenceWhitespace   DivergenceKind = "changed whitespace"
+	DivergenceQuoting      DivergenceKind = "changed quoting"
+	DivergenceLineEndings  DivergenceKind = "changed line endings"
+	DivergenceKeyOrder     DivergenceKind = "reordered keys"
+	DivergenceLostKey      DivergenceKind = "lost key"
+	DivergenceLostMetadata DivergenceKind = "lost metadata"
+	DivergenceAddedKey     DivergenceKind = "added key"
+	DivergenceFormatting   DivergenceKind = "changed formatting"
+)
+
+// Divergence is a difference between an original data file and the file
+// produced by running it through pre-process and post-process.
+type Divergence struct {
+	File     string
+	Kind     DivergenceKind
+	Location string
+	Detail   string
+}
+
+func (d Divergence) String() string {
+	var b strings.Builder
+	b.WriteString(d.File)
+	b.WriteString(": ")
+	b.WriteString(string(d.Kind))
+	if d.Location != "" {
+		b.WriteString(" at ")
+		b.WriteString(d.Location)
+	}
+	if d.Detail != "" {
+		b.WriteString(": ")
+		b.WriteString(d.Detail)
+	}
+	return b.String()
+}
+
+// Verify runs pre-process and post-process for the data files in dataDir
+// into a scratch directory and compares the result with the originals. It
+// returns every divergence found, grouped by file.
+func Verify(ctx context.Context, dataType string, dataDir string, slugFields, ignoredFiles []string, opts Options) ([]Divergence, error) {
+	scratch, err := os.MkdirTemp("", "decapta-verify-")
+	if err != nil {
+		return nil, fmt.Errorf("error creating scratch directory: %v", err)
+	}
+	defer os.RemoveAll(scratch)
+
+	contentDir := filepath.Join(scratch, "content")
+	outDir := filepath.Join(scratch, "data")
+
+	opts.Output = nil
+	if err := PreProcess(ctx, dataType, dataDir, contentDir, slugFields, ignoredFiles, opts); err != nil {
+		return nil, err
+	}
+	// Record formats keep the comments and formatting of the files they replace
+	var copied []string
+	if f, ok := recordFormats[dataType]; ok {
+		copied, err = copyDataFiles(f, dataDir, outDir, ignoredFiles)
+		if err != nil {
+			return nil, err
+		}
+	}
+	out := &writtenOutput{written: make(map[string]bool)}
+	opts.Output = out
+	if err := PostProcess(ctx, dataType, contentDir, outDir, opts); err != nil {
+		return nil, err
+	}
+	// Copies post-process did not replace are reported as missing files
+	for _, name := range copied {
+		path := filepath.Join(outDir, name)
+		if out.written[path] {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("error removing %s: %v", path, err)
+		}
+	}
+
+	switch dataType {
+	case "arb":
+		return verifyARB(dataDir, outDir)
+	case "csv":
+		return verifyCSV(dataDir, outDir, ignoredFiles)
+	case "json":
+		return verifyRecords(jsonFormat, dataDir, outDir, ignoredFiles)
+	case "jsonl":
+		return verifyRecords(jsonlFormat, dataDir, outDir, ignoredFiles)
+	case "toml":
+		return verifyRecords(tomlFormat, dataDir, outDir, ignoredFiles)
+	case "xlsx":
+		return verifyRecords(xlsxFormat, dataDir, outDir, ignoredFiles)
+	case "yaml":
+		return verifyRecords(yamlFormat, dataDir, outDir, ignoredFiles)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedType, dataType)
+	}
+}
+
+func verifyCSV(csvDir string, outDir string, ignoredFiles []string) ([]Divergence, error) {
+	files, err := os.ReadDir(csvDir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV directory: %v", err)
+	}
+
+	var divergences []Divergence
+	for _, file := range files {
+		if contains(ignoredFiles, file.Name()) || !strings.HasSuffix(file.Name(), ".csv") {
+			continue
+		}
+
+		original, err := os.ReadFile(filepath.Join(csvDir, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error reading CSV file %s: %v", file.Name(), err)
+		}
+		if len(bytes.TrimSpace(original)) == 0 {
+			continue // Empty CSV files are not processed
+		}
+
+		result, err := os.ReadFile(filepath.Join(outDir, file.Name()))
+		if errors.Is(err, fs.ErrNotExist) {
+			divergences = append(divergences, Divergence{File: file.Name(), Kind: DivergenceMissingFile})
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading round-tripped CSV file %s: %v", file.Name(), err)
+		}
+
+		if bytes.Equal(original, result) {
+			continue
+		}
+
+		fileDivergences, err := compareCSV(file.Name(), original, result)
+		if err != nil {
+			return nil, err
+		}
+		if len(fileDivergences) == 0 {
+			// Same cells but different bytes
+			if bytes.Contains(original, []byte("\r\n")) != bytes.Contains(result, []byte("\r\n")) {
+				fileDivergences = append(fileDivergences, Divergence{File: file.Name(), Kind: DivergenceLineEndings})
+			} else {
+				fileDivergences = append(fileDivergences, Divergence{File: file.Name(), Kind: DivergenceQuoting})
+			}
+		}
+		divergences = append(divergences, fileDivergences...)
+	}
+
+	return divergences, nil
+}
+
+// compareCSV compares two CSV documents cell by cell, matching columns by name.
+func compareCSV(name string, original, result []byte) ([]Divergence, error) {
+	originalReader := csv.NewReader(bytes.NewReader(original))
+	originalReader.FieldsPerRecord = -1
+	resultReader := csv.NewReader(bytes.NewReader(result))
+	resultReader.FieldsPerRecord = -1
+
+	originalHeaders, err := originalReader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV file %s: %v", name, err)
+	}
+	resultHeaders, err := resultReader.Read()
+	if err != nil {
+		return []Divergence{{File: name, Kind: DivergenceHeaders, Detail: "round-tripped file has no headers"}}, nil
+	}
+
+	var divergences []Divergence
+	if !reflect.DeepEqual(originalHeaders, resultHeaders) {
+		divergences = append(divergences, Divergence{
+			File:   name,
+			Kind:   DivergenceHeaders,
+			Detail: fmt.Sprintf("%q became %q", originalHeaders, resultHeaders),
+		})
+	}
+
+	resultIndex := make(map[string]int, len(resultHeaders))
+	for i, header := range resultHeaders {
+		resultIndex[header] = i
+	}
+
+	row := 0
+	for {
+		originalRecord, originalErr := originalReader.Read()
+		resultRecord, resultErr := resultReader.Read()
+		if originalErr == io.EOF || resultErr == io.EOF {
+			if originalErr != resultErr {
+				originalRows, resultRows := row+countRemaining(originalReader, originalErr), row+countRemaining(resultReader, resultErr)
+				divergences = append(divergences, Divergence{
+					File:   name,
+					Kind:   DivergenceRowCount,
+					Detail: fmt.Sprintf("%d rows became %d rows", originalRows, resultRows),
+				})
+			}
+			break
+		}
+		if originalErr != nil {
+			return nil, fmt.Errorf("error reading CSV file %s: %v", name, originalErr)
+		}
+		if resultErr != nil {
+			return nil, fmt.Errorf("error reading round-tripped CSV file %s: %v", name, resultErr)
+		}
+		row++
+
+		for i, header := range originalHeaders {
+			originalValue := ""
+			if i < len(originalRecord) {
+				originalValue = originalRecord[i]
+			}
+			resultValue := ""
+			if j, ok := resultIndex[header]; ok && j < len(resultRecord) {
+				resultValue = resultRecord[j]
+			}
+			if originalValue == resultValue {
+				continue
+			}
+			divergences = append(divergences, Divergence{
+				File:     name,
+				Kind:     classifyValueChange(originalValue, resultValue),
+				Location: fmt.Sprintf("row %d, column %s", row, header),
+				Detail:   fmt.Sprintf("%q became %q", originalValue, resultValue),
+			})
+		}
+	}
+
+	return divergences, nil
+}
+
+// countRemaining counts the records left in reader, including the one just
+// read if err is nil.
+func countRemaining(reader *csv.Reader, err error) int {
+	if err == io.EOF {
+		return 0
+	}
+	n := 1
+	for {
+		if _, err := reader.Read(); err == io.EOF {
+			return n
+		}
+		n++
+	}
+}
+
+// classifyValueChange tells type coercions and whitespace changes apart from
+// edits of the value itself.
+func classifyValueChange(original, result string) DivergenceKind {
+	if strings.Join(strings.Fields(original), " ") == strings.Join(strings.Fields(result), " ") {
+		return DivergenceWhitespace
+	}
+
+	if b1, ok1 := parseLooseBool(original); ok1 {
+		if b2, ok2 := parseLooseBool(result); ok2 && b1 == b2 {
+			return DivergenceTypeCoercion
+		}
+	}
+	if f1, err := strconv.ParseFloat(strings.TrimSpace(original), 64); err == nil {
+		if f2, err := strconv.ParseFloat(strings.TrimSpace(result), 64); err == nil && f1 == f2 {
+			return DivergenceTypeCoercion
+		}
+	}
+	return DivergenceValue
+}
+
+func parseLooseBool(value string) (bool, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "yes", "y", "on":
+		return true, true
+	case "false", "no", "n", "off":
+		return false, true
+	}
+	return false, false
+}
+
+func verifyARB(arbDir string, outDir string) ([]Divergence, error) {
+	files, err := os.ReadDir(arbDir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading ARB directory: %v", err)
+	}
+
+	var divergences []Divergence
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".arb") {
+			continue
+		}
+		language := extractLanguage(file.Name())
+		if language == "" {
+			continue // Not processed by pre-process
+		}
+
+		original, err := os.ReadFile(filepath.Join(arbDir, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("error reading ARB file %s: %v", file.Name(), err)
+		}
+
+		resultName := fmt.Sprintf("app_%s.arb", language)
+		if resultName != file.Name() {
+			divergences = append(divergences, Divergence{
+				File:   file.Name(),
+				Kind:   DivergenceRenamedFile,
+				Detail: fmt.Sprintf("written back as %s", resultName),
+			})
+		}
+
+		result, err := os.ReadFile(filepath.Join(outDir, resultName))
+		if errors.Is(err, fs.ErrNotExist) {
+			divergences = append(divergences, Divergence{File: file.Name(), Kind: DivergenceMissingFile})
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading round-tripped ARB file %s: %v", resultName, err)
+		}
+
+		if bytes.Equal(original, result) {
+			continue
+		}
+
+		originalValue, err := decodeOrderedJSON(original)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing ARB file %s: %v", file.Name(), err)
+		}
+		resultValue, err := decodeOrderedJSON(result)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing round-tripped ARB file %s: %v", resultName, err)
+		}
+
+		fileDivergences := compareJSON(file.Name(), "", originalValue, resultValue)
+		if len(fileDivergences) == 0 {
+			fileDivergences = append(fileDivergences, Divergence{
+				File:   file.Name(),
+				Kind:   DivergenceFormatting,
+				Detail: "same content with different indentation, escaping or trailing newline",
+			})
+		}
+		divergences = append(divergences, fileDivergences...)
+	}
+
+	return divergences, nil
+}
+
+// recordFormats are the data types processed as records.
+var recordFormats = map[string]recordFormat{
+	"json":  jsonFormat,
+	"jsonl": jsonlFormat,
+	"toml":  tomlFormat,
+	"xlsx":  xlsxFormat,
+	"yaml":  yamlFormat,
+}
+
+// copyDataFiles copies the data files of dataDir into outDir and returns
+// their names.
+func copyDataFiles(f recordFormat, dataDir string, outDir string, ignoredFiles []string) ([]string, error) {
+	files, err := f.dataFiles(dataDir, ignoredFiles)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return nil, fmt.Errorf("error creating directory %s: %v", outDir, err)
+	}
+	for _, name := range files {
+		data, err := os.ReadFile(filepath.Join(dataDir, name))
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s file %s: %v", f.Label, name, err)
+		}
+		if err := os.WriteFile(filepath.Join(outDir, name), data, 0644); err != nil {
+			return nil, fmt.Errorf("error writing %s file %s: %v", f.Label, name, err)
+		}
+	}
+	return files, nil
+}
+
+// writtenOutput writes to disk and records the paths of the files written.
+type writtenOutput struct {
+	DiskOutput
+
+	mu      sync.Mutex
+	written map[string]bool
+}
+
+func (o *writtenOutput) Create(path string) (io.WriteCloser, error) {
+	w, err := o.DiskOutput.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	o.record(path, true)
+	return w, nil
+}
+
+func (o *writtenOutput) WriteFile(path string, data []byte) error {
+	if err := o.DiskOutput.WriteFile(path, data); err != nil {
+		return err
+	}
+	o.record(path, true)
+	return nil
+}
+
+func (o *writtenOutput) Remove(path string) error {
+	if err := o.DiskOutput.Remove(path); err != nil {
+		return err
+	}
+	o.record(path, false)
+	return nil
+}
+
+func (o *writtenOutput) record(path string, written bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.written[filepath.Clean(path)] = written
+}
+
+// verifyRecords compares the records of round-tripped data files, such as
+// JSON files, with the originals.
+func verifyRecords(f recordFormat, dataDir string, outDir string, ignoredFiles []string) ([]Divergence, error) {
+	files, err := f.dataFiles(dataDir, ignoredFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	var divergences []Divergence
+	for _, name := range files {
+		original, err := os.ReadFile(filepath.Join(dataDir, name))
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s file %s: %v", f.Label, name, err)
+		}
+		result, err := os.ReadFile(filepath.Join(outDir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			divergences = append(divergences, Divergence{File: name, Kind: DivergenceMissingFile})
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading round-tripped %s file %s: %v", f.Label, name, err)
+		}
+		if bytes.Equal(original, result) {
+			continue
+		}
+
+		originalRecords, _, err := f.Decode(original)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s file %s: %v", f.Label, name, err)
+		}
+		resultRecords, _, err := f.Decode(result)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing round-tripped %s file %s: %v", f.Label, name, err)
+		}
+
+		fileDivergences := compareJSON(name, "", recordArray(originalRecords), recordArray(resultRecords))
+		if len(fileDivergences) == 0 {
+			fileDivergences = append(fileDivergences, Divergence{
+				File:   name,
+				Kind:   DivergenceFormatting,
+				Detail: "same records with different indentation, escaping or line endings",
+			})
+		}
+		divergences = append(divergences, fileDivergences...)
+	}
+
+	return divergences, nil
+}
+
+func recordArray(records []OrderedMap) []interface{} {
+	array := make([]interface{}, len(records))
+	for i, record := range records {
+		array[i] = record
+	}
+	return array
+}
+
+// compareJSON compares two decoded JSON values, reporting lost, added and
+// reordered keys as well as changed values below path.
+func compareJSON(file string, path string, original, result interface{}) []Divergence {
+	location := path
+	if location == "" {
+		location = "top level"
+	}
+
+	switch originalValue := original.(type) {
+	case OrderedMap:
+		resultValue, ok := result.(OrderedMap)
+		if !ok {
+			return []Divergence{{File: file, Kind: DivergenceTypeCoercion, Location: location, Detail: fmt.Sprintf("object became %s", jsonTypeName(result))}}
+		}
+
+		var divergences []Divergence
+		var originalOrder, resultOrder []string
+		for _, kv := range originalValue {
+			childPath := joinJSONPath(path, kv.Key)
+			resultChild, found := resultValue.Get(kv.Key)
+			if !found {
+				kind := DivergenceLostKey
+				if strings.HasPrefix(kv.Key, "@") || strings.Contains(path, "@") {
+					kind = DivergenceLostMetadata
+				}
+				divergences = append(divergences, Divergence{File: file, Kind: kind, Location: childPath})
+				continue
+			}
+			originalOrder = append(originalOrder, kv.Key)
+			divergences = append(divergences, compareJSON(file, childPath, kv.Value, resultChild)...)
+		}
+		for _, kv := range resultValue {
+			if _, found := originalValue.Get(kv.Key); !found {
+				divergences = append(divergences, Divergence{File: file, Kind: DivergenceAddedKey, Location: joinJSONPath(path, kv.Key)})
+				continue
+			}
+			resultOrder = append(resultOrder, kv.Key)
+		}
+		for i := range originalOrder {
+			if originalOrder[i] != resultOrder[i] {
+				divergences = append(divergences, Divergence{
+					File:     file,
+					Kind:     DivergenceKeyOrder,
+					Location: location,
+					Detail:   fmt.Sprintf("expected %q at position %d, found %q", originalOrder[i], i+1, resultOrder[i]),
+				})
+				break
+			}
+		}
+		return divergences
+
+	case []interface{}:
+		resultValue, ok := result.([]interface{})
+		if !ok {
+			return []Divergence{{File: file, Kind: DivergenceTypeCoercion, Location: location, Detail: fmt.Sprintf("array became %s", jsonTypeName(result))}}
+		}
+		if len(originalValue) != len(resultValue) {
+			return []Divergence{{File: file, Kind: DivergenceValue, Location: location, Detail: fmt.Sprintf("%d elements became %d", len(originalValue), len(resultValue))}}
+		}
+		var divergences []Divergence
+		for i := range originalValue {
+			divergences = append(divergences, compareJSON(file, fmt.Sprintf("%s[%d]", path, i), originalValue[i], resultValue[i])...)
+		}
+		return divergences
+
+	default:
+		if jsonTypeName(original) != jsonTypeName(result) {
+			return []Divergence{{File: file, Kind: DivergenceTypeCoercion, Location: location, Detail: fmt.Sprintf("%s %v became %s %v", jsonTypeName(original), original, jsonTypeName(result), result)}}
+		}
+		if original != result {
+			kind := DivergenceValue
+			if originalNumber, ok := original.(json.Number); ok {
+				f1, _ := originalNumber.Float64()
+				f2, _ := result.(json.Number).Float64()
+				if f1 == f2 {
+					kind = DivergenceFormatting
+				}
+			}
+			return []Divergence{{File: file, Kind: kind, Location: location, Detail: fmt.Sprintf("%v became %v", original, result)}}
+		}
+		return nil
+	}
+}
+
+func joinJSONPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case OrderedMap:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	case time.Time:
+		return "datetime"
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
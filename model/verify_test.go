@@ -0,0 +1,54 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyReportsUnwrittenFiles(t *testing.T) {
+	dataDir := t.TempDir()
+	for name, data := range map[string]string{
+		"a.json": "[\n  {\n    \"id\": 1\n  }\n]\n",
+		"b.json": "[\n  {\n    \"id\": 2\n  }\n]\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dataDir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := context.Background()
+	divergences, err := Verify(ctx, "json", dataDir, nil, nil, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(divergences) != 0 {
+		t.Errorf("divergences = %v, want none", divergences)
+	}
+
+	// b.json is pre-processed but not post-processed, so its copy in the
+	// scratch directory must not pass for a round-tripped file
+	only := map[string]bool{"a.json": true, "b.json": true, "a": true}
+	divergences, err = Verify(ctx, "json", dataDir, nil, nil, Options{Only: only})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(divergences) != 1 || divergences[0].File != "b.json" || divergences[0].Kind != DivergenceMissingFile {
+		t.Errorf("divergences = %v, want b.json: %s", divergences, DivergenceMissingFile)
+	}
+}
@@ -0,0 +1,787 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// xlsxFormat reads Excel workbooks as a mapping of sheet names to the rows of
+// each data sheet. Encode writes the rows into the original workbook, so
+// everything else in it is kept.
+var xlsxFormat = recordFormat{
+	Name:       "xlsx",
+	Label:      "Excel",
+	Extensions: []string{".xlsx"},
+	Decode:     decodeXLSXRecords,
+	Encode:     encodeXLSXRecords,
+}
+
+// xlsxLayout records the data sheets of a workbook in sheet order.
+type xlsxLayout struct {
+	Sheets []xlsxSheet `yaml:"sheets,omitempty"`
+}
+
+// xlsxSheet is a data sheet with a content file per row.
+type xlsxSheet struct {
+	Name string `yaml:"name"`
+	// Dir is the content directory of the rows, within the directory of the
+	// workbook.
+	Dir        string `yaml:"dir"`
+	dataLayout `yaml:",inline"`
+}
+
+// xlsxData is a data sheet read from a workbook: a header row followed by a
+// row per record. Formulas holds the first formula of each column by key, and
+// Calculated the columns whose values are all calculated by formulas.
+type xlsxData struct {
+	Name       string
+	Keys       []string
+	Rows       []OrderedMap
+	Formulas   map[string]string
+	Calculated map[string]bool
+}
+
+// editableRows returns the rows without their calculated columns, which are
+// not edited in the CMS as the workbook recalculates them.
+func (d xlsxData) editableRows() []OrderedMap {
+	if len(d.Calculated) == 0 {
+		return d.Rows
+	}
+	rows := make([]OrderedMap, len(d.Rows))
+	for i, row := range d.Rows {
+		rows[i] = make(OrderedMap, 0, len(row))
+		for _, kv := range row {
+			if !d.Calculated[kv.Key] {
+				rows[i] = append(rows[i], kv)
+			}
+		}
+	}
+	return rows
+}
+
+// XLSXPreProcess reads Excel workbooks and creates a file per row of each data
+// sheet for Decap CMS.
+func XLSXPreProcess(ctx context.Context, xlsxDir string, contentDir string, slugFields, ignoredFiles []string, opts Options) error {
+	files, err := xlsxFiles(xlsxDir, ignoredFiles)
+	if err != nil {
+		return err
+	}
+
+	p := newPool(ctx, opts.Jobs)
+	for i, name := range files {
+		if opts.Only != nil && !opts.Only[name] {
+			continue
+		}
+
+		path := filepath.Join(xlsxDir, name)
+		p.Go(i, func(ctx context.Context) error {
+			return xlsxPreProcessFile(ctx, path, contentDir, slugFields, opts)
+		})
+	}
+
+	return p.Wait()
+}
+
+// xlsxFiles lists the workbooks in xlsxDir, without the lock files Excel
+// creates next to open workbooks.
+func xlsxFiles(xlsxDir string, ignoredFiles []string) ([]string, error) {
+	files, err := xlsxFormat.dataFiles(xlsxDir, ignoredFiles)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range files {
+		if !strings.HasPrefix(name, "~$") {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func xlsxPreProcessFile(ctx context.Context, path string, contentDir string, slugFields []string, opts Options) error {
+	sheets, err := readWorkbookFile(path)
+	if err != nil {
+		return err
+	}
+
+	dataName, _, _ := xlsxFormat.dataName(filepath.Base(path))
+	var layout xlsxLayout
+	out := opts.output()
+
+	// Content directories are named after the sheets, as safely as fields
+	names := make([]string, len(sheets))
+	for i, sheet := range sheets {
+		names[i] = sheet.Name
+	}
+	dirs := fieldNames(names, nil)
+	for i, data := range sheets {
+		sheet := xlsxSheet{Name: data.Name, Dir: dirs[i]}
+		rows := data.editableRows()
+		nameOfKey := sheet.setColumns(rows, opts.Reserved)
+		dir := filepath.Join(contentDir, dataName, sheet.Dir)
+		if err := writeRecords(ctx, out, dir, rows, nameOfKey, slugFields, opts.Jobs); err != nil {
+			return err
+		}
+		layout.Sheets = append(layout.Sheets, sheet)
+	}
+
+	layoutFilePath := filepath.Join(contentDir, fmt.Sprintf(".%s.yaml", dataName))
+	yamlData, err := yaml.Marshal(layout)
+	if err != nil {
+		return fmt.Errorf("error writing layout to file %s: %v", layoutFilePath, err)
+	}
+	if err := out.WriteFile(layoutFilePath, yamlData); err != nil {
+		return fmt.Errorf("error writing layout to file %s: %v", layoutFilePath, err)
+	}
+	return nil
+}
+
+// XLSXPostProcess reads the content files and writes the rows back into the
+// Excel workbooks. Workbooks are only replaced once every workbook has been
+// written successfully.
+func XLSXPostProcess(ctx context.Context, contentDir string, xlsxDir string, opts Options) error {
+	entries, err := os.ReadDir(contentDir)
+	if err != nil {
+		return fmt.Errorf("error reading content directory: %v", err)
+	}
+
+	out := opts.Output
+	var tx *Transaction
+	if out == nil {
+		tx, err = NewTransaction(xlsxDir)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		out = tx
+	}
+
+	p := newPool(ctx, opts.Jobs)
+	for i, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if opts.Only != nil && !opts.Only[entry.Name()] {
+			continue
+		}
+
+		dataName := entry.Name()
+		p.Go(i, func(ctx context.Context) error {
+			return xlsxPostProcessFile(ctx, contentDir, dataName, xlsxDir, out)
+		})
+	}
+
+	if err := p.Wait(); err != nil {
+		return err
+	}
+
+	if tx != nil {
+		return tx.Commit()
+	}
+	return nil
+}
+
+func xlsxPostProcessFile(ctx context.Context, contentDir string, dataName string, xlsxDir string, out Output) error {
+	layoutFilePath := filepath.Join(contentDir, fmt.Sprintf(".%s.yaml", dataName))
+	yamlContent, err := os.ReadFile(layoutFilePath)
+	if err != nil {
+		return fmt.Errorf("error reading layout from file %s: %v", layoutFilePath, err)
+	}
+	var layout xlsxLayout
+	if err := yaml.Unmarshal(yamlContent, &layout); err != nil {
+		return fmt.Errorf("error reading layout from file %s: %v", layoutFilePath, err)
+	}
+
+	dataFilePath := xlsxFormat.dataFile(xlsxDir, dataName, dataLayout{})
+	original, originals := xlsxFormat.readOriginal(dataFilePath)
+	if original == nil {
+		return fmt.Errorf("error reading Excel file %s: the original workbook is written into and must exist", dataFilePath)
+	}
+	var originalDoc OrderedMap
+	if len(originals) == 1 {
+		originalDoc = originals[0]
+	}
+
+	var doc OrderedMap
+	for _, sheet := range layout.Sheets {
+		dir := filepath.Join(contentDir, dataName, sheet.Dir)
+		files, err := os.ReadDir(dir)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("error reading Excel content directory %s: %v", dir, err)
+		}
+		sort.Slice(files, func(i, j int) bool {
+			return extractFileNumber(files[i].Name()) < extractFileNumber(files[j].Name())
+		})
+
+		originalRows, _ := originalDoc.Get(sheet.Name)
+		records, err := readRecords(ctx, dir, files, sheet.keyOfName(), recordList(originalRows))
+		if err != nil {
+			return err
+		}
+		doc = append(doc, KVPair{Key: sheet.Name, Value: recordArray(records)})
+	}
+
+	return xlsxFormat.writeFile(out, dataFilePath, []OrderedMap{doc}, dataLayout{}, original)
+}
+
+// XLSXGenerateConfig generates the config.yml for Excel workbooks, with a
+// folder collection per data sheet.
+func XLSXGenerateConfig(xlsxDir string, outputFile string, templateData, indexHTML []byte, contentDir string, ignoredFiles []string, opts Options) error {
+	files, err := xlsxFiles(xlsxDir, ignoredFiles)
+	if err != nil {
+		return err
+	}
+
+	var collections []Collection
+	for _, name := range files {
+		sheets, err := readWorkbookFile(filepath.Join(xlsxDir, name))
+		if err != nil {
+			return err
+		}
+		dataName, _, _ := xlsxFormat.dataName(name)
+
+		names := make([]string, len(sheets))
+		for i, sheet := range sheets {
+			names[i] = sheet.Name
+		}
+		dirs := fieldNames(names, nil)
+		for i, sheet := range sheets {
+			collection := folderCollection(
+				fmt.Sprintf("xlsx_%s_%s", dataName, dirs[i]),
+				fmt.Sprintf("Excel Data (%s: %s)", dataName, sheet.Name),
+				filepath.Join(contentDir, dataName, dirs[i]),
+				sheet.editableRows(), opts)
+
+			// Fields are labelled with their column header
+			for j, field := range collection.Fields {
+				if formula, ok := sheet.Formulas[field.Label]; ok && j > 0 {
+					collection.Fields[j].Hint = fmt.Sprintf("Calculated by the workbook in some rows (=%s), edits to those rows are not saved", formula)
+				}
+			}
+			collections = append(collections, collection)
+		}
+	}
+
+	err = writeCollections(collections, map[string]preview{}, templateData, indexHTML, outputFile, opts)
+	if err != nil {
+		return fmt.Errorf("error writing config: %v", err)
+	}
+	return nil
+}
+
+func readWorkbookFile(path string) ([]xlsxData, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading Excel file %s: %v", path, err)
+	}
+	f, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing Excel file %s: %v", path, err)
+	}
+	defer f.Close()
+
+	sheets, err := readWorkbook(f)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing Excel file %s: %v", path, err)
+	}
+	return sheets, nil
+}
+
+func decodeXLSXRecords(data []byte) ([]OrderedMap, dataLayout, error) {
+	layout := dataLayout{Kind: layoutKindMap}
+	f, err := excelize.OpenReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, layout, err
+	}
+	defer f.Close()
+
+	sheets, err := readWorkbook(f)
+	if err != nil {
+		return nil, layout, err
+	}
+	doc := make(OrderedMap, 0, len(sheets))
+	for _, sheet := range sheets {
+		doc = append(doc, KVPair{Key: sheet.Name, Value: recordArray(sheet.Rows)})
+	}
+	return []OrderedMap{doc}, layout, nil
+}
+
+// readWorkbook reads the data sheets of a workbook in sheet order. Data sheets
+// are visible worksheets with a header row of values; hidden sheets, chart
+// sheets and empty sheets are left alone.
+func readWorkbook(f *excelize.File) ([]xlsxData, error) {
+	props, err := f.GetWorkbookProps()
+	if err != nil {
+		return nil, err
+	}
+	r := xlsxReader{f: f, date1904: props.Date1904 != nil && *props.Date1904, dateStyles: make(map[int]bool)}
+
+	worksheets, err := worksheetNames(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var sheets []xlsxData
+	for _, name := range f.GetSheetList() {
+		if !worksheets[name] {
+			continue // Chart, dialog and macro sheets have no rows
+		}
+		sheet, ok, err := r.sheet(name)
+		if err != nil {
+			return nil, fmt.Errorf("sheet %s: %v", name, err)
+		}
+		if ok {
+			sheets = append(sheets, sheet)
+		}
+	}
+	return sheets, nil
+}
+
+type xlsxReader struct {
+	f          *excelize.File
+	date1904   bool
+	dateStyles map[int]bool
+}
+
+// sheet reads a data sheet: a visible worksheet with a header row of text
+// and at least one row of values.
+func (r *xlsxReader) sheet(name string) (xlsxData, bool, error) {
+	data := xlsxData{Name: name, Formulas: make(map[string]string), Calculated: make(map[string]bool)}
+	rows, err := r.f.GetRows(name, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return data, false, err
+	}
+	visible, err := r.f.GetSheetVisible(name)
+	if err != nil || !visible || len(rows) < 2 {
+		return data, false, err
+	}
+
+	headers := rows[0]
+	for col, header := range headers {
+		if header == "" {
+			continue
+		}
+		cell, _ := excelize.CoordinatesToCellName(col+1, 1)
+		cellType, err := r.f.GetCellType(name, cell)
+		if err != nil {
+			return data, false, err
+		}
+		if cellType != excelize.CellTypeSharedString && cellType != excelize.CellTypeInlineString {
+			return data, false, nil // Numbers, dates and formulas are not headers
+		}
+	}
+	if strings.TrimSpace(strings.Join(headers, "")) == "" {
+		return data, false, nil
+	}
+	data.Keys = xlsxKeys(headers)
+
+	formulas := make(map[string]int)
+	values := make(map[string]int)
+	for i, row := range rows[1:] {
+		record := make(OrderedMap, 0, len(data.Keys))
+		for col, key := range data.Keys {
+			cell, _ := excelize.CoordinatesToCellName(col+1, i+2)
+			var raw string
+			if col < len(row) {
+				raw = row[col]
+			}
+			value, err := r.value(name, cell, raw)
+			if err != nil {
+				return data, false, fmt.Errorf("cell %s: %v", cell, err)
+			}
+			record = append(record, KVPair{Key: key, Value: value})
+
+			formula, err := r.f.GetCellFormula(name, cell)
+			if err != nil {
+				return data, false, fmt.Errorf("cell %s: %v", cell, err)
+			}
+			if formula != "" {
+				formulas[key]++
+				if _, ok := data.Formulas[key]; !ok {
+					data.Formulas[key] = formula
+				}
+			} else if raw != "" {
+				values[key]++
+			}
+		}
+		data.Rows = append(data.Rows, record)
+	}
+	if len(formulas)+len(values) == 0 {
+		return data, false, nil // Rows without values
+	}
+
+	// Columns of formulas only are calculated, mixed ones keep their hint
+	for key := range formulas {
+		if values[key] == 0 {
+			data.Calculated[key] = true
+			delete(data.Formulas, key)
+		}
+	}
+	return data, true, nil
+}
+
+// worksheetNames returns the names of the worksheets of a workbook, told from
+// chart, dialog and macro sheets by the relationship of each sheet.
+func worksheetNames(f *excelize.File) (map[string]bool, error) {
+	workbookPath := "xl/workbook.xml"
+	var rootRels packageRelationships
+	if err := readPackageXML(f, "_rels/.rels", &rootRels); err != nil {
+		return nil, err
+	}
+	for _, rel := range rootRels.Relationships {
+		if strings.HasSuffix(rel.Type, "/officeDocument") {
+			workbookPath = strings.TrimPrefix(rel.Target, "/")
+		}
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			Name  string     `xml:"name,attr"`
+			Attrs []xml.Attr `xml:",any,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := readPackageXML(f, workbookPath, &workbook); err != nil {
+		return nil, err
+	}
+	var rels packageRelationships
+	relsPath := path.Join(path.Dir(workbookPath), "_rels", path.Base(workbookPath)+".rels")
+	if err := readPackageXML(f, relsPath, &rels); err != nil {
+		return nil, err
+	}
+	types := make(map[string]string, len(rels.Relationships))
+	for _, rel := range rels.Relationships {
+		types[rel.ID] = rel.Type
+	}
+
+	names := make(map[string]bool, len(workbook.Sheets))
+	for _, sheet := range workbook.Sheets {
+		for _, attr := range sheet.Attrs {
+			if attr.Name.Local == "id" && strings.HasSuffix(types[attr.Value], "/worksheet") {
+				names[sheet.Name] = true
+			}
+		}
+	}
+	return names, nil
+}
+
+// packageRelationships is a relationships part of the workbook package.
+type packageRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Type   string `xml:"Type,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+func readPackageXML(f *excelize.File, name string, v interface{}) error {
+	content, _ := f.Pkg.Load(name)
+	data, ok := content.([]byte)
+	if !ok {
+		return fmt.Errorf("missing %s", name)
+	}
+	if err := xml.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("error parsing %s: %v", name, err)
+	}
+	return nil
+}
+
+// xlsxKeys returns the keys of a header row. Columns without a header are
+// named after their column letter, and duplicate headers are numbered.
+func xlsxKeys(headers []string) []string {
+	taken := make(map[string]bool, len(headers))
+	keys := make([]string, len(headers))
+	for i, header := range headers {
+		key := header
+		if strings.TrimSpace(key) == "" {
+			key, _ = excelize.ColumnNumberToName(i + 1)
+		}
+		unique := key
+		for n := 2; taken[unique]; n++ {
+			unique = fmt.Sprintf("%s_%d", key, n)
+		}
+		taken[unique] = true
+		keys[i] = unique
+	}
+	return keys
+}
+
+// value returns the value of a cell by its type: booleans, strings, numbers
+// as json.Number, and numbers with a date format as times. Formula cells have
+// the value of their last calculation.
+func (r *xlsxReader) value(sheet string, cell string, raw string) (interface{}, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	cellType, err := r.f.GetCellType(sheet, cell)
+	if err != nil {
+		return nil, err
+	}
+	switch cellType {
+	case excelize.CellTypeBool:
+		return raw == "1" || strings.EqualFold(raw, "true"), nil
+	case excelize.CellTypeSharedString, excelize.CellTypeInlineString, excelize.CellTypeFormula, excelize.CellTypeError:
+		return raw, nil
+	case excelize.CellTypeDate:
+		t, err := time.Parse("2006-01-02T15:04:05.999999999", strings.TrimSuffix(raw, "Z"))
+		if err != nil {
+			return raw, nil
+		}
+		return t, nil
+	}
+
+	f, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return raw, nil
+	}
+	styleID, err := r.f.GetCellStyle(sheet, cell)
+	if err != nil {
+		return nil, err
+	}
+	if r.isDateStyle(styleID) {
+		t, err := excelize.ExcelDateToTime(f, r.date1904)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return json.Number(formatXLSXNumber(f)), nil
+}
+
+// formatXLSXNumber formats a number in its shortest form, as the 17 digits
+// Excel stores are not how numbers were entered.
+func formatXLSXNumber(f float64) string {
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		return strconv.FormatFloat(f, 'e', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// isDateStyle reports whether a cell style formats numbers as dates or times.
+func (r *xlsxReader) isDateStyle(styleID int) bool {
+	if isDate, ok := r.dateStyles[styleID]; ok {
+		return isDate
+	}
+	isDate := false
+	if style, err := r.f.GetStyle(styleID); err == nil {
+		isDate = isDateNumFmt(style.NumFmt, style.CustomNumFmt)
+	}
+	r.dateStyles[styleID] = isDate
+	return isDate
+}
+
+// isDateNumFmt reports whether a built-in or custom number format is a date
+// or time format.
+func isDateNumFmt(numFmt int, custom *string) bool {
+	if custom == nil {
+		return numFmt >= 14 && numFmt <= 22 || numFmt >= 27 && numFmt <= 36 ||
+			numFmt >= 45 && numFmt <= 47 || numFmt >= 50 && numFmt <= 58
+	}
+	// Date parts outside of literal text, colors and conditions
+	var b strings.Builder
+	literal, bracket, escaped := false, false, false
+	for _, c := range strings.ToLower(*custom) {
+		switch {
+		case escaped:
+			escaped = false
+		case literal:
+			literal = c != '"'
+		case bracket:
+			bracket = c != ']'
+		case c == '"':
+			literal = true
+		case c == '[':
+			bracket = true
+		case c == '\\' || c == '_' || c == '*':
+			escaped = true
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return strings.ContainsAny(b.String(), "ymdhs")
+}
+
+func encodeXLSXRecords(records []OrderedMap, layout dataLayout, original []byte) ([]byte, error) {
+	if original == nil {
+		return nil, fmt.Errorf("the original workbook is required")
+	}
+	f, err := excelize.OpenReader(bytes.NewReader(original))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sheets, err := readWorkbook(f)
+	if err != nil {
+		return nil, err
+	}
+	w := xlsxWriter{f: f}
+	for _, sheet := range sheets {
+		value, ok := records[0].Get(sheet.Name)
+		if !ok {
+			continue
+		}
+		if err := w.sheet(sheet, recordList(value)); err != nil {
+			return nil, fmt.Errorf("sheet %s: %v", sheet.Name, err)
+		}
+	}
+
+	// An unchanged workbook is kept byte for byte
+	if !w.changed {
+		return original, nil
+	}
+	// Formula results are recalculated when the workbook is opened
+	if err := f.SetCalcProps(&excelize.CalcPropsOptions{FullCalcOnLoad: boolPtr(true)}); err != nil {
+		return nil, err
+	}
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// xlsxWriter writes records into the data sheets of a workbook. Only changed
+// cells are written, and cells with formulas are never written.
+type xlsxWriter struct {
+	f         *excelize.File
+	changed   bool
+	dateStyle int
+}
+
+func (w *xlsxWriter) sheet(sheet xlsxData, records []OrderedMap) error {
+	for i, record := range records {
+		row := i + 2
+		for col, key := range sheet.Keys {
+			var original interface{}
+			if i < len(sheet.Rows) {
+				original, _ = sheet.Rows[i].Get(key)
+			}
+			value, _ := record.Get(key)
+			if valuesEqual(value, original) || original == nil && isEmptyValue(value) {
+				continue
+			}
+
+			cell, _ := excelize.CoordinatesToCellName(col+1, row)
+			formula, err := w.f.GetCellFormula(sheet.Name, cell)
+			if err != nil {
+				return err
+			}
+			if formula != "" {
+				continue // Formula results are read-only
+			}
+			// New rows are styled like the last row, for number formats
+			if i >= len(sheet.Rows) && len(sheet.Rows) > 0 {
+				above, _ := excelize.CoordinatesToCellName(col+1, len(sheet.Rows)+1)
+				if err := w.copyStyle(sheet.Name, above, cell); err != nil {
+					return err
+				}
+			}
+			if err := w.cell(sheet.Name, cell, value); err != nil {
+				return fmt.Errorf("cell %s: %v", cell, err)
+			}
+			w.changed = true
+		}
+	}
+
+	// Rows of removed records, from the bottom
+	for row := len(sheet.Rows) + 1; row > len(records)+1; row-- {
+		if err := w.f.RemoveRow(sheet.Name, row); err != nil {
+			return err
+		}
+		w.changed = true
+	}
+	return nil
+}
+
+func (w *xlsxWriter) copyStyle(sheet string, from string, to string) error {
+	styleID, err := w.f.GetCellStyle(sheet, to)
+	if err != nil || styleID != 0 {
+		return err
+	}
+	if styleID, err = w.f.GetCellStyle(sheet, from); err != nil || styleID == 0 {
+		return err
+	}
+	return w.f.SetCellStyle(sheet, to, to, styleID)
+}
+
+func (w *xlsxWriter) cell(sheet string, cell string, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		return w.f.SetCellValue(sheet, cell, nil)
+	case string:
+		if v == "" {
+			return w.f.SetCellValue(sheet, cell, nil)
+		}
+		// The datetime widget writes strings, dates go into date cells
+		styleID, err := w.f.GetCellStyle(sheet, cell)
+		if err != nil {
+			return err
+		}
+		r := xlsxReader{f: w.f, dateStyles: make(map[int]bool)}
+		if r.isDateStyle(styleID) {
+			if t, err := parseDate(v); err == nil {
+				return w.cell(sheet, cell, t)
+			}
+		}
+		return w.f.SetCellStr(sheet, cell, v)
+	case bool:
+		return w.f.SetCellBool(sheet, cell, v)
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return w.f.SetCellInt(sheet, cell, n)
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return err
+		}
+		return w.f.SetCellFloat(sheet, cell, f, -1, 64)
+	case time.Time:
+		// Dates without a cell style are formatted as dates, not date-times
+		styleID, err := w.f.GetCellStyle(sheet, cell)
+		if err != nil {
+			return err
+		}
+		if styleID == 0 && isDate(v) {
+			if w.dateStyle == 0 {
+				if w.dateStyle, err = w.f.NewStyle(&excelize.Style{NumFmt: 14}); err != nil {
+					return err
+				}
+			}
+			if err := w.f.SetCellStyle(sheet, cell, cell, w.dateStyle); err != nil {
+				return err
+			}
+		}
+		return w.f.SetCellValue(sheet, cell, v)
+	default:
+		return w.f.SetCellStr(sheet, cell, fmt.Sprint(v))
+	}
+}
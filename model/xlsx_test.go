@@ -0,0 +1,109 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestReadWorkbookSheets(t *testing.T) {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	set := func(sheet, cell string, value interface{}) {
+		t.Helper()
+		if err := f.SetCellValue(sheet, cell, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.SetSheetName("Sheet1", "Products"); err != nil {
+		t.Fatal(err)
+	}
+	set("Products", "A1", "name")
+	set("Products", "B1", "price")
+	set("Products", "C1", "total")
+	set("Products", "D1", "note")
+	for i, name := range []string{"Notebook", "Pencil"} {
+		row := i + 2
+		set("Products", cellName(t, 1, row), name)
+		set("Products", cellName(t, 2, row), 1.5)
+		if err := f.SetCellFormula("Products", cellName(t, 3, row), "B2*2"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A column mixing a formula and a value stays editable
+	if err := f.SetCellFormula("Products", "D2", "A2"); err != nil {
+		t.Fatal(err)
+	}
+	set("Products", "D3", "by hand")
+
+	for _, sheet := range []string{"Header", "Notes", "Blank"} {
+		if _, err := f.NewSheet(sheet); err != nil {
+			t.Fatal(err)
+		}
+	}
+	set("Header", "A1", "name")
+	set("Notes", "A1", 2024)
+	set("Notes", "A2", "Prices include tax")
+	set("Blank", "A1", "name")
+	set("Blank", "A3", "")
+
+	if err := f.AddChartSheet("Chart", &excelize.Chart{
+		Type:   excelize.Col,
+		Series: []excelize.ChartSeries{{Name: "Products!$A$1", Categories: "Products!$A$2:$A$3", Values: "Products!$B$2:$B$3"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "book.xlsx")
+	if err := f.SaveAs(file); err != nil {
+		t.Fatal(err)
+	}
+	sheets, err := readWorkbookFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sheets) != 1 || sheets[0].Name != "Products" {
+		t.Fatalf("sheets = %v", sheets)
+	}
+
+	sheet := sheets[0]
+	if !sheet.Calculated["total"] || sheet.Calculated["note"] {
+		t.Errorf("calculated = %v", sheet.Calculated)
+	}
+	if _, ok := sheet.Formulas["note"]; !ok {
+		t.Errorf("formulas = %v", sheet.Formulas)
+	}
+	for _, row := range sheet.editableRows() {
+		if _, ok := row.Get("total"); ok {
+			t.Errorf("editable row %v has the calculated column", row)
+		}
+		if _, ok := row.Get("note"); !ok {
+			t.Errorf("editable row %v misses the mixed column", row)
+		}
+	}
+}
+
+func cellName(t *testing.T, col, row int) string {
+	t.Helper()
+	cell, err := excelize.CoordinatesToCellName(col, row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cell
+}
@@ -0,0 +1,158 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// yamlFormat reads YAML data files, such as the _data files of Jekyll and
+// Hugo sites, holding a list of mappings or a single mapping.
+var yamlFormat = recordFormat{
+	Name:       "yaml",
+	Label:      "YAML",
+	Extensions: []string{".yml", ".yaml"},
+	Decode:     decodeYAMLRecords,
+	Encode:     encodeYAMLRecords,
+}
+
+// YAMLPreProcess reads YAML data files and creates a file per list item, or a
+// single file for a mapping, for Decap CMS.
+func YAMLPreProcess(ctx context.Context, yamlDir string, contentDir string, slugFields, ignoredFiles []string, opts Options) error {
+	return recordsPreProcess(ctx, yamlFormat, yamlDir, contentDir, slugFields, ignoredFiles, opts)
+}
+
+// YAMLPostProcess reads the content files and recreates the YAML data files.
+func YAMLPostProcess(ctx context.Context, contentDir string, yamlDir string, opts Options) error {
+	return recordsPostProcess(ctx, yamlFormat, contentDir, yamlDir, opts)
+}
+
+// YAMLGenerateConfig generates the config.yml for YAML data files: a folder
+// collection per list and a file collection per mapping.
+func YAMLGenerateConfig(yamlDir string, outputFile string, templateData, indexHTML []byte, contentDir string, ignoredFiles []string, opts Options) error {
+	return recordsGenerateConfig(yamlFormat, yamlDir, outputFile, templateData, indexHTML, contentDir, ignoredFiles, opts)
+}
+
+func decodeYAMLRecords(data []byte) ([]OrderedMap, dataLayout, error) {
+	var layout dataLayout
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, layout, err
+	}
+	value, err := decodeOrderedYAML(&doc)
+	if err != nil {
+		return nil, layout, err
+	}
+
+	var records []OrderedMap
+	switch v := value.(type) {
+	case nil:
+		// An empty file is an empty list
+	case OrderedMap:
+		records = []OrderedMap{v}
+		layout.Kind = layoutKindMap
+	case []interface{}:
+		for i, item := range v {
+			record, ok := item.(OrderedMap)
+			if !ok {
+				return nil, layout, fmt.Errorf("item %d is not a mapping", i+1)
+			}
+			records = append(records, record)
+		}
+	default:
+		return nil, layout, fmt.Errorf("expected a list of mappings or a mapping")
+	}
+
+	if bytes.Contains(data, []byte("\r\n")) {
+		layout.LineEnding = "crlf"
+	}
+	if len(data) > 0 && !bytes.HasSuffix(data, []byte("\n")) {
+		layout.FinalNewline = boolPtr(false)
+	}
+	return records, layout, nil
+}
+
+// encodeYAMLRecords writes records into the document of the original file,
+// keeping its comments, anchors and the formatting of unchanged values.
+func encodeYAMLRecords(records []OrderedMap, layout dataLayout, original []byte) ([]byte, error) {
+	var value interface{} = recordArray(records)
+	if layout.Kind == layoutKindMap && len(records) == 1 {
+		value = records[0]
+	}
+	generated, err := orderedYAMLNode(value)
+	if err != nil {
+		return nil, err
+	}
+	setLiteralStyle(generated)
+
+	doc := &yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{generated}}
+	var existing yaml.Node
+	if original != nil && yaml.Unmarshal(original, &existing) == nil && len(existing.Content) > 0 {
+		keepHeadComments(&existing, original)
+		existing.Content[0] = mergeContentNode(existing.Content[0], generated)
+		doc = &existing
+	}
+
+	data, err := encodeContent(doc)
+	if err != nil {
+		return nil, err
+	}
+	return restoreLineEndings(data, layout), nil
+}
+
+// keepHeadComments moves comments that the YAML parser attaches below where
+// they were written back onto the nodes they precede: the comment above a
+// list item with an anchor or tag, which is read as that of the item's first
+// key, and the comment at the top of the file, which is read as that of the
+// first item or key unless a blank line follows it. Comments then stay in
+// place when items are edited, added or removed.
+func keepHeadComments(doc *yaml.Node, original []byte) {
+	lines := strings.Split(string(original), "\n")
+	isComment := func(line int) bool {
+		return line >= 1 && line <= len(lines) && strings.HasPrefix(strings.TrimSpace(lines[line-1]), "#")
+	}
+
+	root := doc.Content[0]
+	if root.Kind == yaml.SequenceNode {
+		for _, item := range root.Content {
+			if item.Kind != yaml.MappingNode || len(item.Content) == 0 || item.HeadComment != "" {
+				continue
+			}
+			key := item.Content[0]
+			if key.HeadComment != "" && key.Line > item.Line && !isComment(key.Line-1) {
+				item.HeadComment, key.HeadComment = key.HeadComment, ""
+			}
+		}
+	}
+
+	if doc.HeadComment != "" || root.HeadComment != "" || len(root.Content) == 0 {
+		return
+	}
+	first := root.Content[0]
+	if first.HeadComment == "" {
+		return
+	}
+	for line := 1; line < first.Line; line++ {
+		if !isComment(line) && strings.TrimSpace(lines[line-1]) != "" {
+			return
+		}
+	}
+	root.HeadComment, first.HeadComment = first.HeadComment, ""
+}
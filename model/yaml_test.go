@@ -0,0 +1,158 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package model
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const anchoredYAML = `# People of the site
+# maintained by hand
+
+# first person
+- &base
+  name: Ann
+  role: editor
+  tags: &tags [a, b]
+# second person
+- <<: *base
+  name: Bob
+  tags: *tags
+- name: Cy
+  role: *tags
+`
+
+func TestYAMLRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		// edits replace text in content files, by file name
+		edits map[string][2]string
+		want  string
+	}{
+		{
+			name: "anchors, merge keys and comments",
+			data: anchoredYAML,
+		},
+		{
+			name: "top comment above an anchored item",
+			data: "# People\n- &base\n  name: Ann\n- <<: *base\n  age: 3\n",
+		},
+		{
+			name: "top comment of a mapping",
+			data: "# Site\ntitle: x\nn: 1\n",
+		},
+		{
+			name:  "inherited value edited",
+			data:  anchoredYAML,
+			edits: map[string][2]string{"2.yaml": {"role: editor", "role: admin"}},
+			want:  strings.Replace(anchoredYAML, "  name: Bob\n", "  role: admin\n  name: Bob\n", 1),
+		},
+		{
+			name:  "anchored values edited",
+			data:  anchoredYAML,
+			edits: map[string][2]string{"1.yaml": {"role: editor\ntags:\n  - a\n  - b", "role: admin\ntags:\n  - a\n  - c"}},
+			want: `# People of the site
+# maintained by hand
+
+# first person
+- &base
+  name: Ann
+  role: admin
+  tags: &tags [a, c]
+# second person
+- <<: *base
+  role: editor
+  name: Bob
+  tags:
+    - a
+    - b
+- name: Cy
+  role:
+    - a
+    - b
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			dataDir := filepath.Join(root, "data")
+			contentDir := filepath.Join(root, "content")
+			dataFile := filepath.Join(dataDir, "people.yaml")
+			if err := os.MkdirAll(dataDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(dataFile, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.Background()
+			if err := YAMLPreProcess(ctx, dataDir, contentDir, nil, nil, Options{}); err != nil {
+				t.Fatal(err)
+			}
+			for name, edit := range tt.edits {
+				path := filepath.Join(contentDir, "people", name)
+				content, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.Contains(string(content), edit[0]) {
+					t.Fatalf("%s does not contain %q:\n%s", name, edit[0], content)
+				}
+				content = []byte(strings.Replace(string(content), edit[0], edit[1], 1))
+				if err := os.WriteFile(path, content, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := YAMLPostProcess(ctx, contentDir, dataDir, Options{}); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := os.ReadFile(dataFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.want
+			if want == "" {
+				want = tt.data
+			}
+			if string(got) != want {
+				t.Errorf("post-process wrote:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestDecodeYAMLMergeKeys(t *testing.T) {
+	records, _, err := decodeYAMLRecords([]byte(anchoredYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	for _, pair := range records[1] {
+		keys = append(keys, pair.Key)
+	}
+	if got := strings.Join(keys, ","); got != "role,name,tags" {
+		t.Errorf("keys = %s, want role,name,tags", got)
+	}
+	if name, _ := records[1].Get("name"); name != "Bob" {
+		t.Errorf("name = %v, want Bob", name)
+	}
+}
@@ -0,0 +1,358 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package scaffold creates the directory layout of a new decapta site.
+package scaffold
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kyodo-tech/decapta/model"
+	"github.com/xuri/excelize/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Backends lists the supported Decap CMS backends.
+var Backends = []string{"github", "gitlab", "git-gateway", "test-repo"}
+
+// Options describes the site to create.
+type Options struct {
+	// Dir is the root directory of the site.
+	Dir string
+
+	Backend string
+	Repo    string
+	Branch  string
+	BaseURL string
+
+	// LocalBackend lets the CMS use `decapta serve` when opened on localhost.
+	LocalBackend bool
+
+	MediaFolder  string
+	PublicFolder string
+
+	// Projects are added to the manifest with data and content directories
+	// named after them. Only Name and Type are used.
+	Projects []model.Project
+
+	// Examples writes a sample data file into each project.
+	Examples bool
+
+	// Force overwrites existing files.
+	Force bool
+
+	// IndexHTML is the index.html template.
+	IndexHTML []byte
+}
+
+type siteConfig struct {
+	Backend          backendConfig `yaml:"backend"`
+	LocalBackend     bool          `yaml:"local_backend,omitempty"`
+	MediaFolder      string        `yaml:"media_folder"`
+	PublicFolder     string        `yaml:"public_folder,omitempty"`
+	ShowPreviewLinks bool          `yaml:"show_preview_links"`
+}
+
+type backendConfig struct {
+	Name    string `yaml:"name"`
+	Repo    string `yaml:"repo,omitempty"`
+	Branch  string `yaml:"branch,omitempty"`
+	BaseURL string `yaml:"base_url,omitempty"`
+}
+
+const configFooter = "\n# Collections managed by the https://github.com/kyodo-tech/decapta generator.\n"
+
+const exampleCSV = `id,title,published
+1,Hello World,2024-01-15
+2,Second Post,2024-02-01
+`
+
+const exampleARB = `{
+  "@@locale": "en",
+  "title": "Hello World",
+  "@title": {
+    "description": "Title of the home page"
+  },
+  "greeting": "Hello {name}",
+  "@greeting": {
+    "placeholders": {
+      "name": {
+        "type": "String",
+        "example": "Alice"
+      }
+    }
+  }
+}
+`
+
+const exampleJSON = `[
+  {
+    "id": 1,
+    "title": "Hello World",
+    "tags": [
+      "news"
+    ]
+  },
+  {
+    "id": 2,
+    "title": "Second Post",
+    "tags": []
+  }
+]
+`
+
+const exampleJSONL = `{"id":1,"event":"signup","plan":"free"}
+{"id":2,"event":"upgrade","plan":"pro","seats":5}
+`
+
+const exampleTOML = `title = "Example Site"
+
+[[authors]]
+name = "Ada"
+joined = 2024-01-15
+
+[[authors]]
+name = "Grace"
+joined = 2024-03-01
+`
+
+const exampleYAML = `# Navigation links
+- label: Home
+  url: /
+- label: About
+  url: /about
+`
+
+// exampleXLSX returns a workbook with a sheet of typed cells and a formula
+// column.
+func exampleXLSX() ([]byte, error) {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	sheet := "Products"
+	if err := f.SetSheetName("Sheet1", sheet); err != nil {
+		return nil, err
+	}
+	rows := [][]interface{}{
+		{"name", "price", "quantity", "total", "in_stock", "released"},
+		{"Notebook", 4.5, 10, nil, true, time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{"Pencil", 0.8, 120, nil, false, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	dateStyle, err := f.NewStyle(&excelize.Style{NumFmt: 14})
+	if err != nil {
+		return nil, err
+	}
+	for i, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		if err := f.SetSheetRow(sheet, cell, &row); err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			continue
+		}
+		if err := f.SetCellFormula(sheet, fmt.Sprintf("D%d", i+1), fmt.Sprintf("B%d*C%d", i+1, i+1)); err != nil {
+			return nil, err
+		}
+		if err := f.SetCellStyle(sheet, fmt.Sprintf("F%d", i+1), fmt.Sprintf("F%d", i+1), dateStyle); err != nil {
+			return nil, err
+		}
+	}
+	if err := f.SetColWidth(sheet, "A", "A", 20); err != nil {
+		return nil, err
+	}
+	// The totals are calculated when the workbook is opened
+	fullCalcOnLoad := true
+	if err := f.SetCalcProps(&excelize.CalcPropsOptions{FullCalcOnLoad: &fullCalcOnLoad}); err != nil {
+		return nil, err
+	}
+
+	buf, err := f.WriteToBuffer()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Init writes the admin directory, the manifest, the media folder and the
+// project data directories. It fails without writing anything if a file
+// exists and opts.Force is not set. The written paths are returned relative
+// to opts.Dir.
+func Init(opts Options) ([]string, error) {
+	files, err := render(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	if !opts.Force {
+		var existing []string
+		for _, p := range paths {
+			if _, err := os.Stat(filepath.Join(opts.Dir, p)); err == nil {
+				existing = append(existing, p)
+			} else if !errors.Is(err, fs.ErrNotExist) {
+				return nil, err
+			}
+		}
+		if len(existing) > 0 {
+			return nil, fmt.Errorf("refusing to overwrite existing files (use --force): %s", strings.Join(existing, ", "))
+		}
+	}
+
+	for _, p := range paths {
+		target := filepath.Join(opts.Dir, filepath.FromSlash(p))
+		if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+			return nil, fmt.Errorf("error creating directory for %s: %v", p, err)
+		}
+		if err := os.WriteFile(target, files[p], 0644); err != nil {
+			return nil, fmt.Errorf("error writing %s: %v", p, err)
+		}
+	}
+	return paths, nil
+}
+
+// render returns the content of every file to create by slash-separated path.
+func render(opts Options) (map[string][]byte, error) {
+	if !contains(Backends, opts.Backend) {
+		return nil, fmt.Errorf("unsupported backend %s, expected one of %s", opts.Backend, strings.Join(Backends, ", "))
+	}
+	if opts.MediaFolder == "" {
+		return nil, errors.New("media folder must not be empty")
+	}
+
+	backend := backendConfig{Name: opts.Backend}
+	switch opts.Backend {
+	case "github", "gitlab":
+		// Decap CMS cannot load a config without the repository
+		if !strings.Contains(opts.Repo, "/") {
+			return nil, fmt.Errorf("backend %s requires a repo in the form owner/name", opts.Backend)
+		}
+		backend.Repo = opts.Repo
+		backend.Branch = opts.Branch
+		backend.BaseURL = opts.BaseURL
+	case "git-gateway":
+		backend.Branch = opts.Branch
+	}
+
+	config, err := marshal(siteConfig{
+		Backend:          backend,
+		LocalBackend:     opts.LocalBackend,
+		MediaFolder:      opts.MediaFolder,
+		PublicFolder:     opts.PublicFolder,
+		ShowPreviewLinks: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	index, err := model.RenderIndex(opts.IndexHTML, model.Index{})
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string][]byte{
+		"admin/config.yml":                      append(config, configFooter...),
+		"admin/index.html":                      index,
+		path.Join(opts.MediaFolder, ".gitkeep"): nil,
+	}
+
+	manifest := model.Manifest{Config: "admin/config.yml"}
+	seen := make(map[string]bool)
+	for _, p := range opts.Projects {
+		if p.Name == "" || strings.ContainsAny(p.Name, `/\`) || strings.HasPrefix(p.Name, ".") {
+			return nil, fmt.Errorf("invalid project name %q", p.Name)
+		}
+		if seen[p.Name] {
+			return nil, fmt.Errorf("duplicate project %s", p.Name)
+		}
+		seen[p.Name] = true
+
+		dataDir := path.Join("data", p.Name)
+		manifest.Projects = append(manifest.Projects, model.Project{
+			Name:    p.Name,
+			Type:    p.Type,
+			Data:    dataDir,
+			Content: path.Join("content", p.Name),
+		})
+
+		switch {
+		case opts.Examples && p.Type == "csv":
+			files[path.Join(dataDir, "example.csv")] = []byte(exampleCSV)
+		case opts.Examples && p.Type == "arb":
+			files[path.Join(dataDir, "app_en.arb")] = []byte(exampleARB)
+		case opts.Examples && p.Type == "json":
+			files[path.Join(dataDir, "example.json")] = []byte(exampleJSON)
+		case opts.Examples && p.Type == "jsonl":
+			files[path.Join(dataDir, "example.jsonl")] = []byte(exampleJSONL)
+		case opts.Examples && p.Type == "toml":
+			files[path.Join(dataDir, "example.toml")] = []byte(exampleTOML)
+		case opts.Examples && p.Type == "xlsx":
+			workbook, err := exampleXLSX()
+			if err != nil {
+				return nil, err
+			}
+			files[path.Join(dataDir, "example.xlsx")] = workbook
+		case opts.Examples && p.Type == "yaml":
+			files[path.Join(dataDir, "example.yml")] = []byte(exampleYAML)
+		case p.Type == "csv" || p.Type == "arb" || p.Type == "json" || p.Type == "jsonl" || p.Type == "toml" || p.Type == "xlsx" || p.Type == "yaml":
+			files[path.Join(dataDir, ".gitkeep")] = nil
+		default:
+			return nil, fmt.Errorf("%w: %s", model.ErrUnsupportedType, p.Type)
+		}
+	}
+
+	data, err := marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	files[model.DefaultManifestFile] = data
+
+	return files, nil
+}
+
+// marshal encodes YAML with the two-space indent of the generated config.
+func marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func contains(list []string, item string) bool {
+	for _, v := range list {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scaffold
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/kyodo-tech/decapta/model"
+)
+
+func TestInitPassesValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend string
+		repo    string
+		ok      bool
+	}{
+		{"default", "test-repo", "", true},
+		{"github", "github", "myorg/myrepo", true},
+		{"gitlab", "gitlab", "myorg/myrepo", true},
+		{"git-gateway", "git-gateway", "", true},
+		{"github without repo", "github", "", false},
+		{"gitlab without owner", "gitlab", "myrepo", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			_, err := Init(Options{
+				Dir:          dir,
+				Backend:      tt.backend,
+				Repo:         tt.repo,
+				Branch:       "master",
+				LocalBackend: true,
+				MediaFolder:  "_images",
+				Projects:     []model.Project{{Name: "example", Type: "csv"}, {Name: "app", Type: "arb"}},
+				Examples:     true,
+				IndexHTML:    []byte("<html></html>"),
+			})
+			if !tt.ok {
+				if err == nil {
+					t.Fatal("Init succeeded")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// decapta init syncs the examples in the new site
+			t.Chdir(dir)
+			manifest, err := model.LoadManifest(model.DefaultManifestFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := manifest.Sync(context.Background(), manifest.Projects, nil, []byte("<html></html>"), model.Options{}); err != nil {
+				t.Fatal(err)
+			}
+
+			errs, err := model.ValidateConfig(filepath.Join("admin", "config.yml"), ".")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range errs {
+				t.Errorf("config validate: %s", e)
+			}
+		})
+	}
+}
@@ -0,0 +1,717 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package server serves the Decap CMS admin directory and implements the
+// local_backend proxy API of decap-server against the local filesystem.
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// APIPath is where Decap CMS expects the local backend API.
+const APIPath = "/api/v1"
+
+// maxRequestSize matches the body limit of decap-server.
+const maxRequestSize = 50 << 20
+
+// Server serves the admin directory under /admin/ and the local backend API
+// under /api/v1. Entry and media paths are relative to Root.
+type Server struct {
+	Root     string
+	AdminDir string
+
+	// APIURL is injected as local_backend url into the served config.yml if
+	// the config does not enable local_backend itself.
+	APIURL string
+
+	// AllowedOrigins may call the API besides the server's own origin, such
+	// as a site's development server that serves the admin page.
+	AllowedOrigins []string
+
+	// OnChange is called with the repository-relative paths of entries and
+	// media after they were written or deleted.
+	OnChange func(paths []string)
+
+	Logger *log.Logger
+
+	// scope caches the folders of config.yml that entries and media may be
+	// read from and written to.
+	mu         sync.Mutex
+	scope      []string
+	scopeMTime time.Time
+}
+
+// Handler returns the HTTP handler of the server.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(APIPath, s.handleAPI)
+	mux.HandleFunc("/admin/config.yml", s.handleConfig)
+	mux.Handle("/admin/", http.StripPrefix("/admin/", http.FileServer(http.Dir(s.AdminDir))))
+	mux.Handle("/", http.RedirectHandler("/admin/", http.StatusFound))
+	return mux
+}
+
+type request struct {
+	Action string          `json:"action"`
+	Params json.RawMessage `json:"params"`
+}
+
+type entryFile struct {
+	Path  string  `json:"path"`
+	Label string  `json:"label,omitempty"`
+	ID    *string `json:"id"`
+}
+
+type entry struct {
+	Data *string   `json:"data"`
+	File entryFile `json:"file"`
+}
+
+type mediaFile struct {
+	ID       string `json:"id"`
+	Content  string `json:"content"`
+	Encoding string `json:"encoding"`
+	Path     string `json:"path"`
+	Name     string `json:"name"`
+}
+
+type dataFile struct {
+	Path    string `json:"path"`
+	Raw     string `json:"raw"`
+	NewPath string `json:"newPath,omitempty"`
+}
+
+type asset struct {
+	Path     string `json:"path"`
+	Content  string `json:"content"`
+	Encoding string `json:"encoding"`
+}
+
+func (s *Server) handleAPI(w http.ResponseWriter, r *http.Request) {
+	// Other web pages open in the browser must not reach the API
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if !s.allowOrigin(origin, r.Host) {
+			writeError(w, http.StatusForbidden, "origin not allowed: "+origin)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+		w.Header().Add("Vary", "Origin")
+	} else if r.Header.Get("Sec-Fetch-Site") == "cross-site" {
+		writeError(w, http.StatusForbidden, "cross-site request")
+		return
+	}
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	// JSON requests from other origins need a preflight, form posts do not
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, "expected application/json")
+		return
+	}
+
+	var req request
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&req); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, fmt.Sprintf("invalid request: %v", err))
+		return
+	}
+
+	result, err := s.dispatch(req)
+	if err != nil {
+		var invalid requestError
+		if errors.As(err, &invalid) {
+			writeError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		s.logf("%s failed: %v", req.Action, err)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// allowOrigin reports whether a browser page of origin may call the API: the
+// server's own origin on a loopback host, the origin of APIURL, or one of
+// AllowedOrigins. Own origins on other hosts are not trusted, as any site can
+// resolve its name to this server.
+func (s *Server) allowOrigin(origin string, host string) bool {
+	for _, allowed := range s.AllowedOrigins {
+		if strings.TrimSuffix(allowed, "/") == origin {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if api, err := url.Parse(s.APIURL); err == nil && api.Host != "" && api.Scheme+"://"+api.Host == origin {
+		return true
+	}
+	return u.Host == host && isLoopback(u.Hostname())
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// requestError is an invalid request, answered with 422 like decap-server.
+type requestError string
+
+func (e requestError) Error() string {
+	return string(e)
+}
+
+func (s *Server) dispatch(req request) (interface{}, error) {
+	switch req.Action {
+	case "info":
+		return map[string]interface{}{
+			"repo":          filepath.Base(s.Root),
+			"publish_modes": []string{"simple"},
+			"type":          "local_fs",
+		}, nil
+
+	case "entriesByFolder":
+		var params struct {
+			Folder    string `json:"folder"`
+			Extension string `json:"extension"`
+			Depth     int    `json:"depth"`
+		}
+		if err := decodeParams(req, &params); err != nil {
+			return nil, err
+		}
+		files, err := s.listFiles(params.Folder, params.Extension, params.Depth)
+		if err != nil {
+			return nil, err
+		}
+		entries := make([]entry, 0, len(files))
+		for _, file := range files {
+			e, err := s.readEntry(file, "")
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, e)
+		}
+		return entries, nil
+
+	case "entriesByFiles":
+		var params struct {
+			Files []struct {
+				Path  string `json:"path"`
+				Label string `json:"label"`
+			} `json:"files"`
+		}
+		if err := decodeParams(req, &params); err != nil {
+			return nil, err
+		}
+		entries := make([]entry, 0, len(params.Files))
+		for _, file := range params.Files {
+			e, err := s.readEntry(file.Path, file.Label)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, e)
+		}
+		return entries, nil
+
+	case "getEntry":
+		var params struct {
+			Path string `json:"path"`
+		}
+		if err := decodeParams(req, &params); err != nil {
+			return nil, err
+		}
+		return s.readEntry(params.Path, "")
+
+	case "persistEntry":
+		var params struct {
+			Entry     *dataFile  `json:"entry"`
+			DataFiles []dataFile `json:"dataFiles"`
+			Assets    []asset    `json:"assets"`
+		}
+		if err := decodeParams(req, &params); err != nil {
+			return nil, err
+		}
+		dataFiles := params.DataFiles
+		if len(dataFiles) == 0 && params.Entry != nil {
+			dataFiles = []dataFile{*params.Entry}
+		}
+		changed, err := s.persistEntry(dataFiles, params.Assets)
+		if err != nil {
+			return nil, err
+		}
+		s.changed(changed)
+		return map[string]string{"message": "entry persisted"}, nil
+
+	case "getMedia":
+		var params struct {
+			MediaFolder string `json:"mediaFolder"`
+		}
+		if err := decodeParams(req, &params); err != nil {
+			return nil, err
+		}
+		files, err := s.listFiles(params.MediaFolder, "", 1)
+		if err != nil {
+			return nil, err
+		}
+		media := make([]mediaFile, 0, len(files))
+		for _, file := range files {
+			m, err := s.readMedia(file)
+			if err != nil {
+				return nil, err
+			}
+			media = append(media, m)
+		}
+		return media, nil
+
+	case "getMediaFile":
+		var params struct {
+			Path string `json:"path"`
+		}
+		if err := decodeParams(req, &params); err != nil {
+			return nil, err
+		}
+		return s.readMedia(params.Path)
+
+	case "persistMedia":
+		var params struct {
+			Asset asset `json:"asset"`
+		}
+		if err := decodeParams(req, &params); err != nil {
+			return nil, err
+		}
+		if err := s.writeAsset(params.Asset); err != nil {
+			return nil, err
+		}
+		s.changed([]string{params.Asset.Path})
+		return s.readMedia(params.Asset.Path)
+
+	case "deleteFile":
+		var params struct {
+			Path string `json:"path"`
+		}
+		if err := decodeParams(req, &params); err != nil {
+			return nil, err
+		}
+		if err := s.deleteFile(params.Path); err != nil {
+			return nil, err
+		}
+		s.changed([]string{params.Path})
+		return map[string]string{"message": "deleted file " + params.Path}, nil
+
+	case "deleteFiles":
+		var params struct {
+			Paths []string `json:"paths"`
+		}
+		if err := decodeParams(req, &params); err != nil {
+			return nil, err
+		}
+		for _, p := range params.Paths {
+			if err := s.deleteFile(p); err != nil {
+				return nil, err
+			}
+		}
+		s.changed(params.Paths)
+		return map[string]string{"message": "deleted files " + strings.Join(params.Paths, ", ")}, nil
+
+	case "getDeployPreview":
+		return nil, nil
+
+	default:
+		return nil, requestError("Unknown action " + req.Action)
+	}
+}
+
+func decodeParams(req request, params interface{}) error {
+	if len(req.Params) == 0 {
+		return requestError("missing params for " + req.Action)
+	}
+	if err := json.Unmarshal(req.Params, params); err != nil {
+		return requestError(fmt.Sprintf("invalid params for %s: %v", req.Action, err))
+	}
+	return nil
+}
+
+// resolve maps a repository-relative path to the filesystem. Paths may not
+// leave the repository or name hidden files such as .git, and must lie within
+// a collection folder, a collection file or a media folder of config.yml.
+func (s *Server) resolve(p string) (string, error) {
+	slashed := filepath.ToSlash(p)
+	cleaned := path.Clean("/" + slashed)
+	if p == "" || cleaned == "/" {
+		return "", requestError(fmt.Sprintf("invalid path %q", p))
+	}
+	for _, segment := range strings.Split(slashed, "/") {
+		if segment == ".." {
+			return "", requestError(fmt.Sprintf("invalid path %q", p))
+		}
+	}
+	for _, segment := range strings.Split(cleaned[1:], "/") {
+		if strings.HasPrefix(segment, ".") {
+			return "", requestError(fmt.Sprintf("invalid path %q: hidden files are not served", p))
+		}
+	}
+
+	scope, err := s.configScope()
+	if err != nil {
+		return "", err
+	}
+	rel := cleaned[1:]
+	inScope := false
+	for _, prefix := range scope {
+		inScope = inScope || rel == prefix || strings.HasPrefix(rel, prefix+"/")
+	}
+	if !inScope {
+		return "", requestError(fmt.Sprintf("invalid path %q: not within a collection or media folder", p))
+	}
+	return filepath.Join(s.Root, filepath.FromSlash(rel)), nil
+}
+
+// configScope returns the repository-relative collection folders, collection
+// files and media folders of config.yml, read again when it changes.
+func (s *Server) configScope() ([]string, error) {
+	configPath := filepath.Join(s.AdminDir, "config.yml")
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config.yml: %v", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.scope != nil && info.ModTime().Equal(s.scopeMTime) {
+		return s.scope, nil
+	}
+
+	content, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config.yml: %v", err)
+	}
+	var config struct {
+		MediaFolder string `yaml:"media_folder"`
+		Collections []struct {
+			Folder      string `yaml:"folder"`
+			MediaFolder string `yaml:"media_folder"`
+			Files       []struct {
+				File string `yaml:"file"`
+			} `yaml:"files"`
+		} `yaml:"collections"`
+	}
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return nil, fmt.Errorf("error parsing config.yml: %v", err)
+	}
+
+	scope := []string{}
+	add := func(p string) {
+		if p = strings.TrimPrefix(path.Clean("/"+p), "/"); p != "" {
+			scope = append(scope, p)
+		}
+	}
+	add(config.MediaFolder)
+	for _, collection := range config.Collections {
+		if collection.Folder != "" {
+			add(collection.Folder)
+		}
+		for _, file := range collection.Files {
+			add(file.File)
+		}
+		// Collection media folders are relative to the entries, unless
+		// they start with a slash
+		switch {
+		case collection.MediaFolder == "":
+		case strings.HasPrefix(collection.MediaFolder, "/"):
+			add(collection.MediaFolder)
+		case collection.Folder != "":
+			add(path.Join(collection.Folder, collection.MediaFolder))
+		}
+	}
+
+	s.scope = scope
+	s.scopeMTime = info.ModTime()
+	return scope, nil
+}
+
+// listFiles lists the files below folder up to depth levels deep whose name
+// ends with extension, as repository-relative paths.
+func (s *Server) listFiles(folder string, extension string, depth int) ([]string, error) {
+	dir, err := s.resolve(folder)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	var walk func(dir string, rel string, depth int) error
+	walk = func(dir string, rel string, depth int) error {
+		if depth <= 0 {
+			return nil
+		}
+		entries, err := os.ReadDir(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if strings.HasPrefix(e.Name(), ".") {
+				continue // Layout files and checksums are not entries
+			}
+			childRel := path.Join(rel, e.Name())
+			if e.IsDir() {
+				if err := walk(filepath.Join(dir, e.Name()), childRel, depth-1); err != nil {
+					return err
+				}
+				continue
+			}
+			if strings.HasSuffix(e.Name(), extension) {
+				files = append(files, childRel)
+			}
+		}
+		return nil
+	}
+
+	if err := walk(dir, path.Clean(filepath.ToSlash(folder)), depth); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// readEntry reads an entry file. Unreadable files are returned without data
+// and id, as the CMS expects.
+func (s *Server) readEntry(p string, label string) (entry, error) {
+	e := entry{File: entryFile{Path: p, Label: label}}
+
+	fsPath, err := s.resolve(p)
+	if err != nil {
+		return e, err
+	}
+	content, err := os.ReadFile(fsPath)
+	if err != nil {
+		return e, nil
+	}
+
+	data := string(content)
+	id := sha(content)
+	e.Data = &data
+	e.File.ID = &id
+	return e, nil
+}
+
+func (s *Server) readMedia(p string) (mediaFile, error) {
+	fsPath, err := s.resolve(p)
+	if err != nil {
+		return mediaFile{}, err
+	}
+	content, err := os.ReadFile(fsPath)
+	if err != nil {
+		return mediaFile{}, err
+	}
+	return mediaFile{
+		ID:       sha(content),
+		Content:  base64.StdEncoding.EncodeToString(content),
+		Encoding: "base64",
+		Path:     p,
+		Name:     path.Base(p),
+	}, nil
+}
+
+func (s *Server) persistEntry(dataFiles []dataFile, assets []asset) ([]string, error) {
+	var changed []string
+	for _, file := range dataFiles {
+		if err := s.writeFile(file.Path, []byte(file.Raw)); err != nil {
+			return nil, err
+		}
+		changed = append(changed, file.Path)
+	}
+	for _, a := range assets {
+		if err := s.writeAsset(a); err != nil {
+			return nil, err
+		}
+		changed = append(changed, a.Path)
+	}
+
+	// Entries are moved when their slug changes
+	moved := len(dataFiles) > 0
+	for _, file := range dataFiles {
+		moved = moved && file.NewPath != ""
+	}
+	if moved {
+		for _, file := range dataFiles {
+			from, err := s.resolve(file.Path)
+			if err != nil {
+				return nil, err
+			}
+			to, err := s.resolve(file.NewPath)
+			if err != nil {
+				return nil, err
+			}
+			if err := os.MkdirAll(filepath.Dir(to), os.ModePerm); err != nil {
+				return nil, err
+			}
+			if err := os.Rename(from, to); err != nil {
+				return nil, err
+			}
+			changed = append(changed, file.NewPath)
+		}
+	}
+
+	return changed, nil
+}
+
+func (s *Server) writeAsset(a asset) error {
+	var content []byte
+	switch a.Encoding {
+	case "base64":
+		decoded, err := base64.StdEncoding.DecodeString(a.Content)
+		if err != nil {
+			return fmt.Errorf("invalid base64 content for %s: %v", a.Path, err)
+		}
+		content = decoded
+	default:
+		content = []byte(a.Content)
+	}
+	return s.writeFile(a.Path, content)
+}
+
+func (s *Server) writeFile(p string, content []byte) error {
+	fsPath, err := s.resolve(p)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(fsPath), os.ModePerm); err != nil {
+		return err
+	}
+	s.logf("write %s", p)
+	return os.WriteFile(fsPath, content, 0644)
+}
+
+func (s *Server) deleteFile(p string) error {
+	fsPath, err := s.resolve(p)
+	if err != nil {
+		return err
+	}
+	// Only files are deleted, never directories or what links point to
+	info, err := os.Lstat(fsPath)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return requestError(fmt.Sprintf("cannot delete %q: not a regular file", p))
+	}
+	s.logf("delete %s", p)
+	return os.Remove(fsPath)
+}
+
+func (s *Server) changed(paths []string) {
+	if s.OnChange != nil && len(paths) > 0 {
+		s.OnChange(paths)
+	}
+}
+
+// handleConfig serves config.yml, enabling local_backend if the config does
+// not configure it already.
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	content, err := os.ReadFile(filepath.Join(s.AdminDir, "config.yml"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if s.APIURL != "" {
+		content, err = injectLocalBackend(content, s.APIURL)
+		if err != nil {
+			s.logf("serving config.yml unchanged: %v", err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/yaml; charset=utf-8")
+	w.Write(content)
+}
+
+func injectLocalBackend(content []byte, url string) ([]byte, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return content, err
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return content, errors.New("config.yml is not a mapping")
+	}
+
+	mapping := root.Content[0]
+	for i := 0; i < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == "local_backend" {
+			return content, nil
+		}
+	}
+
+	mapping.Content = append(mapping.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Value: "local_backend"},
+		&yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Value: "url"},
+			{Kind: yaml.ScalarNode, Value: url},
+		}},
+	)
+	out, err := yaml.Marshal(&root)
+	if err != nil {
+		return content, err
+	}
+	return out, nil
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.Logger != nil {
+		s.Logger.Printf(format, args...)
+	}
+}
+
+func sha(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
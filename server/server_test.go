@@ -0,0 +1,160 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testConfig = `media_folder: _images
+collections:
+  - name: posts
+    folder: content/posts
+  - name: settings
+    files:
+      - name: site
+        file: content/site.yaml
+`
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range map[string]string{
+		"admin/config.yml":        testConfig,
+		"content/posts/1.yaml":    "title: one\n",
+		"content/posts/a..b.md":   "title: dots\n",
+		"content/site.yaml":       "name: site\n",
+		"content/other/1.yaml":    "title: other\n",
+		".git/HEAD":               "ref: refs/heads/main\n",
+		"content/posts/.1.yaml":   "columns: []\n",
+		"content/posts/sub/.keep": "",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &Server{
+		Root:     root,
+		AdminDir: filepath.Join(root, "admin"),
+		APIURL:   "http://localhost:8081" + APIPath,
+	}
+}
+
+func post(s *Server, origin string, contentType string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "http://localhost:8081"+APIPath, strings.NewReader(body))
+	req.Host = "localhost:8081"
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	req.Header.Set("Content-Type", contentType)
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandleAPIOrigins(t *testing.T) {
+	tests := []struct {
+		name        string
+		origin      string
+		contentType string
+		allowed     []string
+		status      int
+	}{
+		{"own origin", "http://localhost:8081", "application/json", nil, http.StatusOK},
+		{"no origin", "", "application/json", nil, http.StatusOK},
+		{"foreign origin", "https://evil.example", "application/json", nil, http.StatusForbidden},
+		{"rebound host", "http://evil.example:8081", "application/json", nil, http.StatusForbidden},
+		{"allowed origin", "http://localhost:1313", "application/json", []string{"http://localhost:1313"}, http.StatusOK},
+		{"form post", "", "text/plain", nil, http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t)
+			s.AllowedOrigins = tt.allowed
+			rec := post(s, tt.origin, tt.contentType, `{"action":"deleteFile","params":{"path":"content/posts/1.yaml"}}`)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			_, err := os.Stat(filepath.Join(s.Root, "content/posts/1.yaml"))
+			if deleted := os.IsNotExist(err); deleted != (tt.status == http.StatusOK) {
+				t.Errorf("deleted = %v with status %d", deleted, rec.Code)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got == "*" {
+				t.Errorf("Access-Control-Allow-Origin = %q", got)
+			}
+		})
+	}
+}
+
+func TestResolve(t *testing.T) {
+	s := newTestServer(t)
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{"content/posts/1.yaml", true},
+		{"content/posts/a..b.md", true},
+		{"content/posts", true},
+		{"content/site.yaml", true},
+		{"_images/logo.png", true},
+		{"content/other/1.yaml", false},
+		{"content/site.yaml.bak", false},
+		{".git/hooks/pre-commit", false},
+		{"content/posts/.1.yaml", false},
+		{"content/posts/../../.git", false},
+		{"content/posts/../other/1.yaml", false},
+		{"/etc/passwd", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		_, err := s.resolve(tt.path)
+		if (err == nil) != tt.ok {
+			t.Errorf("resolve(%q) error = %v, want ok = %v", tt.path, err, tt.ok)
+		}
+	}
+}
+
+func TestDeleteFileOnlyRemovesFiles(t *testing.T) {
+	s := newTestServer(t)
+	if err := s.deleteFile("content/posts/sub"); err == nil {
+		t.Error("deleting a directory succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(s.Root, "content/posts/sub/.keep")); err != nil {
+		t.Errorf("directory contents removed: %v", err)
+	}
+	if err := s.deleteFile("content/posts/a..b.md"); err != nil {
+		t.Errorf("deleting a file failed: %v", err)
+	}
+}
+
+func TestListFilesSkipsHiddenFiles(t *testing.T) {
+	s := newTestServer(t)
+	files, err := s.listFiles("content/posts", ".yaml", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0] != "content/posts/1.yaml" {
+		t.Errorf("listFiles = %v", files)
+	}
+}
@@ -0,0 +1,389 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package watch re-runs the processing steps of projects as their data or
+// content files change.
+package watch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/kyodo-tech/decapta/model"
+)
+
+// DefaultDebounce is how long the watcher waits for events to settle.
+const DefaultDebounce = 300 * time.Millisecond
+
+// Watcher pre-processes changed data files and post-processes changed
+// content entries of its projects. Files written by its own steps are
+// recognised by their checksum and do not trigger the opposite step.
+type Watcher struct {
+	Projects []model.Project
+
+	// Config is regenerated after pre-processing if it is set.
+	Config       string
+	TemplateData []byte
+	IndexHTML    []byte
+
+	Debounce time.Duration
+	Options  model.Options
+	Logger   *log.Logger
+
+	// own maps files written by the watcher's steps to their checksum, or
+	// to "" if a step removed them.
+	own map[string]string
+}
+
+type batch struct {
+	data    map[string]bool
+	content map[string]bool
+}
+
+// Run watches the data and content directories until ctx is cancelled.
+func (w *Watcher) Run(ctx context.Context) error {
+	if w.Debounce <= 0 {
+		w.Debounce = DefaultDebounce
+	}
+	if w.Logger == nil {
+		w.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+	w.own = make(map[string]string)
+
+	projects := make([]model.Project, len(w.Projects))
+	for i, project := range w.Projects {
+		data, err := filepath.Abs(project.Data)
+		if err != nil {
+			return err
+		}
+		content, err := filepath.Abs(project.Content)
+		if err != nil {
+			return err
+		}
+		project.Data, project.Content = data, content
+		projects[i] = project
+	}
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("error creating watcher: %v", err)
+	}
+	defer fsw.Close()
+
+	for _, project := range projects {
+		// The content directory may not exist before the first pre-process
+		if err := os.MkdirAll(project.Content, os.ModePerm); err != nil {
+			return err
+		}
+		for _, dir := range []string{project.Data, project.Content} {
+			if err := addRecursive(fsw, dir); err != nil {
+				return err
+			}
+		}
+		w.Logger.Printf("watching %s: %s and %s", project.Name, project.Data, project.Content)
+	}
+
+	pending := make(map[string]bool)
+	timer := time.NewTimer(w.Debounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-fsw.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op == fsnotify.Chmod || ignored(event.Name) {
+				continue
+			}
+			// New directories are watched, and their files processed
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := addRecursive(fsw, event.Name); err != nil {
+						w.Logger.Printf("error watching %s: %v", event.Name, err)
+					}
+					filepath.WalkDir(event.Name, func(path string, d fs.DirEntry, err error) error {
+						if err == nil && !d.IsDir() && !ignored(path) {
+							pending[path] = true
+						}
+						return nil
+					})
+					timer.Reset(w.Debounce)
+					continue
+				}
+			}
+			pending[event.Name] = true
+			timer.Reset(w.Debounce)
+
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return nil
+			}
+			w.Logger.Printf("watch error: %v", err)
+
+		case <-timer.C:
+			w.process(ctx, projects, pending)
+			pending = make(map[string]bool)
+		}
+	}
+}
+
+// process runs the step of each project affected by the changed paths.
+func (w *Watcher) process(ctx context.Context, projects []model.Project, paths map[string]bool) {
+	batches := make([]batch, len(projects))
+	for i := range batches {
+		batches[i] = batch{data: make(map[string]bool), content: make(map[string]bool)}
+	}
+
+	for path := range paths {
+		if w.isOwn(path) {
+			continue
+		}
+		i, rel, isContent := locate(projects, path)
+		if i < 0 {
+			continue
+		}
+		if isContent {
+			batches[i].content[(model.ContentChange{Path: rel}).Entry()] = true
+			continue
+		}
+		name := strings.SplitN(rel, "/", 2)[0]
+		if !contains(projects[i].Ignore, name) {
+			batches[i].data[name] = true
+		}
+	}
+
+	for i, project := range projects {
+		b := batches[i]
+		switch {
+		case len(b.data) > 0 && len(b.content) > 0:
+			w.Logger.Printf("%s: both data (%s) and content (%s) changed, skipping; run sync or build to resolve",
+				project.Name, list(b.data), list(b.content))
+		case len(b.data) > 0:
+			w.preProcess(ctx, project, b.data)
+		case len(b.content) > 0:
+			w.postProcess(ctx, project, b.content)
+		}
+	}
+}
+
+func (w *Watcher) preProcess(ctx context.Context, project model.Project, files map[string]bool) {
+	opts := w.Options
+	opts.Only = files
+	opts.Reserved = project.Reserved
+
+	err := w.track(project.Content, func() error {
+		return model.PreProcess(ctx, project.Type, project.Data, project.Content, project.Slug, project.Ignore, opts)
+	})
+	if err != nil {
+		w.Logger.Printf("%s: pre-process %s failed: %v", project.Name, list(files), err)
+		return
+	}
+	w.Logger.Printf("%s: pre-processed %s", project.Name, list(files))
+
+	if w.Config == "" {
+		return
+	}
+	opts = w.Options
+	opts.Schema = project.Schema
+	opts.Reserved = project.Reserved
+	opts.PreviewSnapshot = project.PreviewSnapshot
+	if opts.OnConflict == nil {
+		opts.OnConflict = func(conflict string) {
+			w.Logger.Printf("%s: config conflict: %s", project.Name, conflict)
+		}
+	}
+	err = model.GenerateConfig(project.Type, project.Data, w.Config, w.TemplateData, w.IndexHTML, project.Content, project.Ignore, opts)
+	if err != nil {
+		w.Logger.Printf("%s: config failed: %v", project.Name, err)
+		return
+	}
+	w.Logger.Printf("%s: updated %s", project.Name, w.Config)
+}
+
+func (w *Watcher) postProcess(ctx context.Context, project model.Project, entries map[string]bool) {
+	opts := w.Options
+	opts.Only = entries
+
+	err := w.track(project.Data, func() error {
+		return project.PostProcess(ctx, opts)
+	})
+	if err != nil {
+		w.Logger.Printf("%s: post-process %s failed: %v", project.Name, list(entries), err)
+		return
+	}
+	w.Logger.Printf("%s: post-processed %s", project.Name, list(entries))
+}
+
+// track runs step and records the checksum of every file below dir that it
+// created, modified or removed.
+func (w *Watcher) track(dir string, step func() error) error {
+	before, err := statTree(dir)
+	if err != nil {
+		return err
+	}
+	stepErr := step()
+	after, err := statTree(dir)
+	if err != nil {
+		return err
+	}
+
+	for path, info := range after {
+		if prev, ok := before[path]; ok && prev.Size() == info.Size() && prev.ModTime().Equal(info.ModTime()) {
+			continue
+		}
+		if sum, err := hashFile(path); err == nil {
+			w.own[path] = sum
+		}
+	}
+	for path := range before {
+		if _, ok := after[path]; !ok {
+			w.own[path] = ""
+		}
+	}
+	return stepErr
+}
+
+// isOwn reports whether path still has the content a step wrote.
+func (w *Watcher) isOwn(path string) bool {
+	recorded, ok := w.own[path]
+	if !ok {
+		return false
+	}
+	sum, err := hashFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		sum = ""
+	} else if err != nil {
+		return false
+	}
+	if sum == recorded {
+		return true
+	}
+	delete(w.own, path)
+	return false
+}
+
+// locate finds the project whose data or content directory contains path,
+// preferring the innermost directory, and returns the slash-separated path
+// relative to it.
+func locate(projects []model.Project, path string) (int, string, bool) {
+	index, rel, isContent, depth := -1, "", false, -1
+	for i, project := range projects {
+		for _, dir := range []string{project.Data, project.Content} {
+			r, err := filepath.Rel(dir, path)
+			if err != nil || r == "." || strings.HasPrefix(r, "..") {
+				continue
+			}
+			if len(dir) > depth {
+				index, rel, isContent, depth = i, filepath.ToSlash(r), dir == project.Content, len(dir)
+			}
+		}
+	}
+	return index, rel, isContent
+}
+
+// ignored reports whether path is internal to decapta, such as the state
+// file or a staging directory.
+func ignored(path string) bool {
+	for _, part := range strings.Split(filepath.ToSlash(path), "/") {
+		if strings.HasPrefix(part, ".decapta") {
+			return true
+		}
+	}
+	return false
+}
+
+func addRecursive(fsw *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != dir && ignored(path) {
+			return filepath.SkipDir
+		}
+		if err := fsw.Add(path); err != nil {
+			return fmt.Errorf("error watching %s: %v", path, err)
+		}
+		return nil
+	})
+}
+
+func statTree(dir string) (map[string]fs.FileInfo, error) {
+	infos := make(map[string]fs.FileInfo)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != dir && ignored(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		infos[path] = info
+		return nil
+	})
+	return infos, err
+}
+
+func hashFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func contains(list []string, item string) bool {
+	for _, v := range list {
+		if v == item {
+			return true
+		}
+	}
+	return false
+}
+
+func list(set map[string]bool) string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
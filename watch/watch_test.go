@@ -0,0 +1,176 @@
+// Copyright 2024 Kyodo Tech合同会社
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package watch
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/kyodo-tech/decapta/model"
+)
+
+func TestLocate(t *testing.T) {
+	root := t.TempDir()
+	projects := []model.Project{
+		{Name: "site", Data: filepath.Join(root, "data"), Content: filepath.Join(root, "content")},
+		{Name: "nested", Data: filepath.Join(root, "data", "nested"), Content: filepath.Join(root, "content", "nested")},
+	}
+
+	tests := []struct {
+		path      string
+		index     int
+		rel       string
+		isContent bool
+	}{
+		{filepath.Join(root, "data", "items.csv"), 0, "items.csv", false},
+		{filepath.Join(root, "content", "items", "1.yaml"), 0, "items/1.yaml", true},
+		{filepath.Join(root, "data", "nested", "items.csv"), 1, "items.csv", false},
+		{filepath.Join(root, "content", "nested", "items", "1.yaml"), 1, "items/1.yaml", true},
+		{filepath.Join(root, "data", "nestedness.csv"), 0, "nestedness.csv", false},
+		{filepath.Join(root, "other", "items.csv"), -1, "", false},
+		{filepath.Join(root, "data"), -1, "", false},
+	}
+	for _, tt := range tests {
+		index, rel, isContent := locate(projects, tt.path)
+		if index != tt.index || rel != tt.rel || isContent != tt.isContent {
+			t.Errorf("locate(%s) = %d, %q, %v, want %d, %q, %v", tt.path, index, rel, isContent, tt.index, tt.rel, tt.isContent)
+		}
+	}
+}
+
+// watchedProject sets up a CSV project and a watcher that logs into a buffer.
+func watchedProject(t *testing.T) (*Watcher, []model.Project, *bytes.Buffer) {
+	t.Helper()
+	root := t.TempDir()
+	project := model.Project{
+		Name:    "site",
+		Type:    "csv",
+		Data:    filepath.Join(root, "data"),
+		Content: filepath.Join(root, "content"),
+	}
+	if err := os.MkdirAll(project.Data, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(project.Data, "items.csv"), "id,name\n1,Ann\n2,Bob\n")
+
+	var logs bytes.Buffer
+	w := &Watcher{
+		Projects: []model.Project{project},
+		Logger:   log.New(&logs, "", 0),
+		own:      make(map[string]string),
+	}
+	return w, w.Projects, &logs
+}
+
+func writeFile(t *testing.T, path string, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestProcess(t *testing.T) {
+	ctx := context.Background()
+	w, projects, logs := watchedProject(t)
+	project := projects[0]
+	csvPath := filepath.Join(project.Data, "items.csv")
+	rowPath := filepath.Join(project.Content, "items", "2.yaml")
+
+	// A changed data file is pre-processed
+	w.process(ctx, projects, map[string]bool{csvPath: true})
+	if !strings.Contains(readFile(t, rowPath), "Bob") {
+		t.Fatalf("content of row 2 = %q", readFile(t, rowPath))
+	}
+
+	// The content files written by pre-process do not trigger post-process
+	logs.Reset()
+	w.process(ctx, projects, map[string]bool{rowPath: true, filepath.Join(project.Content, ".items.yaml"): true})
+	if logs.Len() != 0 {
+		t.Errorf("own files were processed: %s", logs)
+	}
+
+	// An edited content file is post-processed, and the rewritten data file
+	// does not trigger pre-process
+	writeFile(t, rowPath, "slug: \"\"\nid: \"2\"\nname: Bea\n")
+	w.process(ctx, projects, map[string]bool{rowPath: true})
+	if got := readFile(t, csvPath); got != "id,name\n1,Ann\n2,Bea\n" {
+		t.Errorf("data after post-process = %q", got)
+	}
+	logs.Reset()
+	w.process(ctx, projects, map[string]bool{csvPath: true})
+	if logs.Len() != 0 {
+		t.Errorf("own data file was processed: %s", logs)
+	}
+
+	// Changes to both sides of a project are skipped
+	writeFile(t, csvPath, "id,name\n1,Ann\n2,Cid\n")
+	writeFile(t, rowPath, "slug: \"\"\nid: \"2\"\nname: Dan\n")
+	logs.Reset()
+	w.process(ctx, projects, map[string]bool{csvPath: true, rowPath: true})
+	if !strings.Contains(logs.String(), "skipping") {
+		t.Errorf("logs = %q, want skipping", logs)
+	}
+	if got := readFile(t, csvPath); got != "id,name\n1,Ann\n2,Cid\n" {
+		t.Errorf("data after skipped batch = %q", got)
+	}
+	if got := readFile(t, rowPath); !strings.Contains(got, "Dan") {
+		t.Errorf("content after skipped batch = %q", got)
+	}
+}
+
+func TestProcessDeletedDataFile(t *testing.T) {
+	ctx := context.Background()
+	w, projects, logs := watchedProject(t)
+	project := projects[0]
+	csvPath := filepath.Join(project.Data, "items.csv")
+
+	w.process(ctx, projects, map[string]bool{csvPath: true})
+	if err := os.Remove(csvPath); err != nil {
+		t.Fatal(err)
+	}
+	w.process(ctx, projects, map[string]bool{csvPath: true})
+	if !strings.Contains(logs.String(), "pre-processed items.csv") {
+		t.Errorf("logs = %q, want items.csv pre-processed", logs)
+	}
+	for _, path := range []string{filepath.Join(project.Content, "items"), filepath.Join(project.Content, ".items.yaml")} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("stale content %s: %v", path, err)
+		}
+	}
+
+	// The removed content files are the watcher's own
+	logs.Reset()
+	w.process(ctx, projects, map[string]bool{filepath.Join(project.Content, "items", "1.yaml"): true})
+	if logs.Len() != 0 {
+		t.Errorf("removed content was processed: %s", logs)
+	}
+	if _, err := os.Stat(csvPath); !os.IsNotExist(err) {
+		t.Errorf("deleted data file was written back: %v", err)
+	}
+}